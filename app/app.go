@@ -3,13 +3,20 @@ package app
 import (
 	"github.com/rs/zerolog"
 	"github.com/sterrasi/pinion/logger"
+	"github.com/sterrasi/pinion/metrics"
 	"os"
+	"sync"
 )
 
+// registerDefaultMetrics registers the runtime and process metrics the first time an Application is created
+var registerDefaultMetrics sync.Once
+
 type Application struct {
 	name          string
 	configuration *Configuration
 	profile       Profile
+	commands      map[string]*Command
+	metrics       *metrics.Registry
 }
 
 // Create the Application.  This should be done after configuration fields are registered
@@ -95,16 +102,44 @@ func CreateWithBuilder(configPath string, name string, builderFn ConfigurationBu
 		}
 	}
 
+	registerDefaultMetrics.Do(func() {
+		metrics.RegisterRuntimeMetrics(metrics.Default)
+		metrics.RegisterProcessMetrics(metrics.Default)
+	})
+
 	// create the application
 	app := &Application{
 		name:          name,
 		configuration: cfg,
 		profile:       *pProfile,
+		metrics:       metrics.Default,
 	}
 
 	return app, nil
 }
 
+// Name returns the name of the application
+func (a *Application) Name() string {
+	return a.name
+}
+
+// Configuration returns the loaded configuration of the application
+func (a *Application) Configuration() *Configuration {
+	return a.configuration
+}
+
+// Profile returns the Profile that the application was started under
+func (a *Application) Profile() Profile {
+	return a.profile
+}
+
+// Metrics returns the registry of the application's metrics. It is the metrics.Default registry that the
+// pinion packages instrument themselves with, and includes the Go runtime and process metrics. It can be
+// served with metrics.Handler
+func (a *Application) Metrics() *metrics.Registry {
+	return a.metrics
+}
+
 // configureRootLogger configure the root logger for the application
 func configureRootLogger(cfg *Configuration, profile Profile) Error {
 
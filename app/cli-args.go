@@ -51,7 +51,7 @@ func parseArgs(args []string, fieldsByArgName map[string]*Field) (*CLIArgs, Erro
 
 		// check for a flag that does not require another argument
 		if match.Type == Bool {
-			cliArgs.fieldValues[arg] = "true"
+			cliArgs.fieldValues[match.Name] = "true"
 			continue
 		} else {
 			field = match
@@ -18,3 +18,21 @@ func TestParseArgs(t *testing.T) {
 	assertMetadata(t, cfg, host, "app.com", CommandLine)
 	assertMetadata(t, cfg, port, 6000, CommandLine)
 }
+
+// Boolean flags do not take a value
+func TestParseArgsBooleanFlag(t *testing.T) {
+
+	cfg := createConfiguration(t)
+
+	registry := &FieldRegistry{
+		fields: cfg.fields,
+	}
+	verbose := registerBoolField(registry)
+	host := registerStringField(registry)
+	if err := cfg.LoadFields([]string{"appName", "-v", "-h", "app.com"}); err != nil {
+		t.Fatalf("Error loading fields: %s", err.Error())
+	}
+
+	assertMetadata(t, cfg, verbose, true, CommandLine)
+	assertMetadata(t, cfg, host, "app.com", CommandLine)
+}
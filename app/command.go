@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"sort"
+)
+
+// CommandFn executes a command with the anonymous command line arguments that follow the command name
+type CommandFn func(ctx context.Context, args []string) Error
+
+// Command is a named sub command of an Application (ex. "migrate")
+type Command struct {
+	Name             string
+	ShortDescription string
+	Fn               CommandFn
+}
+
+// AddCommand registers a sub command that is run by RunCommand when the first anonymous command line
+// argument matches its name
+func (a *Application) AddCommand(name string, shortDesc string, fn CommandFn) {
+	if a.commands == nil {
+		a.commands = make(map[string]*Command)
+	}
+	a.commands[name] = &Command{
+		Name:             name,
+		ShortDescription: shortDesc,
+		Fn:               fn,
+	}
+}
+
+// Commands returns the registered sub commands ordered by name
+func (a *Application) Commands() []*Command {
+	result := make([]*Command, 0, len(a.commands))
+	for _, c := range a.commands {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// RunCommand runs the sub command named by the first anonymous command line argument. False is returned if
+// no anonymous arguments were given, in which case the application should start normally. An error is
+// returned if the command is unknown or fails. The command is executed with the given context
+func (a *Application) RunCommand(ctx context.Context) (bool, Error) {
+	args := a.configuration.Args()
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	cmd, found := a.commands[args[0]]
+	if !found {
+		return true, BuildIllegalArgumentError().
+			Str("command", args[0]).
+			Msgf("Unknown command '%s'", args[0])
+	}
+
+	if err := cmd.Fn(ctx, args[1:]); err != nil {
+		if err.GetContext() == "" {
+			err.SetContext(cmd.Name)
+		}
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	cfg := createConfiguration(t)
+	registerStringField(createRegistry(cfg))
+	if err := cfg.LoadFields([]string{"appName", "-h", "app.com", "migrate", "to", "3"}); err != nil {
+		t.Fatalf("Error loading fields: %s", err.Error())
+	}
+
+	var received []string
+	application := &Application{name: "test", configuration: cfg}
+	application.AddCommand("migrate", "Run migrations", func(ctx context.Context, args []string) Error {
+		received = args
+		return nil
+	})
+
+	ran, err := application.RunCommand(context.Background())
+	assert.True(t, ran)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"to", "3"}, received)
+}
+
+func TestRunCommand_NoCommand(t *testing.T) {
+	cfg := createConfiguration(t)
+	registerStringField(createRegistry(cfg))
+	if err := cfg.LoadFields([]string{"appName", "-h", "app.com"}); err != nil {
+		t.Fatalf("Error loading fields: %s", err.Error())
+	}
+
+	application := &Application{name: "test", configuration: cfg}
+	ran, err := application.RunCommand(context.Background())
+	assert.False(t, ran)
+	assert.Nil(t, err)
+}
+
+func TestRunCommand_UnknownCommand(t *testing.T) {
+	cfg := createConfiguration(t)
+	registerStringField(createRegistry(cfg))
+	if err := cfg.LoadFields([]string{"appName", "bogus"}); err != nil {
+		t.Fatalf("Error loading fields: %s", err.Error())
+	}
+
+	application := &Application{name: "test", configuration: cfg}
+	ran, err := application.RunCommand(context.Background())
+	assert.True(t, ran)
+	assert.Equal(t, IllegalArgumentError, err.Code())
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
@@ -122,6 +123,27 @@ func (c *Configuration) GetBoolValue(fieldName string) (*bool, Error) {
 	return &b, nil
 }
 
+// GetDurationValue parses the value of the given String field as a time.Duration (ex. "1m30s"). A blank
+// value results in a zero duration
+func (c *Configuration) GetDurationValue(fieldName string) (*time.Duration, Error) {
+	s, err := c.GetStringValue(fieldName)
+	if err != nil {
+		return nil, err
+	}
+	if *s == "" {
+		var zero time.Duration
+		return &zero, nil
+	}
+	d, e := time.ParseDuration(*s)
+	if e != nil {
+		return nil, BuildSysConfigError().Cause(e).
+			Str("fieldName", fieldName).
+			Str("value", *s).
+			Msg("Field value is not a valid duration")
+	}
+	return &d, nil
+}
+
 func (c *Configuration) getValue(fieldName string, expectedType ValueType) (any, Error) {
 	md, present := c.values[fieldName]
 	if !present {
@@ -176,6 +198,14 @@ func (c *Configuration) LoadFields(cliArgs []string) Error {
 	return nil
 }
 
+// Args returns the anonymous (positional) command line arguments parsed by LoadFields
+func (c *Configuration) Args() []string {
+	if c.cliArgs == nil {
+		return nil
+	}
+	return c.cliArgs.anonymousArgs
+}
+
 // GetValueMetadata returns the metadata obtained when parsing a Field with the associated fieldName
 func (c *Configuration) GetValueMetadata(fieldName string) *ValueMetadata {
 	return c.values[fieldName]
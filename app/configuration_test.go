@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 // Expect a SystemConfigurationErrorCode when creating a Configuration with a bad path
@@ -315,3 +316,32 @@ func createRegistry(c *Configuration) *FieldRegistry {
 		fields: c.fields,
 	}
 }
+
+// String fields can be read as durations
+func TestGetDurationValue(t *testing.T) {
+	cfg := createConfiguration(t)
+	reg := createRegistry(cfg)
+	reg.CreateStringField("readTimeout").
+		ConfigName("Timeouts", "Read").
+		Register()
+	reg.CreateStringField("writeTimeout").
+		ConfigName("Timeouts", "Write").
+		Register()
+	reg.CreateStringField("bogusTimeout").
+		ConfigName("Timeouts", "Bogus").
+		Register()
+	if err := cfg.LoadFields([]string{}); err != nil {
+		t.Fatalf("Error loading fields: %s", err.Error())
+	}
+
+	d, err := cfg.GetDurationValue("readTimeout")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, *d)
+
+	d, err = cfg.GetDurationValue("writeTimeout")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), *d)
+
+	_, err = cfg.GetDurationValue("bogusTimeout")
+	assert.Equal(t, SystemConfigurationErrorCode, err.Code())
+}
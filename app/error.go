@@ -16,6 +16,15 @@ type Error interface {
 	GetMetadata() map[string]string
 }
 
+// MessageOf returns the message of the error without its code, context or cause if it has a
+// Message() string method (ex. ErrorImpl), or its Error() string otherwise
+func MessageOf(err Error) string {
+	if m, ok := err.(interface{ Message() string }); ok {
+		return m.Message()
+	}
+	return err.Error()
+}
+
 // ErrorImpl implements an Error
 type ErrorImpl struct {
 	code      ErrorCode
@@ -64,6 +73,11 @@ func (e *ErrorImpl) CodeValue() string {
 	return e.codeValue
 }
 
+// Message returns the error's message without the code, context or cause
+func (e *ErrorImpl) Message() string {
+	return e.message
+}
+
 // Cause returns the optional underlying error
 func (e *ErrorImpl) Cause() error {
 	return e.cause
@@ -18,3 +18,22 @@ func TestAppErrorMessageFormat(t *testing.T) {
 	assert.Equal(t, "the cause", err.Cause().Error())
 	assert.Equal(t, "[internal] some context: there was a problem; Cause=the cause", err.Error())
 }
+
+// customError is an Error implemented outside the app package, without a Message method
+type customError struct {
+	wrappedError
+}
+
+type wrappedError = Error
+
+func (c *customError) Error() string {
+	return "custom"
+}
+
+// TestMessageOf tests that the message is used if the Error has one, and the Error() string otherwise
+func TestMessageOf(t *testing.T) {
+	err := BuildInternalError().Context("some context").Msg("there was a problem")
+	assert.Equal(t, "there was a problem", MessageOf(err))
+
+	assert.Equal(t, "custom", MessageOf(&customError{err}))
+}
@@ -0,0 +1,64 @@
+package pinion
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes an exponential backoff policy with full jitter
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// DefaultBackoff starts at 100ms, doubles for every attempt and is capped at 5s
+var DefaultBackoff = Backoff{
+	Initial:    100 * time.Millisecond,
+	Max:        5 * time.Second,
+	Multiplier: 2,
+}
+
+// Ceiling returns the upper bound of the delay before the given retry attempt (starting at 1)
+func (b Backoff) Ceiling(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	ceiling := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.Max > 0 && ceiling > float64(b.Max) {
+		return b.Max
+	}
+	return time.Duration(ceiling)
+}
+
+// Delay returns a random (jittered) delay between zero and the Ceiling for the given retry attempt
+func (b Backoff) Delay(attempt int) time.Duration {
+	ceiling := b.Ceiling(attempt)
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Wait sleeps for the jittered Delay of the given retry attempt. The context's error is returned if it is
+// done before the delay elapses
+func (b Backoff) Wait(ctx context.Context, attempt int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(b.Delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
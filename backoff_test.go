@@ -0,0 +1,35 @@
+package pinion
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoffCeiling(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	assert.Equal(t, 100*time.Millisecond, b.Ceiling(1))
+	assert.Equal(t, 200*time.Millisecond, b.Ceiling(2))
+	assert.Equal(t, 800*time.Millisecond, b.Ceiling(4))
+	assert.Equal(t, time.Second, b.Ceiling(5))
+	assert.Equal(t, time.Second, b.Ceiling(50))
+}
+
+func TestBackoffDelayIsWithinCeiling(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 3}
+	for attempt := 1; attempt < 10; attempt++ {
+		d := b.Delay(attempt)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, b.Ceiling(attempt))
+	}
+}
+
+func TestBackoffWaitHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b := Backoff{Initial: time.Hour, Max: time.Hour, Multiplier: 1}
+	assert.ErrorIs(t, b.Wait(ctx, 1), context.Canceled)
+}
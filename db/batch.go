@@ -0,0 +1,187 @@
+package db
+
+import (
+	"github.com/sterrasi/pinion/app"
+)
+
+// RowSource supplies the rows of a DatabaseHandle.BulkInsert
+type RowSource interface {
+	// Next returns true if there is another row and makes it available to Values. It returns false when
+	// there are no more rows or an error occurred
+	Next() bool
+
+	// Values returns the values of the current row, one per column
+	Values() ([]any, error)
+
+	// Err returns the error that stopped the source, if any. It aborts the bulk insert
+	Err() error
+}
+
+// sliceRowSource is a RowSource over rows held in memory
+type sliceRowSource struct {
+	rows  [][]any
+	index int
+}
+
+func (s *sliceRowSource) Next() bool {
+	s.index++
+	return s.index <= len(s.rows)
+}
+
+func (s *sliceRowSource) Values() ([]any, error) {
+	return s.rows[s.index-1], nil
+}
+
+func (s *sliceRowSource) Err() error {
+	return nil
+}
+
+// RowsFromSlice returns a RowSource over the given rows
+func RowsFromSlice(rows [][]any) RowSource {
+	return &sliceRowSource{rows: rows}
+}
+
+// funcRowSource is a RowSource calling a function for every row
+type funcRowSource struct {
+	count  int
+	index  int
+	fn     func(i int) ([]any, error)
+	values []any
+	err    error
+}
+
+func (s *funcRowSource) Next() bool {
+	if s.err != nil || s.index >= s.count {
+		return false
+	}
+	s.values, s.err = s.fn(s.index)
+	s.index++
+	return s.err == nil
+}
+
+func (s *funcRowSource) Values() ([]any, error) {
+	return s.values, s.err
+}
+
+func (s *funcRowSource) Err() error {
+	return s.err
+}
+
+// RowsFromFunc returns a RowSource of count rows whose values are produced by the function, so the rows
+// do not have to be held in memory at once (ex. converting a slice of models)
+func RowsFromFunc(count int, fn func(i int) ([]any, error)) RowSource {
+	return &funcRowSource{count: count, fn: fn}
+}
+
+// BatchReader reads the results of a sent Batch in queue order. It is implemented by the database drivers
+type BatchReader interface {
+	// Exec reads the result of the next statement
+	Exec() (*ExecResult, app.Error)
+
+	// Query reads the rows of the next statement
+	Query() (RowIterator, app.Error)
+}
+
+// QueuedStatement is a statement queued in a Batch
+type QueuedStatement struct {
+	Name string
+	SQL  string
+	Args []any
+	read func(reader BatchReader) app.Error
+}
+
+// Read reads the result of the statement from the BatchReader into the statement's result. It is called
+// by the database drivers for each queued statement in order
+func (q *QueuedStatement) Read(reader BatchReader) app.Error {
+	return q.read(reader)
+}
+
+// BatchExecResult is the result of a statement queued with Batch.Exec or Batch.Insert. It is set when the
+// batch is sent
+type BatchExecResult struct {
+	Result *ExecResult
+	Err    app.Error
+}
+
+// BatchQueryResult is the result of a query queued with QueueQuery. It is set when the batch is sent
+type BatchQueryResult[M any] struct {
+	Rows []*M
+	Err  app.Error
+}
+
+// Batch queues statements that are sent to the database in a single round trip with
+// DatabaseHandle.SendBatch. Each queued statement returns a result that is set once the batch is sent:
+//
+//	batch := &db.Batch{}
+//	inserted := batch.Insert(insertUser, "bob")
+//	users := db.QueueQuery(batch, selectUsers)
+//	if err := handle.SendBatch(ctx, batch); err != nil {
+//		...
+//	}
+//	fmt.Println(inserted.Err, len(users.Rows))
+type Batch struct {
+	statements []*QueuedStatement
+}
+
+// Len returns the number of queued statements
+func (b *Batch) Len() int {
+	return len(b.statements)
+}
+
+// Statements returns the queued statements in order
+func (b *Batch) Statements() []*QueuedStatement {
+	return b.statements
+}
+
+// Exec queues an SQL statement
+func (b *Batch) Exec(name string, sql string, args ...any) *BatchExecResult {
+	result := &BatchExecResult{}
+	b.queue(name, sql, args, func(reader BatchReader) app.Error {
+		result.Result, result.Err = reader.Exec()
+		return result.Err
+	})
+	return result
+}
+
+// Insert queues an insert statement that is expected to add a record, as with DatabaseHandle.Insert
+func (b *Batch) Insert(stmt *InsertStatement, args ...any) *BatchExecResult {
+	result := &BatchExecResult{}
+	b.queue(stmt.Name, stmt.SQL, args, func(reader BatchReader) app.Error {
+		result.Result, result.Err = reader.Exec()
+		if result.Err == nil && result.Result.RowsAffected == 0 {
+			result.Err = BuildSqlError().Msg("Record was not inserted")
+		}
+		return result.Err
+	})
+	return result
+}
+
+// QueueQuery queues a multi-row query whose rows are mapped as with QueryStatement.Query
+func QueueQuery[M any](b *Batch, stmt *QueryStatement[M], args ...any) *BatchQueryResult[M] {
+	result := &BatchQueryResult[M]{}
+	b.queue(stmt.Name, stmt.SQL, args, func(reader BatchReader) app.Error {
+		rows, err := reader.Query()
+		if err != nil {
+			result.Err = err
+			return err
+		}
+		result.Rows, result.Err = collectRows(rows, stmt.Mapper)
+		return result.Err
+	})
+	return result
+}
+
+func (b *Batch) queue(name string, sql string, args []any, read func(reader BatchReader) app.Error) {
+	b.statements = append(b.statements, &QueuedStatement{
+		Name: name,
+		SQL:  sql,
+		Args: args,
+		read: func(reader BatchReader) app.Error {
+			err := read(reader)
+			if err != nil {
+				err.SetContext(name)
+			}
+			return err
+		},
+	})
+}
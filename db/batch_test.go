@@ -0,0 +1,89 @@
+package db
+
+import (
+	"errors"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fakeBatchReader returns the exec results and rows in order
+type fakeBatchReader struct {
+	execs []*ExecResult
+	rows  []*fakeRows
+}
+
+func (r *fakeBatchReader) Exec() (*ExecResult, app.Error) {
+	result := r.execs[0]
+	r.execs = r.execs[1:]
+	if result == nil {
+		return nil, BuildSqlError().Msg("exec failed")
+	}
+	return result, nil
+}
+
+func (r *fakeBatchReader) Query() (RowIterator, app.Error) {
+	rows := r.rows[0]
+	r.rows = r.rows[1:]
+	return rows, nil
+}
+
+// test that the results of the queued statements are set when they are read
+func TestBatch(t *testing.T) {
+	insert := &InsertStatement{Name: "InsertItem", SQL: "INSERT INTO items (name) VALUES ($1)"}
+
+	batch := &Batch{}
+	inserted := batch.Insert(insert, "a")
+	notInserted := batch.Insert(insert, "b")
+	items := QueueQuery(batch, itemQuery)
+	failed := batch.Exec("DeleteItems", "DELETE FROM items")
+	assert.Equal(t, 4, batch.Len())
+	assert.Equal(t, []any{"b"}, batch.Statements()[1].Args)
+
+	reader := &fakeBatchReader{
+		execs: []*ExecResult{{RowsAffected: 1}, {RowsAffected: 0}, nil},
+		rows:  []*fakeRows{itemRows(1, 2)},
+	}
+	var errs []app.Error
+	for _, stmt := range batch.Statements() {
+		errs = append(errs, stmt.Read(reader))
+	}
+
+	assert.Nil(t, inserted.Err)
+	assert.Equal(t, uint(1), inserted.Result.RowsAffected)
+	if assert.NotNil(t, notInserted.Err) {
+		assert.Equal(t, "InsertItem", notInserted.Err.GetContext())
+	}
+	assert.Nil(t, items.Err)
+	assert.Len(t, items.Rows, 2)
+	if assert.NotNil(t, failed.Err) {
+		assert.Equal(t, "DeleteItems", failed.Err.GetContext())
+	}
+	assert.Equal(t, []app.Error{nil, notInserted.Err, nil, failed.Err}, errs)
+}
+
+// test the row sources of a bulk insert
+func TestRowSources(t *testing.T) {
+	slice := RowsFromSlice([][]any{{1, "a"}, {2, "b"}})
+	var values [][]any
+	for slice.Next() {
+		v, _ := slice.Values()
+		values = append(values, v)
+	}
+	assert.Nil(t, slice.Err())
+	assert.Equal(t, [][]any{{1, "a"}, {2, "b"}}, values)
+
+	names := []string{"a", "b", "c"}
+	fn := RowsFromFunc(len(names), func(i int) ([]any, error) {
+		if i == 2 {
+			return nil, errors.New("bad row")
+		}
+		return []any{names[i]}, nil
+	})
+	count := 0
+	for fn.Next() {
+		count++
+	}
+	assert.Equal(t, 2, count)
+	assert.EqualError(t, fn.Err(), "bad row")
+}
@@ -0,0 +1,511 @@
+package db
+
+import (
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the SQL differences between databases that the statement builders need to know about
+type Dialect interface {
+	// Placeholder returns the placeholder of the nth (starting at 1) statement argument
+	Placeholder(n int) string
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+type questionDialect struct{}
+
+func (questionDialect) Placeholder(int) string {
+	return "?"
+}
+
+// Postgres uses numbered placeholders ($1, $2, ...)
+var Postgres Dialect = postgresDialect{}
+
+// Question uses positional '?' placeholders
+var Question Dialect = questionDialect{}
+
+// Builder builds an SQL statement and its arguments for a Dialect
+type Builder interface {
+	Build(dialect Dialect) (string, []any, app.Error)
+}
+
+// BuildQuery builds a QueryStatement from the builder. The returned arguments are passed to
+// QueryStatement.Query or QueryStatement.QueryRow
+func BuildQuery[M any](b Builder, dialect Dialect, name string, mapper MapperFn[M]) (*QueryStatement[M], []any,
+	app.Error) {
+
+	sql, args, err := b.Build(dialect)
+	if err != nil {
+		err.SetContext(name)
+		return nil, nil, err
+	}
+	return &QueryStatement[M]{SQL: sql, Name: name, Mapper: mapper}, args, nil
+}
+
+// BuildInsert builds an InsertStatement from the builder. The returned arguments are passed to
+// DatabaseHandle.Insert
+func BuildInsert(b Builder, dialect Dialect, name string) (*InsertStatement, []any, app.Error) {
+	sql, args, err := b.Build(dialect)
+	if err != nil {
+		err.SetContext(name)
+		return nil, nil, err
+	}
+	return &InsertStatement{SQL: sql, Name: name}, args, nil
+}
+
+// sqlWriter accumulates the SQL text and arguments of a statement
+type sqlWriter struct {
+	sb      strings.Builder
+	args    []any
+	dialect Dialect
+	err     error
+}
+
+func (w *sqlWriter) write(s string) {
+	w.sb.WriteString(s)
+}
+
+// arg adds the argument and writes its placeholder
+func (w *sqlWriter) arg(value any) {
+	w.args = append(w.args, value)
+	w.sb.WriteString(w.dialect.Placeholder(len(w.args)))
+}
+
+// raw writes SQL that uses '?' placeholders for the given arguments
+func (w *sqlWriter) raw(sql string, args []any) {
+	n := 0
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '?' {
+			w.sb.WriteByte(sql[i])
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == '?' {
+			w.sb.WriteByte('?')
+			i++
+			continue
+		}
+		if n >= len(args) {
+			w.fail("not enough arguments for the placeholders of '%s'", sql)
+			return
+		}
+		w.arg(args[n])
+		n++
+	}
+	if n != len(args) {
+		w.fail("too many arguments for the placeholders of '%s'", sql)
+	}
+}
+
+// fail records the first error encountered while building a statement
+func (w *sqlWriter) fail(format string, args ...any) {
+	if w.err == nil {
+		w.err = fmt.Errorf(format, args...)
+	}
+}
+
+// result returns the built statement or an IllegalArgumentError describing why it could not be built
+func (w *sqlWriter) result() (string, []any, app.Error) {
+	if w.err != nil {
+		return "", nil, app.BuildIllegalArgumentError().
+			Cause(w.err).
+			Str("sql", w.sb.String()).
+			Msg("Invalid SQL statement")
+	}
+	return w.sb.String(), w.args, nil
+}
+
+func (w *sqlWriter) list(items []string) {
+	w.write(strings.Join(items, ", "))
+}
+
+func (w *sqlWriter) where(keyword string, conditions []Condition) {
+	if len(conditions) == 0 {
+		return
+	}
+	w.write(" ")
+	w.write(keyword)
+	w.write(" ")
+	And(conditions...).build(w)
+}
+
+func (w *sqlWriter) returning(columns []string) {
+	if len(columns) > 0 {
+		w.write(" RETURNING ")
+		w.list(columns)
+	}
+}
+
+// join is a JOIN clause of a select statement
+type join struct {
+	kind  string
+	table string
+	on    Condition
+}
+
+// SelectBuilder builds a SELECT statement
+type SelectBuilder struct {
+	columns   []string
+	from      string
+	joins     []join
+	where     []Condition
+	groupBy   []string
+	having    []Condition
+	orderBy   []string
+	limit     *uint64
+	offset    *uint64
+	forUpdate bool
+}
+
+// Select starts a SELECT statement for the given column expressions
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+// From sets the table expression (ex. "users u")
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.from = table
+	return b
+}
+
+// Join adds an INNER JOIN
+func (b *SelectBuilder) Join(table string, on Condition) *SelectBuilder {
+	b.joins = append(b.joins, join{kind: "JOIN", table: table, on: on})
+	return b
+}
+
+// LeftJoin adds a LEFT JOIN
+func (b *SelectBuilder) LeftJoin(table string, on Condition) *SelectBuilder {
+	b.joins = append(b.joins, join{kind: "LEFT JOIN", table: table, on: on})
+	return b
+}
+
+// Where adds conditions that are joined with AND
+func (b *SelectBuilder) Where(conditions ...Condition) *SelectBuilder {
+	b.where = append(b.where, conditions...)
+	return b
+}
+
+// GroupBy sets the GROUP BY expressions
+func (b *SelectBuilder) GroupBy(columns ...string) *SelectBuilder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// Having adds HAVING conditions that are joined with AND
+func (b *SelectBuilder) Having(conditions ...Condition) *SelectBuilder {
+	b.having = append(b.having, conditions...)
+	return b
+}
+
+// OrderBy sets the ORDER BY expressions (ex. "created_at DESC")
+func (b *SelectBuilder) OrderBy(columns ...string) *SelectBuilder {
+	b.orderBy = append(b.orderBy, columns...)
+	return b
+}
+
+// Limit sets the max number of rows returned
+func (b *SelectBuilder) Limit(limit uint64) *SelectBuilder {
+	b.limit = &limit
+	return b
+}
+
+// Offset sets the number of rows skipped
+func (b *SelectBuilder) Offset(offset uint64) *SelectBuilder {
+	b.offset = &offset
+	return b
+}
+
+// ForUpdate locks the selected rows
+func (b *SelectBuilder) ForUpdate() *SelectBuilder {
+	b.forUpdate = true
+	return b
+}
+
+// clone returns a copy of the builder that can be modified without affecting this one
+func (b *SelectBuilder) clone() *SelectBuilder {
+	c := *b
+	c.columns = append([]string{}, b.columns...)
+	c.joins = append([]join{}, b.joins...)
+	c.where = append([]Condition{}, b.where...)
+	c.groupBy = append([]string{}, b.groupBy...)
+	c.having = append([]Condition{}, b.having...)
+	c.orderBy = append([]string{}, b.orderBy...)
+	return &c
+}
+
+// Build satisfies the Builder interface
+func (b *SelectBuilder) Build(dialect Dialect) (string, []any, app.Error) {
+	w := &sqlWriter{dialect: dialect}
+
+	if len(b.columns) == 0 {
+		w.fail("select has no columns")
+	}
+	w.write("SELECT ")
+	w.list(b.columns)
+
+	if b.from != "" {
+		w.write(" FROM ")
+		w.write(b.from)
+	}
+	for _, j := range b.joins {
+		w.write(" ")
+		w.write(j.kind)
+		w.write(" ")
+		w.write(j.table)
+		w.write(" ON ")
+		if j.on == nil {
+			w.fail("%s %s has no condition", j.kind, j.table)
+			continue
+		}
+		j.on.build(w)
+	}
+	w.where("WHERE", b.where)
+	if len(b.groupBy) > 0 {
+		w.write(" GROUP BY ")
+		w.list(b.groupBy)
+	}
+	w.where("HAVING", b.having)
+	if len(b.orderBy) > 0 {
+		w.write(" ORDER BY ")
+		w.list(b.orderBy)
+	}
+	if b.limit != nil {
+		w.write(" LIMIT ")
+		w.arg(*b.limit)
+	}
+	if b.offset != nil {
+		w.write(" OFFSET ")
+		w.arg(*b.offset)
+	}
+	if b.forUpdate {
+		w.write(" FOR UPDATE")
+	}
+	return w.result()
+}
+
+// InsertBuilder builds an INSERT statement
+type InsertBuilder struct {
+	table          string
+	columns        []string
+	rows           [][]any
+	conflictTarget []string
+	doNothing      bool
+	updateColumns  []string
+	returning      []string
+}
+
+// InsertInto starts an INSERT statement for the given table
+func InsertInto(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+// Columns sets the inserted columns
+func (b *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	b.columns = columns
+	return b
+}
+
+// Values adds a row of values, one per column
+func (b *InsertBuilder) Values(values ...any) *InsertBuilder {
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// OnConflict sets the conflict target columns used by DoNothing and DoUpdate
+func (b *InsertBuilder) OnConflict(columns ...string) *InsertBuilder {
+	b.conflictTarget = columns
+	return b
+}
+
+// DoNothing ignores rows that conflict with an existing row
+func (b *InsertBuilder) DoNothing() *InsertBuilder {
+	b.doNothing = true
+	return b
+}
+
+// DoUpdate updates the given columns of a conflicting row with the inserted (EXCLUDED) values
+func (b *InsertBuilder) DoUpdate(columns ...string) *InsertBuilder {
+	b.updateColumns = columns
+	return b
+}
+
+// Returning sets the RETURNING column expressions
+func (b *InsertBuilder) Returning(columns ...string) *InsertBuilder {
+	b.returning = columns
+	return b
+}
+
+// Build satisfies the Builder interface
+func (b *InsertBuilder) Build(dialect Dialect) (string, []any, app.Error) {
+	w := &sqlWriter{dialect: dialect}
+
+	if len(b.columns) == 0 {
+		w.fail("insert into %s has no columns", b.table)
+	}
+	if len(b.rows) == 0 {
+		w.fail("insert into %s has no values", b.table)
+	}
+
+	w.write("INSERT INTO ")
+	w.write(b.table)
+	w.write(" (")
+	w.list(b.columns)
+	w.write(") VALUES ")
+	for i, row := range b.rows {
+		if len(row) != len(b.columns) {
+			w.fail("row %d of insert into %s has %d values for %d columns", i, b.table, len(row),
+				len(b.columns))
+		}
+		if i > 0 {
+			w.write(", ")
+		}
+		w.write("(")
+		for j, v := range row {
+			if j > 0 {
+				w.write(", ")
+			}
+			w.arg(v)
+		}
+		w.write(")")
+	}
+
+	if b.doNothing || len(b.updateColumns) > 0 {
+		w.write(" ON CONFLICT")
+		if len(b.conflictTarget) > 0 {
+			w.write(" (")
+			w.list(b.conflictTarget)
+			w.write(")")
+		}
+		if b.doNothing {
+			w.write(" DO NOTHING")
+		} else {
+			if len(b.conflictTarget) == 0 {
+				w.fail("on conflict do update requires a conflict target")
+			}
+			w.write(" DO UPDATE SET ")
+			for i, c := range b.updateColumns {
+				if i > 0 {
+					w.write(", ")
+				}
+				w.write(c)
+				w.write(" = EXCLUDED.")
+				w.write(c)
+			}
+		}
+	}
+	w.returning(b.returning)
+	return w.result()
+}
+
+// assignment is a "column = value" pair of an UPDATE statement
+type assignment struct {
+	column string
+	value  any
+	expr   *rawCondition
+}
+
+// UpdateBuilder builds an UPDATE statement
+type UpdateBuilder struct {
+	table       string
+	assignments []assignment
+	where       []Condition
+	returning   []string
+}
+
+// Update starts an UPDATE statement for the given table
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set assigns a value to the column
+func (b *UpdateBuilder) Set(column string, value any) *UpdateBuilder {
+	b.assignments = append(b.assignments, assignment{column: column, value: value})
+	return b
+}
+
+// SetExpr assigns a raw SQL expression using '?' placeholders to the column (ex. SetExpr("count", "count + ?", 1))
+func (b *UpdateBuilder) SetExpr(column string, sql string, args ...any) *UpdateBuilder {
+	b.assignments = append(b.assignments, assignment{column: column, expr: &rawCondition{sql: sql, args: args}})
+	return b
+}
+
+// Where adds conditions that are joined with AND
+func (b *UpdateBuilder) Where(conditions ...Condition) *UpdateBuilder {
+	b.where = append(b.where, conditions...)
+	return b
+}
+
+// Returning sets the RETURNING column expressions
+func (b *UpdateBuilder) Returning(columns ...string) *UpdateBuilder {
+	b.returning = columns
+	return b
+}
+
+// Build satisfies the Builder interface
+func (b *UpdateBuilder) Build(dialect Dialect) (string, []any, app.Error) {
+	w := &sqlWriter{dialect: dialect}
+
+	if len(b.assignments) == 0 {
+		w.fail("update of %s has no assignments", b.table)
+	}
+
+	w.write("UPDATE ")
+	w.write(b.table)
+	w.write(" SET ")
+	for i, a := range b.assignments {
+		if i > 0 {
+			w.write(", ")
+		}
+		w.write(a.column)
+		w.write(" = ")
+		if a.expr != nil {
+			a.expr.build(w)
+		} else {
+			w.arg(a.value)
+		}
+	}
+	w.where("WHERE", b.where)
+	w.returning(b.returning)
+	return w.result()
+}
+
+// DeleteBuilder builds a DELETE statement
+type DeleteBuilder struct {
+	table     string
+	where     []Condition
+	returning []string
+}
+
+// DeleteFrom starts a DELETE statement for the given table
+func DeleteFrom(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+// Where adds conditions that are joined with AND
+func (b *DeleteBuilder) Where(conditions ...Condition) *DeleteBuilder {
+	b.where = append(b.where, conditions...)
+	return b
+}
+
+// Returning sets the RETURNING column expressions
+func (b *DeleteBuilder) Returning(columns ...string) *DeleteBuilder {
+	b.returning = columns
+	return b
+}
+
+// Build satisfies the Builder interface
+func (b *DeleteBuilder) Build(dialect Dialect) (string, []any, app.Error) {
+	w := &sqlWriter{dialect: dialect}
+	w.write("DELETE FROM ")
+	w.write(b.table)
+	w.where("WHERE", b.where)
+	w.returning(b.returning)
+	return w.result()
+}
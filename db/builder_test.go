@@ -0,0 +1,108 @@
+package db
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type user struct {
+	Id   int64
+	Name string
+}
+
+func TestSelectBuilder(t *testing.T) {
+	sql, args, err := Select("u.id", "u.name").
+		From("users u").
+		LeftJoin("orgs o", Expr("o.id = u.org_id")).
+		Where(Eq("u.active", true), Or(Like("u.name", "a%"), In("u.id", 1, 2))).
+		Where(IsNull("u.deleted_at")).
+		OrderBy("u.name", "u.id DESC").
+		Limit(10).
+		Offset(20).
+		Build(Postgres)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT u.id, u.name FROM users u LEFT JOIN orgs o ON o.id = u.org_id "+
+		"WHERE (u.active = $1 AND (u.name LIKE $2 OR u.id IN ($3, $4)) AND u.deleted_at IS NULL) "+
+		"ORDER BY u.name, u.id DESC LIMIT $5 OFFSET $6", sql)
+	assert.Equal(t, []any{true, "a%", 1, 2, uint64(10), uint64(20)}, args)
+}
+
+func TestSelectBuilder_QuestionDialect(t *testing.T) {
+	sql, args, err := Select("id").From("users").Where(Gt("age", 18), Expr("name <> ?", "bob")).Build(Question)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM users WHERE (age > ? AND name <> ?)", sql)
+	assert.Equal(t, []any{18, "bob"}, args)
+}
+
+func TestInsertBuilder(t *testing.T) {
+	sql, args, err := InsertInto("users").
+		Columns("id", "name").
+		Values(1, "bob").
+		Values(2, "alice").
+		OnConflict("id").DoUpdate("name").
+		Returning("id").
+		Build(Postgres)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4) "+
+		"ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name RETURNING id", sql)
+	assert.Equal(t, []any{1, "bob", 2, "alice"}, args)
+
+	sql, _, err = InsertInto("users").Columns("id").Values(1).DoNothing().Build(Postgres)
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO users (id) VALUES ($1) ON CONFLICT DO NOTHING", sql)
+}
+
+func TestInsertBuilder_MismatchedValues(t *testing.T) {
+	_, _, err := InsertInto("users").Columns("id", "name").Values(1).Build(Postgres)
+	assert.Equal(t, app.IllegalArgumentError, err.Code())
+}
+
+func TestSelectBuilder_NilJoinCondition(t *testing.T) {
+	_, _, err := Select("u.id").From("users u").Join("orgs o", nil).Build(Postgres)
+	assert.Equal(t, app.IllegalArgumentError, err.Code())
+}
+
+func TestUpdateBuilder(t *testing.T) {
+	sql, args, err := Update("users").
+		Set("name", "bob").
+		SetExpr("version", "version + ?", 1).
+		Where(Eq("id", 7)).
+		Returning("version").
+		Build(Postgres)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE users SET name = $1, version = version + $2 WHERE id = $3 RETURNING version", sql)
+	assert.Equal(t, []any{"bob", 1, 7}, args)
+}
+
+func TestDeleteBuilder(t *testing.T) {
+	sql, args, err := DeleteFrom("users").Where(NotIn("id"), Not(Eq("name", "root"))).Build(Postgres)
+	assert.Nil(t, err)
+	assert.Equal(t, "DELETE FROM users WHERE (TRUE AND NOT (name = $1))", sql)
+	assert.Equal(t, []any{"root"}, args)
+}
+
+func TestExpr_PlaceholderMismatch(t *testing.T) {
+	_, _, err := Select("id").From("users").Where(Expr("a = ? AND b = ?", 1)).Build(Postgres)
+	assert.Equal(t, app.IllegalArgumentError, err.Code())
+
+	sql, _, err := Select("id").From("docs").Where(Expr("tags ?? ?", "go")).Build(Postgres)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM docs WHERE tags ? $1", sql)
+}
+
+func TestBuildQuery(t *testing.T) {
+	stmt, args, err := BuildQuery[user](Select("id", "name").From("users").Where(Eq("id", 1)), Postgres,
+		"GetUser", func(scanner Scanner, model *user) app.Error {
+			return scanner.Scan(&model.Id, &model.Name)
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "GetUser", stmt.Name)
+	assert.Equal(t, "SELECT id, name FROM users WHERE id = $1", stmt.SQL)
+	assert.NotNil(t, stmt.Mapper)
+	assert.Equal(t, []any{1}, args)
+}
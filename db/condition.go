@@ -0,0 +1,201 @@
+package db
+
+// Condition is a boolean SQL expression used in WHERE and HAVING clauses
+type Condition interface {
+	build(w *sqlWriter)
+}
+
+// comparison is a binary comparison between a column expression and a value
+type comparison struct {
+	column   string
+	operator string
+	value    any
+}
+
+func (c *comparison) build(w *sqlWriter) {
+	w.write(c.column)
+	w.write(" ")
+	w.write(c.operator)
+	w.write(" ")
+	w.arg(c.value)
+}
+
+// Eq is "column = value"
+func Eq(column string, value any) Condition {
+	return &comparison{column: column, operator: "=", value: value}
+}
+
+// NotEq is "column <> value"
+func NotEq(column string, value any) Condition {
+	return &comparison{column: column, operator: "<>", value: value}
+}
+
+// Lt is "column < value"
+func Lt(column string, value any) Condition {
+	return &comparison{column: column, operator: "<", value: value}
+}
+
+// Lte is "column <= value"
+func Lte(column string, value any) Condition {
+	return &comparison{column: column, operator: "<=", value: value}
+}
+
+// Gt is "column > value"
+func Gt(column string, value any) Condition {
+	return &comparison{column: column, operator: ">", value: value}
+}
+
+// Gte is "column >= value"
+func Gte(column string, value any) Condition {
+	return &comparison{column: column, operator: ">=", value: value}
+}
+
+// Like is "column LIKE pattern"
+func Like(column string, pattern string) Condition {
+	return &comparison{column: column, operator: "LIKE", value: pattern}
+}
+
+// ILike is "column ILIKE pattern" (postgres)
+func ILike(column string, pattern string) Condition {
+	return &comparison{column: column, operator: "ILIKE", value: pattern}
+}
+
+// inCondition is "column IN (values...)"
+type inCondition struct {
+	column string
+	values []any
+	negate bool
+}
+
+func (c *inCondition) build(w *sqlWriter) {
+	if len(c.values) == 0 {
+		// nothing is in an empty set
+		if c.negate {
+			w.write("TRUE")
+		} else {
+			w.write("FALSE")
+		}
+		return
+	}
+	w.write(c.column)
+	if c.negate {
+		w.write(" NOT IN (")
+	} else {
+		w.write(" IN (")
+	}
+	for i, v := range c.values {
+		if i > 0 {
+			w.write(", ")
+		}
+		w.arg(v)
+	}
+	w.write(")")
+}
+
+// In is "column IN (values...)". An empty list of values is always false
+func In(column string, values ...any) Condition {
+	return &inCondition{column: column, values: values}
+}
+
+// NotIn is "column NOT IN (values...)". An empty list of values is always true
+func NotIn(column string, values ...any) Condition {
+	return &inCondition{column: column, values: values, negate: true}
+}
+
+// nullCondition is "column IS [NOT] NULL"
+type nullCondition struct {
+	column string
+	negate bool
+}
+
+func (c *nullCondition) build(w *sqlWriter) {
+	w.write(c.column)
+	if c.negate {
+		w.write(" IS NOT NULL")
+	} else {
+		w.write(" IS NULL")
+	}
+}
+
+// IsNull is "column IS NULL"
+func IsNull(column string) Condition {
+	return &nullCondition{column: column}
+}
+
+// IsNotNull is "column IS NOT NULL"
+func IsNotNull(column string) Condition {
+	return &nullCondition{column: column, negate: true}
+}
+
+// junction joins conditions with AND or OR
+type junction struct {
+	operator   string
+	conditions []Condition
+}
+
+func (j *junction) build(w *sqlWriter) {
+	if len(j.conditions) == 0 {
+		if j.operator == "AND" {
+			w.write("TRUE")
+		} else {
+			w.write("FALSE")
+		}
+		return
+	}
+	if len(j.conditions) == 1 {
+		j.conditions[0].build(w)
+		return
+	}
+	w.write("(")
+	for i, c := range j.conditions {
+		if i > 0 {
+			w.write(" ")
+			w.write(j.operator)
+			w.write(" ")
+		}
+		c.build(w)
+	}
+	w.write(")")
+}
+
+// And is true if all the conditions are true
+func And(conditions ...Condition) Condition {
+	return &junction{operator: "AND", conditions: conditions}
+}
+
+// Or is true if any of the conditions are true
+func Or(conditions ...Condition) Condition {
+	return &junction{operator: "OR", conditions: conditions}
+}
+
+// notCondition negates a condition
+type notCondition struct {
+	condition Condition
+}
+
+func (n *notCondition) build(w *sqlWriter) {
+	w.write("NOT (")
+	n.condition.build(w)
+	w.write(")")
+}
+
+// Not negates the condition
+func Not(condition Condition) Condition {
+	return &notCondition{condition: condition}
+}
+
+// rawCondition is an SQL expression using '?' placeholders for its arguments
+type rawCondition struct {
+	sql  string
+	args []any
+}
+
+func (r *rawCondition) build(w *sqlWriter) {
+	w.raw(r.sql, r.args)
+}
+
+// Expr is a raw SQL expression whose '?' placeholders are replaced with the dialect's placeholders for the
+// given arguments (ex. Expr("created_at > now() - ? * interval '1 day'", days)). Use '??' for a literal '?'
+func Expr(sql string, args ...any) Condition {
+	return &rawCondition{sql: sql, args: args}
+}
@@ -1,6 +1,11 @@
 package db
 
-import "github.com/sterrasi/pinion/app"
+import (
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	"strings"
+	"time"
+)
 
 const dbSectionName = "Database"
 
@@ -11,18 +16,81 @@ const dbUserFieldName = "dbUser"
 const dbPasswordFieldName = "dbPassword"
 const maxIdleConnectionsFieldName = "maxIdleConnections"
 const maxOpenConnectionsFieldName = "maxOpenConnections"
+const minConnectionsFieldName = "minConnections"
+const dbPortFieldName = "dbPort"
+const dbSSLModeFieldName = "dbSSLMode"
+const dbTLSCaFileFieldName = "dbTLSCaFile"
+const dbTLSCertFileFieldName = "dbTLSCertFile"
+const dbTLSKeyFileFieldName = "dbTLSKeyFile"
+const connectTimeoutFieldName = "dbConnectTimeout"
+const statementTimeoutFieldName = "dbStatementTimeout"
+const applicationNameFieldName = "dbApplicationName"
+const maxConnLifetimeFieldName = "dbMaxConnLifetime"
+const maxConnIdleTimeFieldName = "dbMaxConnIdleTime"
+const healthCheckPeriodFieldName = "dbHealthCheckPeriod"
+const replicaHostsFieldName = "dbReplicaHosts"
+const replicaBalancingFieldName = "dbReplicaBalancing"
+const replicaFailureThresholdFieldName = "dbReplicaFailureThreshold"
+const replicaEjectionTimeFieldName = "dbReplicaEjectionTime"
+const txMaxAttemptsFieldName = "txMaxAttempts"
+const txRetryInitialBackoffFieldName = "txRetryInitialBackoff"
+const txRetryMaxBackoffFieldName = "txRetryMaxBackoff"
+const slowQueryThresholdFieldName = "dbSlowQueryThreshold"
+const explainSlowQueriesFieldName = "dbExplainSlowQueries"
 
 // DbConfig contains values required to connect to a database
 type DbConfig struct {
-	DbName             string
-	Host               string
-	User               string
-	Schema             string
-	Password           string
+	DbName string
+	// Host is the database host, optionally including the port (ex. localhost:5432)
+	Host string
+	// Port is used if the Host does not include one
+	Port     uint
+	User     string
+	Schema   string
+	Password string
+	// SSLMode is the libpq sslmode (disable, allow, prefer, require, verify-ca or verify-full)
+	SSLMode     string
+	TLSCaFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	// ConnectTimeout limits establishing a connection. 0 means no limit
+	ConnectTimeout time.Duration
+	// StatementTimeout aborts statements running longer. 0 means no limit
+	StatementTimeout time.Duration
+	// ApplicationName is reported in pg_stat_activity
+	ApplicationName string
+	// MaxIdleConnections is not used by the postgres pool, which closes idle connections after MaxConnIdleTime
 	MaxIdleConnections uint
 	MaxOpenConnections uint
+	MinConnections     uint
+	MaxConnLifetime    time.Duration
+	MaxConnIdleTime    time.Duration
+	// HealthCheckPeriod is the interval between health checks of idle connections
+	HealthCheckPeriod time.Duration
+	// ReplicaHosts are the read replicas that read transactions are routed to
+	ReplicaHosts []string
+	// ReplicaBalancing selects the replica of a read transaction
+	ReplicaBalancing ReplicaBalancing
+	// ReplicaFailureThreshold is the number of consecutive failures after which a replica is ejected
+	ReplicaFailureThreshold uint
+	// ReplicaEjectionTime is how long an ejected replica receives no reads before it is tried again
+	ReplicaEjectionTime time.Duration
+	// TxRetry is the default RetryPolicy of transactions. It makes a single attempt unless TxMaxAttempts is
+	// configured, since retrying executes the TransactionFn again along with its side effects
+	TxRetry RetryPolicy
+	// SlowQuery selects the queries that are logged as slow
+	SlowQuery SlowQueryPolicy
 }
 
+// ReplicaBalancing is the strategy used to select a read replica
+type ReplicaBalancing string
+
+// Replica balancing strategies
+const (
+	RoundRobin       ReplicaBalancing = "round-robin"
+	LeastConnections ReplicaBalancing = "least-connections"
+)
+
 // RegisterConfig will register the config field definitions needed for connecting to a database
 func RegisterConfig(reg app.FieldRegistry) {
 
@@ -59,8 +127,8 @@ func RegisterConfig(reg app.FieldRegistry) {
 	reg.CreateStringField(dbUserFieldName).
 		ArgName("db-user").
 		EnvVar("DB_USER").
-		ConfigName(dbSectionName, "Schema").
-		ShortDesc("Database Schema").
+		ConfigName(dbSectionName, "User").
+		ShortDesc("Database User").
 		Required().
 		Register()
 
@@ -72,6 +140,67 @@ func RegisterConfig(reg app.FieldRegistry) {
 		Required().
 		Register()
 
+	// used if the host does not include a port
+	reg.CreateUintField(dbPortFieldName).
+		ArgName("db-port").
+		EnvVar("DB_PORT").
+		ConfigName(dbSectionName, "Port").
+		ShortDesc("Database Port").
+		Default(5432).
+		Register()
+
+	// disable, allow, prefer, require, verify-ca or verify-full
+	reg.CreateStringField(dbSSLModeFieldName).
+		ArgName("db-ssl-mode").
+		EnvVar("DB_SSL_MODE").
+		ConfigName(dbSectionName, "SSLMode").
+		ShortDesc("Database SSL mode").
+		Default("prefer").
+		Register()
+
+	reg.CreateStringField(dbTLSCaFileFieldName).
+		ArgName("db-tls-ca-file").
+		EnvVar("DB_TLS_CA_FILE").
+		ConfigName(dbSectionName, "TLSCaFile").
+		ShortDesc("Database TLS CA certificate file").
+		Register()
+
+	reg.CreateStringField(dbTLSCertFileFieldName).
+		ArgName("db-tls-cert-file").
+		EnvVar("DB_TLS_CERT_FILE").
+		ConfigName(dbSectionName, "TLSCertFile").
+		ShortDesc("Database TLS client certificate file").
+		Register()
+
+	reg.CreateStringField(dbTLSKeyFileFieldName).
+		ArgName("db-tls-key-file").
+		EnvVar("DB_TLS_KEY_FILE").
+		ConfigName(dbSectionName, "TLSKeyFile").
+		ShortDesc("Database TLS client key file").
+		Register()
+
+	// ex. 10s
+	reg.CreateStringField(connectTimeoutFieldName).
+		ArgName("db-connect-timeout").
+		ConfigName(dbSectionName, "ConnectTimeout").
+		ShortDesc("Database connect timeout").
+		Default("10s").
+		Register()
+
+	// no statement timeout if not set
+	reg.CreateStringField(statementTimeoutFieldName).
+		ArgName("db-statement-timeout").
+		ConfigName(dbSectionName, "StatementTimeout").
+		ShortDesc("Database statement timeout").
+		Register()
+
+	reg.CreateStringField(applicationNameFieldName).
+		ArgName("db-application-name").
+		EnvVar("DB_APPLICATION_NAME").
+		ConfigName(dbSectionName, "ApplicationName").
+		ShortDesc("Application name reported to the database").
+		Register()
+
 	// max idle connections
 	reg.CreateUintField(maxIdleConnectionsFieldName).
 		ArgName("max-idle-connections").
@@ -87,6 +216,109 @@ func RegisterConfig(reg app.FieldRegistry) {
 		ShortDesc("Max number of open database connections").
 		Default(20).
 		Register()
+
+	// min open connections
+	reg.CreateUintField(minConnectionsFieldName).
+		ArgName("min-connections").
+		ConfigName(dbSectionName, "MinConnections").
+		ShortDesc("Min number of open database connections").
+		Default(0).
+		Register()
+
+	reg.CreateStringField(maxConnLifetimeFieldName).
+		ArgName("db-max-conn-lifetime").
+		ConfigName(dbSectionName, "MaxConnLifetime").
+		ShortDesc("Max lifetime of a database connection").
+		Default("1h").
+		Register()
+
+	reg.CreateStringField(maxConnIdleTimeFieldName).
+		ArgName("db-max-conn-idle-time").
+		ConfigName(dbSectionName, "MaxConnIdleTime").
+		ShortDesc("Max time a database connection can be idle").
+		Default("30m").
+		Register()
+
+	reg.CreateStringField(healthCheckPeriodFieldName).
+		ArgName("db-health-check-period").
+		ConfigName(dbSectionName, "HealthCheckPeriod").
+		ShortDesc("Interval between health checks of idle database connections").
+		Default("1m").
+		Register()
+
+	// comma separated list of read replica hosts, optionally including the port
+	// ex. replica1:5432,replica2:5432
+	reg.CreateStringField(replicaHostsFieldName).
+		ArgName("db-replica-hosts").
+		EnvVar("DB_REPLICA_HOSTS").
+		ConfigName(dbSectionName, "ReplicaHosts").
+		ShortDesc("Database read replica hosts").
+		Register()
+
+	// round-robin or least-connections
+	reg.CreateStringField(replicaBalancingFieldName).
+		ArgName("db-replica-balancing").
+		ConfigName(dbSectionName, "ReplicaBalancing").
+		ShortDesc("Read replica balancing strategy").
+		Default(string(RoundRobin)).
+		Register()
+
+	reg.CreateUintField(replicaFailureThresholdFieldName).
+		ArgName("db-replica-failure-threshold").
+		ConfigName(dbSectionName, "ReplicaFailureThreshold").
+		ShortDesc("Consecutive failures after which a read replica is ejected").
+		Default(3).
+		Register()
+
+	reg.CreateStringField(replicaEjectionTimeFieldName).
+		ArgName("db-replica-ejection-time").
+		ConfigName(dbSectionName, "ReplicaEjectionTime").
+		ShortDesc("Time an ejected read replica receives no reads").
+		Default("30s").
+		Register()
+
+	// max number of times a transaction is executed when it conflicts with concurrent transactions. Conflicts
+	// are not retried by default
+	reg.CreateUintField(txMaxAttemptsFieldName).
+		ArgName("tx-max-attempts").
+		EnvVar("DB_TX_MAX_ATTEMPTS").
+		ConfigName(dbSectionName, "TxMaxAttempts").
+		ShortDesc("Max attempts of a conflicting transaction").
+		Default(1).
+		Register()
+
+	// ex. 50ms
+	reg.CreateStringField(txRetryInitialBackoffFieldName).
+		ArgName("tx-retry-initial-backoff").
+		ConfigName(dbSectionName, "TxRetryInitialBackoff").
+		ShortDesc("Initial backoff before retrying a conflicting transaction").
+		Default("50ms").
+		Register()
+
+	reg.CreateStringField(txRetryMaxBackoffFieldName).
+		ArgName("tx-retry-max-backoff").
+		ConfigName(dbSectionName, "TxRetryMaxBackoff").
+		ShortDesc("Max backoff before retrying a conflicting transaction").
+		Default("1s").
+		Register()
+
+	// queries taking longer are logged as slow, slow queries are not logged if not set
+	// ex. 500ms
+	reg.CreateStringField(slowQueryThresholdFieldName).
+		ArgName("db-slow-query-threshold").
+		EnvVar("DB_SLOW_QUERY_THRESHOLD").
+		ConfigName(dbSectionName, "SlowQueryThreshold").
+		ShortDesc("Duration after which a query is logged as slow").
+		Register()
+
+	// ignored under the production profile
+	reg.CreateBooleanField(explainSlowQueriesFieldName).
+		ArgName("db-explain-slow-queries").
+		EnvVar("DB_EXPLAIN_SLOW_QUERIES").
+		ConfigName(dbSectionName, "ExplainSlowQueries").
+		ShortDesc("Log the EXPLAIN ANALYZE plan of slow queries (non production profiles only)").
+		Default(false).
+		Register()
 }
 
 // NewDbConfig creates a DbConfig from the given parsed app.Configuration
@@ -117,6 +349,46 @@ func NewDbConfig(cfg app.Configuration) (*DbConfig, app.Error) {
 		return nil, err
 	}
 
+	dbPort, err := cfg.GetUintValue(dbPortFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	sslMode, err := cfg.GetStringValue(dbSSLModeFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCaFile, err := cfg.GetStringValue(dbTLSCaFileFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCertFile, err := cfg.GetStringValue(dbTLSCertFileFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsKeyFile, err := cfg.GetStringValue(dbTLSKeyFileFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	connectTimeout, err := cfg.GetDurationValue(connectTimeoutFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	statementTimeout, err := cfg.GetDurationValue(statementTimeoutFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	applicationName, err := cfg.GetStringValue(applicationNameFieldName)
+	if err != nil {
+		return nil, err
+	}
+
 	maxIdleConnections, err := cfg.GetUintValue(maxIdleConnectionsFieldName)
 	if err != nil {
 		return nil, err
@@ -127,13 +399,121 @@ func NewDbConfig(cfg app.Configuration) (*DbConfig, app.Error) {
 		return nil, err
 	}
 
+	minConnections, err := cfg.GetUintValue(minConnectionsFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConnLifetime, err := cfg.GetDurationValue(maxConnLifetimeFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConnIdleTime, err := cfg.GetDurationValue(maxConnIdleTimeFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	healthCheckPeriod, err := cfg.GetDurationValue(healthCheckPeriodFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	rawReplicaHosts, err := cfg.GetStringValue(replicaHostsFieldName)
+	if err != nil {
+		return nil, err
+	}
+	var replicaHosts []string
+	for _, h := range strings.Split(*rawReplicaHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			replicaHosts = append(replicaHosts, h)
+		}
+	}
+
+	replicaBalancing, err := cfg.GetStringValue(replicaBalancingFieldName)
+	if err != nil {
+		return nil, err
+	}
+	switch ReplicaBalancing(*replicaBalancing) {
+	case RoundRobin, LeastConnections:
+	default:
+		return nil, app.BuildSysConfigError().
+			Str("field", replicaBalancingFieldName).
+			Str("value", *replicaBalancing).
+			Msg("Invalid read replica balancing strategy")
+	}
+
+	replicaFailureThreshold, err := cfg.GetUintValue(replicaFailureThresholdFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaEjectionTime, err := cfg.GetDurationValue(replicaEjectionTimeFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	txMaxAttempts, err := cfg.GetUintValue(txMaxAttemptsFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	txRetryInitialBackoff, err := cfg.GetDurationValue(txRetryInitialBackoffFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	txRetryMaxBackoff, err := cfg.GetDurationValue(txRetryMaxBackoffFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	slowQueryThreshold, err := cfg.GetDurationValue(slowQueryThresholdFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	explainSlowQueries, err := cfg.GetBoolValue(explainSlowQueriesFieldName)
+	if err != nil {
+		return nil, err
+	}
+
 	return &DbConfig{
 		DbName:             *dbName,
 		Host:               *dbHost,
+		Port:               *dbPort,
 		Schema:             *dbSchema,
 		User:               *dbUser,
 		Password:           *dbPassword,
+		SSLMode:            *sslMode,
+		TLSCaFile:          *tlsCaFile,
+		TLSCertFile:        *tlsCertFile,
+		TLSKeyFile:         *tlsKeyFile,
+		ConnectTimeout:     *connectTimeout,
+		StatementTimeout:   *statementTimeout,
+		ApplicationName:    *applicationName,
 		MaxIdleConnections: *maxIdleConnections,
 		MaxOpenConnections: *maxOpenConnections,
+		MinConnections:     *minConnections,
+		MaxConnLifetime:    *maxConnLifetime,
+		MaxConnIdleTime:    *maxConnIdleTime,
+		HealthCheckPeriod:  *healthCheckPeriod,
+
+		ReplicaHosts:            replicaHosts,
+		ReplicaBalancing:        ReplicaBalancing(*replicaBalancing),
+		ReplicaFailureThreshold: *replicaFailureThreshold,
+		ReplicaEjectionTime:     *replicaEjectionTime,
+		TxRetry: RetryPolicy{
+			MaxAttempts: *txMaxAttempts,
+			Backoff: pinion.Backoff{
+				Initial:    *txRetryInitialBackoff,
+				Max:        *txRetryMaxBackoff,
+				Multiplier: 2,
+			},
+		},
+		SlowQuery: SlowQueryPolicy{
+			Threshold: *slowQueryThreshold,
+			Explain:   *explainSlowQueries,
+		},
 	}, nil
 }
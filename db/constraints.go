@@ -0,0 +1,32 @@
+package db
+
+import (
+	"sync"
+)
+
+var constraintMessages sync.Map
+
+// RegisterConstraintMessage sets the message of the errors caused by violations of the named constraint,
+// replacing the generic message of the database driver with one that can be shown to users:
+//
+//	db.RegisterConstraintMessage("users_email_key", "A user with this email address already exists")
+//
+// The returned function unregisters the message
+func RegisterConstraintMessage(constraint string, message string) (unregister func()) {
+	constraintMessages.Store(constraint, message)
+	return func() {
+		constraintMessages.Delete(constraint)
+	}
+}
+
+// ConstraintMessage returns the message registered for the named constraint, if any
+func ConstraintMessage(constraint string) (string, bool) {
+	if constraint == "" {
+		return "", false
+	}
+	message, found := constraintMessages.Load(constraint)
+	if !found {
+		return "", false
+	}
+	return message.(string), true
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+)
+
+type handleKey struct{}
+type primaryKey struct{}
+type statementNameKey struct{}
+
+// txContext is the active transaction stored in a context
+type txContext struct {
+	handle  DatabaseHandle
+	options *TransactionOptions
+}
+
+// TxContextFn is a unit of work that finds the active transaction in its context with HandleFrom
+type TxContextFn func(ctx context.Context) app.Error
+
+// WithHandle returns a copy of the context carrying the handle of the active transaction, which was started
+// with the given options (TxWriteOptions if nil)
+func WithHandle(ctx context.Context, handle DatabaseHandle, options *TransactionOptions) context.Context {
+	if options == nil {
+		options = TxWriteOptions
+	}
+	return context.WithValue(ctx, handleKey{}, &txContext{handle: handle, options: options})
+}
+
+// HandleFrom returns the handle of the transaction active in the context, if any
+func HandleFrom(ctx context.Context) (DatabaseHandle, bool) {
+	tc, ok := ctx.Value(handleKey{}).(*txContext)
+	if !ok {
+		return nil, false
+	}
+	return tc.handle, true
+}
+
+// InTx executes the function in the transaction active in the context, or in a new transaction of the
+// database started with the given options (TxWriteOptions if nil) that is stored in the function's
+// context. Joining an active transaction fails with an IllegalStateError if it can not honor the options,
+// such as a write within a read only transaction. DB implementations delegate DB.InTx to it
+func InTx(ctx context.Context, database DB, options *TransactionOptions, fn TxContextFn) app.Error {
+	if options == nil {
+		options = TxWriteOptions
+	}
+
+	if tc, ok := ctx.Value(handleKey{}).(*txContext); ok {
+		if err := checkCompatible(tc.options, options); err != nil {
+			return err
+		}
+		return fn(ctx)
+	}
+
+	return database.Transaction(ctx, options, func(handle DatabaseHandle) app.Error {
+		return fn(WithHandle(ctx, handle, options))
+	})
+}
+
+// isoLevelStrength orders the isolation levels from weakest to strongest
+var isoLevelStrength = map[IsoLevel]int{
+	ReadUncommitted: 0,
+	ReadCommitted:   1,
+	RepeatableRead:  2,
+	Serializable:    3,
+}
+
+// checkCompatible makes sure that the active transaction provides the guarantees of the requested options
+func checkCompatible(active *TransactionOptions, requested *TransactionOptions) app.Error {
+	if active.AccessMode == ReadOnly && requested.AccessMode == ReadWrite {
+		return app.BuildIllegalStateError().
+			Str("activeAccessMode", string(active.AccessMode)).
+			Str("requestedAccessMode", string(requested.AccessMode)).
+			Msg("Can not join a read only transaction for writing")
+	}
+	if isoLevelStrength[requested.IsoLevel] > isoLevelStrength[active.IsoLevel] {
+		return app.BuildIllegalStateError().
+			Str("activeIsoLevel", string(active.IsoLevel)).
+			Str("requestedIsoLevel", string(requested.IsoLevel)).
+			Msg("Can not join a transaction with a weaker isolation level")
+	}
+	return nil
+}
+
+// WithPrimary returns a copy of the context whose read transactions are executed on the primary database
+// instead of a read replica, so a request can read its own writes
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// PrimaryRequested returns true if the context's reads must be executed on the primary database
+func PrimaryRequested(ctx context.Context) bool {
+	pinned, _ := ctx.Value(primaryKey{}).(bool)
+	return pinned
+}
+
+// WithStatementName returns a copy of the context carrying the name of the statement being executed, so that
+// SqlHandle implementations can identify named statements (ex. QueryStatement.Name)
+func WithStatementName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, statementNameKey{}, name)
+}
+
+// StatementNameFrom returns the name of the statement being executed in the context, or an empty string
+func StatementNameFrom(ctx context.Context) string {
+	name, _ := ctx.Value(statementNameKey{}).(string)
+	return name
+}
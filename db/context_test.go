@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fakeDatabaseHandle struct {
+	DatabaseHandle
+}
+
+// fakeDB counts the transactions it starts
+type fakeDB struct {
+	DB
+	transactions int
+	options      *TransactionOptions
+}
+
+func (f *fakeDB) Transaction(_ context.Context, txOptions *TransactionOptions, tnFn TransactionFn) app.Error {
+	f.transactions++
+	f.options = txOptions
+	return tnFn(&fakeDatabaseHandle{})
+}
+
+// test that a nested InTx joins the transaction started by the outer one
+func TestInTxJoins(t *testing.T) {
+	database := &fakeDB{}
+	var outer, inner DatabaseHandle
+
+	err := InTx(context.Background(), database, nil, func(ctx context.Context) app.Error {
+		outer, _ = HandleFrom(ctx)
+		return InTx(ctx, database, TxReadOptions, func(ctx context.Context) app.Error {
+			inner, _ = HandleFrom(ctx)
+			return nil
+		})
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, database.transactions)
+	assert.Equal(t, TxWriteOptions, database.options)
+	assert.NotNil(t, outer)
+	assert.Same(t, outer, inner)
+}
+
+// test that incompatible options can not join the active transaction
+func TestInTxIncompatible(t *testing.T) {
+	readOnly := &TransactionOptions{AccessMode: ReadOnly, IsoLevel: RepeatableRead, DeferrableMode: Deferrable}
+	ctx := WithHandle(context.Background(), &fakeDatabaseHandle{}, readOnly)
+
+	err := InTx(ctx, &fakeDB{}, TxWriteOptions, func(context.Context) app.Error { return nil })
+	if assert.NotNil(t, err) {
+		assert.Equal(t, app.IllegalStateErrorCode, err.Code())
+	}
+
+	err = InTx(ctx, &fakeDB{}, &TransactionOptions{AccessMode: ReadOnly, IsoLevel: Serializable},
+		func(context.Context) app.Error { return nil })
+	if assert.NotNil(t, err) {
+		assert.Equal(t, app.IllegalStateErrorCode, err.Code())
+		assert.Equal(t, string(Serializable), err.GetMetadataValue("requestedIsoLevel"))
+	}
+}
+
+// test that a handle stored without options is joined as a read write transaction
+func TestWithHandleDefaultOptions(t *testing.T) {
+	database := &fakeDB{}
+	ctx := WithHandle(context.Background(), &fakeDatabaseHandle{}, nil)
+
+	err := InTx(ctx, database, TxWriteOptions, func(context.Context) app.Error { return nil })
+	assert.Nil(t, err)
+	assert.Equal(t, 0, database.transactions)
+
+	err = InTx(ctx, database, TxSerializableWriteOptions, func(context.Context) app.Error { return nil })
+	if assert.NotNil(t, err) {
+		assert.Equal(t, app.IllegalStateErrorCode, err.Code())
+	}
+}
+
+// test that there is no handle in a context without a transaction
+func TestHandleFromEmpty(t *testing.T) {
+	_, ok := HandleFrom(context.Background())
+	assert.False(t, ok)
+}
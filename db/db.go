@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"github.com/sterrasi/pinion/app"
+	"io/fs"
 )
 
 type Scanner interface {
@@ -13,6 +14,15 @@ type Scanner interface {
 	Scan(dest ...any) app.Error
 }
 
+// ColumnScanner is a Scanner that knows the names of the columns of the current result. It is used by
+// StructMapper to map the columns to struct fields
+type ColumnScanner interface {
+	Scanner
+
+	// Columns returns the names of the result columns in select list order
+	Columns() []string
+}
+
 type InsertStatement struct {
 	SQL  string
 	Name string
@@ -52,8 +62,13 @@ type RowIterator interface {
 	Values() ([]any, app.Error)
 }
 
+// Row is the result of a single row query. Scanning the row closes it, so Close only has to be called if the
+// row may not be scanned (ex. a mapper failing before it calls Scan)
 type Row interface {
 	Scanner
+
+	// Close releases the row and its connection. It may be called more than once
+	Close()
 }
 
 type SqlHandle interface {
@@ -65,16 +80,66 @@ type SqlHandle interface {
 type DatabaseHandle interface {
 	SqlHandle
 	ExecFile(filePath string) app.Error
+	ExecFS(ctx context.Context, fsys fs.FS, filePath string) app.Error
 	Insert(ctx context.Context, stmt *InsertStatement, args ...any) app.Error
+
+	// BulkInsert inserts the rows of the source into the columns of the (optionally schema qualified) table
+	// using the fastest mechanism of the database (ex. postgres COPY) and returns the number of rows inserted
+	BulkInsert(ctx context.Context, table string, columns []string, rows RowSource) (int64, app.Error)
+
+	// SendBatch sends the queued statements of the batch in a single round trip and sets their results. The
+	// first statement error is returned
+	SendBatch(ctx context.Context, batch *Batch) app.Error
+
+	// Savepoint executes the function in a nested unit of work of the current transaction. If the function
+	// returns an error then only its changes are rolled back and the outer transaction can continue,
+	// otherwise its changes become part of the outer transaction. Savepoints can be nested
+	Savepoint(ctx context.Context, fn TransactionFn) app.Error
+}
+
+// Conn is a connection dedicated to the caller until it is released, for session level operations such as
+// LISTEN or session advisory locks. Statements are executed in autocommit mode
+type Conn interface {
+	SqlHandle
+
+	// WaitForNotification blocks until a notification is received on one of the channels the connection
+	// listens to (see the LISTEN statement), or until the context is done
+	WaitForNotification(ctx context.Context) (*Notification, app.Error)
+
+	// Release returns the connection to the pool
+	Release()
+}
+
+// Notification is a message sent with NOTIFY (or pg_notify) on a channel
+type Notification struct {
+	// PID is the process id of the sending session
+	PID     uint32
+	Channel string
+	Payload string
 }
 
 type TransactionFn func(handle DatabaseHandle) app.Error
 type DB interface {
+	// SqlHandle executes autocommit statements on a pooled connection, without the BEGIN and COMMIT round
+	// trips of a transaction
+	SqlHandle
+
 	Close()
+
+	// Acquire reserves a pooled connection for the caller. The Conn must be released when done
+	Acquire(ctx context.Context) (Conn, app.Error)
+	// ReadTransaction executes a read only transaction with TxReadOptions, which may run on a read replica
 	ReadTransaction(ctx context.Context, tnFn TransactionFn) app.Error
 	WriteTransaction(ctx context.Context, tnFn TransactionFn) app.Error
 	WriteSerializableTransaction(ctx context.Context, tnFn TransactionFn) app.Error
+	// Transaction executes a transaction with the given options. A transaction failing with a transaction
+	// conflict is executed again only if the Retry of the options, or the TxRetry of the DbConfig, allows more
+	// than one attempt (which it does not by default)
 	Transaction(ctx context.Context, txOptions *TransactionOptions, tnFn TransactionFn) app.Error
+
+	// InTx executes the function in the transaction found in the context, or starts a new one with the
+	// given options (see the InTx function)
+	InTx(ctx context.Context, txOptions *TransactionOptions, fn TxContextFn) app.Error
 }
 
 // TxWriteOptions Transaction options for DB.WriteTransaction
@@ -91,9 +156,11 @@ var TxSerializableWriteOptions = &TransactionOptions{
 	IsoLevel:       Serializable,
 }
 
-// TxReadOptions Transaction options for DB.WriteSerializableTransaction
+// TxReadOptions Transaction options for DB.ReadTransaction. Read transactions are read only so they can be
+// executed on a read replica. Before read replica support they were read write: statements writing in a
+// ReadTransaction now fail with an app.IllegalStateErrorCode error and must use WriteTransaction instead
 var TxReadOptions = &TransactionOptions{
-	AccessMode:     ReadWrite,
+	AccessMode:     ReadOnly,
 	DeferrableMode: Deferrable,     // deffer constraint checks
 	IsoLevel:       RepeatableRead, // removes non-repeatable reads
 }
@@ -102,3 +169,8 @@ var TxReadOptions = &TransactionOptions{
 type ExistsValue struct {
 	Exists bool
 }
+
+// ExistsMapper maps a single boolean column into an ExistsValue
+func ExistsMapper(scanner Scanner, model *ExistsValue) app.Error {
+	return scanner.Scan(&model.Exists)
+}
@@ -1,6 +1,9 @@
 package db
 
-import "github.com/sterrasi/pinion/app"
+import (
+	"github.com/sterrasi/pinion/app"
+	"strconv"
+)
 
 // DatabaseOperationErrorCode signifies a database level operation that failed
 const DatabaseOperationErrorCode app.ErrorCode = 10
@@ -21,3 +24,47 @@ func BuildSqlError() *app.ErrorBuilder {
 func NewSQLError(format string, args ...any) app.Error {
 	return app.BuildValidationError().Msgf(format, args...)
 }
+
+// TransactionConflictErrorCode signifies a transaction that failed due to a serialization failure or a
+// deadlock with a concurrent transaction. Executing the transaction again may succeed
+const TransactionConflictErrorCode app.ErrorCode = 11
+
+func BuildTransactionConflictError() *app.ErrorBuilder {
+	return app.NewErrorBuilder(TransactionConflictErrorCode, "transaction-conflict")
+}
+
+// IsTransactionConflict returns true if the error is a transaction conflict that can be retried
+func IsTransactionConflict(err app.Error) bool {
+	return err != nil && err.Code() == TransactionConflictErrorCode
+}
+
+// TransactionRetriesExhaustedErrorCode signifies a transaction that kept conflicting with concurrent
+// transactions until its RetryPolicy ran out of attempts
+const TransactionRetriesExhaustedErrorCode app.ErrorCode = 12
+
+func BuildTransactionRetriesExhaustedError(attempts uint) *app.ErrorBuilder {
+	return app.NewErrorBuilder(TransactionRetriesExhaustedErrorCode, "transaction-retries-exhausted").
+		Str("attempts", strconv.FormatUint(uint64(attempts), 10))
+}
+
+// TimeoutErrorCode signifies a statement that was canceled because it exceeded a timeout (ex. the statement
+// or lock timeout, or the deadline of its context)
+const TimeoutErrorCode app.ErrorCode = 13
+
+func BuildTimeoutError() *app.ErrorBuilder {
+	return app.NewErrorBuilder(TimeoutErrorCode, "timeout")
+}
+
+// IsTimeout returns true if the error is a statement timeout
+func IsTimeout(err app.Error) bool {
+	return err != nil && err.Code() == TimeoutErrorCode
+}
+
+// RetryableKey is the metadata key that database drivers set to "true" on errors that may not occur again if
+// the statement or transaction is executed again (ex. a connection failure or a lock timeout)
+const RetryableKey = "retryable"
+
+// IsRetryable returns true if executing the failed statement or transaction again may succeed
+func IsRetryable(err app.Error) bool {
+	return err != nil && (IsTransactionConflict(err) || err.GetMetadataValue(RetryableKey) == "true")
+}
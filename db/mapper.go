@@ -0,0 +1,217 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/sterrasi/pinion/app"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// MapperTagName is the struct tag naming the column a field is mapped to
+const MapperTagName = "db"
+
+var sqlScannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// structPlans caches the structPlan of every mapped struct type
+var structPlans sync.Map
+
+// fieldPlan locates a mapped field. The path is the sequence of field indexes from the root struct, where
+// embedded struct pointers along the way are allocated on demand
+type fieldPlan struct {
+	column string
+	path   []int
+}
+
+// structPlan maps the column names of a struct type to its fields
+type structPlan struct {
+	fields  []*fieldPlan
+	columns map[string]*fieldPlan
+	err     app.Error
+}
+
+// StructMapper returns a MapperFn that scans the columns of a row into the fields of M by name, making the
+// mapping independent of the select list order:
+//
+//	type User struct {
+//		ID        int64      `db:"id"`
+//		Email     string     `db:"email"`
+//		DeletedAt *time.Time `db:"deleted_at"` // NULL scans as nil
+//		Audit                // fields of embedded structs are promoted
+//		Internal  string     `db:"-"`          // never mapped
+//	}
+//
+// Untagged exported fields are mapped to the snake_case form of their name. Fields of embedded structs
+// (and embedded struct pointers, which are allocated when one of their columns is scanned) are promoted
+// unless the embedded field is tagged or implements sql.Scanner, in which case it is mapped as a single
+// column. Any value the driver can scan into works as a field type, including pointers for nullable
+// columns and types implementing sql.Scanner.
+//
+// The Scanner must be a ColumnScanner. It is an error for the result to contain a column that does not map
+// to a field, while fields without a column are left untouched
+func StructMapper[M any]() MapperFn[M] {
+	plan := planFor(reflect.TypeOf((*M)(nil)).Elem())
+
+	return func(scanner Scanner, model *M) app.Error {
+		if plan.err != nil {
+			return plan.err
+		}
+		cs, ok := scanner.(ColumnScanner)
+		if !ok {
+			return app.BuildIllegalStateError().
+				Msgf("StructMapper requires a ColumnScanner but got %T", scanner)
+		}
+
+		columns := cs.Columns()
+		root := reflect.ValueOf(model).Elem()
+		dest := make([]any, len(columns))
+		for i, column := range columns {
+			field, found := plan.columns[column]
+			if !found {
+				return app.BuildIllegalStateError().
+					Str("column", column).
+					Str("type", root.Type().String()).
+					Msg("Result column is not mapped to a struct field")
+			}
+			dest[i] = fieldByPath(root, field.path).Addr().Interface()
+		}
+		return scanner.Scan(dest...)
+	}
+}
+
+// StructColumns returns the column names mapped by StructMapper for M in field order, to be used as the
+// select list of a query
+func StructColumns[M any]() ([]string, app.Error) {
+	plan := planFor(reflect.TypeOf((*M)(nil)).Elem())
+	if plan.err != nil {
+		return nil, plan.err
+	}
+	result := make([]string, len(plan.fields))
+	for i, f := range plan.fields {
+		result[i] = f.column
+	}
+	return result, nil
+}
+
+// planFor returns the cached structPlan of the type
+func planFor(t reflect.Type) *structPlan {
+	if cached, found := structPlans.Load(t); found {
+		return cached.(*structPlan)
+	}
+
+	plan := &structPlan{columns: make(map[string]*fieldPlan)}
+	if t.Kind() != reflect.Struct {
+		plan.err = app.BuildIllegalArgumentError().
+			Str("type", t.String()).
+			Msg("StructMapper can only map to struct types")
+	} else {
+		plan.err = plan.add(t, nil)
+	}
+
+	cached, _ := structPlans.LoadOrStore(t, plan)
+	return cached.(*structPlan)
+}
+
+// add adds the mapped fields of the struct type, whose position within the root struct is the given path
+func (p *structPlan) add(t reflect.Type, path []int) app.Error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup(MapperTagName)
+		if tag == "-" {
+			continue
+		}
+		fieldPath := append(append([]int{}, path...), i)
+
+		if sf.Anonymous && !tagged && isPromotable(sf.Type) {
+			st := sf.Type
+			if st.Kind() == reflect.Pointer {
+				if !sf.IsExported() {
+					// the pointer can not be allocated through reflection
+					continue
+				}
+				st = st.Elem()
+			}
+			if err := p.add(st, fieldPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		column := tag
+		if column == "" {
+			column = toSnakeCase(sf.Name)
+		}
+		field := &fieldPlan{column: column, path: fieldPath}
+		existing, found := p.columns[column]
+		switch {
+		case !found:
+			p.fields = append(p.fields, field)
+		case len(existing.path) == len(fieldPath):
+			return app.BuildIllegalArgumentError().
+				Str("column", column).
+				Str("type", t.String()).
+				Msg("Column is mapped to more than one struct field")
+		case len(existing.path) < len(fieldPath):
+			// shallower fields hide promoted ones, as they do in Go
+			continue
+		default:
+			p.replace(field)
+		}
+		p.columns[column] = field
+	}
+	return nil
+}
+
+// replace swaps the field mapped to the same column for the given one
+func (p *structPlan) replace(field *fieldPlan) {
+	for i, f := range p.fields {
+		if f.column == field.column {
+			p.fields[i] = field
+			return
+		}
+	}
+}
+
+// isPromotable returns true if the fields of the embedded type are mapped individually
+func isPromotable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(sqlScannerType)
+}
+
+// fieldByPath returns the field at the path, allocating nil embedded struct pointers along the way
+func fieldByPath(v reflect.Value, path []int) reflect.Value {
+	for i, index := range path {
+		v = v.Field(index)
+		if i < len(path)-1 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+	}
+	return v
+}
+
+// toSnakeCase converts a Go field name to snake case (ex. "UserID" -> "user_id")
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
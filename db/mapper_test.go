@@ -0,0 +1,163 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRow is a ColumnScanner over a single row of values
+type fakeRow struct {
+	columns []string
+	values  []any
+	err     app.Error
+	// source is the result the row was read from, which is closed with the row
+	source *fakeRows
+}
+
+func (r *fakeRow) Close() {
+	if r.source != nil {
+		r.source.Close()
+	}
+}
+
+func (r *fakeRow) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRow) Scan(dest ...any) app.Error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(dest) != len(r.values) {
+		return app.NewIllegalArgumentError("expected %d destinations", len(r.values))
+	}
+	for i, d := range dest {
+		if s, ok := d.(sql.Scanner); ok {
+			if err := s.Scan(r.values[i]); err != nil {
+				return app.BuildIllegalArgumentError().Cause(err).Msg("scan failed")
+			}
+			continue
+		}
+		target := reflect.ValueOf(d).Elem()
+		if r.values[i] == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		value := reflect.ValueOf(r.values[i])
+		if target.Kind() == reflect.Pointer {
+			ptr := reflect.New(target.Type().Elem())
+			ptr.Elem().Set(value)
+			value = ptr
+		}
+		target.Set(value)
+	}
+	return nil
+}
+
+type upperString string
+
+func (u *upperString) Scan(src any) error {
+	*u = upperString(strings.ToUpper(fmt.Sprint(src)))
+	return nil
+}
+
+type audit struct {
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedBy *string   `db:"updated_by"`
+}
+
+type Owner struct {
+	OwnerID int64
+}
+
+type account struct {
+	ID          int64       `db:"id"`
+	Email       string      `db:"email"`
+	Code        upperString `db:"code"`
+	DeletedAt   *time.Time  `db:"deleted_at"`
+	Internal    string      `db:"-"`
+	DisplayName string
+	audit
+	*Owner
+}
+
+// test that columns are mapped by name regardless of their order
+func TestStructMapper(t *testing.T) {
+	now := time.Now()
+	row := &fakeRow{
+		columns: []string{"code", "created_at", "email", "id", "updated_by", "deleted_at", "display_name",
+			"owner_id"},
+		values: []any{"abc", now, "a@b.c", int64(7), "bob", nil, "Al", int64(3)},
+	}
+
+	model := new(account)
+	err := StructMapper[account]()(row, model)
+	if err != nil {
+		t.Fatalf("mapping failed: %s", err.Error())
+	}
+	assert.Equal(t, int64(7), model.ID)
+	assert.Equal(t, "a@b.c", model.Email)
+	assert.Equal(t, upperString("ABC"), model.Code)
+	assert.Nil(t, model.DeletedAt)
+	assert.Equal(t, "Al", model.DisplayName)
+	assert.Equal(t, now, model.CreatedAt)
+	assert.Equal(t, "bob", *model.UpdatedBy)
+	assert.Equal(t, int64(3), model.OwnerID)
+}
+
+// test that embedded struct pointers are only allocated when one of their columns is selected
+func TestStructMapperPartialColumns(t *testing.T) {
+	row := &fakeRow{columns: []string{"id"}, values: []any{int64(1)}}
+
+	model := new(account)
+	err := StructMapper[account]()(row, model)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), model.ID)
+	assert.Nil(t, model.Owner)
+}
+
+// test that a result column without a field is an error
+func TestStructMapperUnknownColumn(t *testing.T) {
+	row := &fakeRow{columns: []string{"id", "nickname"}, values: []any{int64(1), "x"}}
+
+	err := StructMapper[account]()(row, new(account))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, app.IllegalStateErrorCode, err.Code())
+		assert.Equal(t, "nickname", err.GetMetadata()["column"])
+	}
+}
+
+type ambiguous struct {
+	Name  string `db:"name"`
+	Title string `db:"name"`
+}
+
+// test that two fields mapped to the same column are an error
+func TestStructMapperAmbiguousColumn(t *testing.T) {
+	_, err := StructColumns[ambiguous]()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, app.IllegalArgumentError, err.Code())
+	}
+}
+
+// test the columns of a struct in field order
+func TestStructColumns(t *testing.T) {
+	columns, err := StructColumns[account]()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "email", "code", "deleted_at", "display_name", "created_at", "updated_by",
+		"owner_id"}, columns)
+}
+
+// test the snake case conversion of field names
+func TestToSnakeCase(t *testing.T) {
+	assert.Equal(t, "user_id", toSnakeCase("UserID"))
+	assert.Equal(t, "http_server", toSnakeCase("HTTPServer"))
+	assert.Equal(t, "name", toSnakeCase("Name"))
+	assert.Equal(t, "created_at", toSnakeCase("CreatedAt"))
+}
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"github.com/sterrasi/pinion/metrics"
+	"time"
+)
+
+var statementDuration = metrics.Default.NewHistogramVec("pinion_db_statement_duration_seconds",
+	"Duration of named database statements", nil, "statement")
+
+// ObserveStatement records the duration of the named statement that started at the given time. It is called
+// by the QueryStatement methods and by database drivers for the statements they name (ex. InsertStatement)
+func ObserveStatement(name string, start time.Time) {
+	statementDuration.With(name).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"strings"
+)
+
+// NamedArgs are statement arguments referenced by name (":name") instead of position. A slice value is bound
+// as a single array argument, so a list of values is matched with "= ANY(:ids)" rather than "IN (:ids)"
+type NamedArgs map[string]any
+
+// NamedSQL is a statement whose named parameters were rewritten to the placeholders of a Dialect
+type NamedSQL struct {
+	// SQL is the rewritten statement
+	SQL string
+	// Names are the parameter names of the statement arguments in order
+	Names []string
+}
+
+// ParseNamed rewrites the named parameters (":name") of the statement to the placeholders of the dialect.
+// Parameters are not recognized within string literals, quoted identifiers, dollar quoted strings, comments
+// and type casts ("::"). With numbered placeholders a parameter that is used several times is bound once
+func ParseNamed(dialect Dialect, sql string) (*NamedSQL, app.Error) {
+	if dialect == nil {
+		dialect = Postgres
+	}
+	// a dialect repeating the same placeholder binds arguments by occurrence
+	byOccurrence := dialect.Placeholder(1) == dialect.Placeholder(2)
+
+	var out strings.Builder
+	out.Grow(len(sql))
+	named := &NamedSQL{}
+	numbers := make(map[string]int)
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := quoteEnd(sql, i)
+			if end < 0 {
+				return nil, namedSyntaxError(sql, "unterminated quoted string or identifier")
+			}
+			out.WriteString(sql[i:end])
+			i = end
+
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			out.WriteString(sql[i : i+end])
+			i += end
+
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := blockCommentEnd(sql, i)
+			if end < 0 {
+				return nil, namedSyntaxError(sql, "unterminated comment")
+			}
+			out.WriteString(sql[i:end])
+			i = end
+
+		case c == '$':
+			end := dollarQuoteEnd(sql, i)
+			if end < 0 {
+				return nil, namedSyntaxError(sql, "unterminated dollar quoted string")
+			}
+			out.WriteString(sql[i:end])
+			i = end
+
+		case c == ':' && i+1 < len(sql) && sql[i+1] == ':':
+			out.WriteString("::")
+			i += 2
+
+		case c == ':' && i+1 < len(sql) && isNameStart(sql[i+1]):
+			end := i + 1
+			for end < len(sql) && isNamePart(sql[end]) {
+				end++
+			}
+			name := sql[i+1 : end]
+			n, found := numbers[name]
+			if !found || byOccurrence {
+				named.Names = append(named.Names, name)
+				n = len(named.Names)
+				numbers[name] = n
+			}
+			out.WriteString(dialect.Placeholder(n))
+			i = end
+
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	named.SQL = out.String()
+	return named, nil
+}
+
+// Bind returns the arguments of the statement in placeholder order. Every parameter must have an argument
+func (n *NamedSQL) Bind(args NamedArgs) ([]any, app.Error) {
+	result := make([]any, len(n.Names))
+	for i, name := range n.Names {
+		value, found := args[name]
+		if !found {
+			return nil, app.BuildIllegalArgumentError().
+				Str("parameter", name).
+				Msgf("No argument for the named parameter '%s'", name)
+		}
+		result[i] = value
+	}
+	return result, nil
+}
+
+// BindNamed rewrites the named parameters of the statement to the placeholders of the dialect and returns the
+// arguments in placeholder order
+func BindNamed(dialect Dialect, sql string, args NamedArgs) (string, []any, app.Error) {
+	named, err := ParseNamed(dialect, sql)
+	if err != nil {
+		return "", nil, err
+	}
+	bound, err := named.Bind(args)
+	if err != nil {
+		return "", nil, err
+	}
+	return named.SQL, bound, nil
+}
+
+// quoteEnd returns the index after the quoted string or identifier starting at i, or -1 if it is not
+// terminated. A doubled quote is an escaped quote, and a backslash escapes the next character of an escape
+// string constant (E'...')
+func quoteEnd(sql string, i int) int {
+	quote := sql[i]
+	backslashEscapes := quote == '\'' && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') &&
+		(i == 1 || !isNamePart(sql[i-2]))
+
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case backslashEscapes && sql[j] == '\\':
+			j++
+		case sql[j] == quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// blockCommentEnd returns the index after the (possibly nested) block comment starting at i, or -1 if it is
+// not terminated
+func blockCommentEnd(sql string, i int) int {
+	depth := 0
+	for j := i; j+1 < len(sql); j++ {
+		switch {
+		case sql[j] == '/' && sql[j+1] == '*':
+			depth++
+			j++
+		case sql[j] == '*' && sql[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// dollarQuoteEnd returns the index after the dollar quoted string ($tag$...$tag$) starting at i, or after
+// the '$' if it does not start a dollar quoted string (ex. a "$1" placeholder). It returns -1 if the string
+// is not terminated
+func dollarQuoteEnd(sql string, i int) int {
+	j := i + 1
+	if j < len(sql) && isNameStart(sql[j]) {
+		for j < len(sql) && isNamePart(sql[j]) {
+			j++
+		}
+	}
+	if j >= len(sql) || sql[j] != '$' || (i > 0 && isNamePart(sql[i-1])) {
+		return i + 1
+	}
+
+	tag := sql[i : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return -1
+	}
+	return j + 1 + end + len(tag)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func namedSyntaxError(sql string, description string) app.Error {
+	return app.BuildIllegalArgumentError().
+		Str("sql", sql).
+		Msgf("Unable to parse named parameters: %s", description)
+}
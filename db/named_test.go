@@ -0,0 +1,55 @@
+package db
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test that named parameters are rewritten to numbered placeholders and bound in order
+func TestBindNamed(t *testing.T) {
+	sql, args, err := BindNamed(Postgres, "SELECT * FROM items WHERE owner = :owner AND id = ANY(:ids)",
+		NamedArgs{"ids": []int64{1, 2}, "owner": "a", "unused": true})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM items WHERE owner = $1 AND id = ANY($2)", sql)
+	assert.Equal(t, []any{"a", []int64{1, 2}}, args)
+}
+
+// test that a repeated name is bound once with numbered placeholders and by occurrence otherwise
+func TestParseNamedRepeated(t *testing.T) {
+	named, err := ParseNamed(Postgres, "UPDATE items SET a = :v, b = :v WHERE id = :id")
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE items SET a = $1, b = $1 WHERE id = $2", named.SQL)
+	assert.Equal(t, []string{"v", "id"}, named.Names)
+
+	named, err = ParseNamed(Question, "UPDATE items SET a = :v, b = :v WHERE id = :id")
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE items SET a = ?, b = ? WHERE id = ?", named.SQL)
+	assert.Equal(t, []string{"v", "v", "id"}, named.Names)
+}
+
+// test that literals, identifiers, comments, casts and dollar quoted strings are left untouched
+func TestParseNamedIgnored(t *testing.T) {
+	sql := "SELECT ':a', E'\\':b', \"c:d\", $$ :e $$, $tag$ :f $tag$, x::text -- :g\n" +
+		"/* :h /* :i */ */ FROM t WHERE y = :y"
+	named, err := ParseNamed(Postgres, sql)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"y"}, named.Names)
+	assert.Equal(t, sql[:len(sql)-2]+"$1", named.SQL)
+}
+
+// test that a missing argument is reported by name
+func TestBindNamedMissing(t *testing.T) {
+	_, _, err := BindNamed(Postgres, "SELECT * FROM t WHERE a = :a AND b = :b", NamedArgs{"a": 1})
+	assert.NotNil(t, err)
+	assert.Equal(t, app.IllegalArgumentError, err.Code())
+	assert.Equal(t, "b", err.GetMetadata()["parameter"])
+}
+
+// test that unterminated literals and comments are rejected
+func TestParseNamedUnterminated(t *testing.T) {
+	for _, sql := range []string{"SELECT 'a", "SELECT \"a", "SELECT /* a", "SELECT $x$ a"} {
+		_, err := ParseNamed(Postgres, sql)
+		assert.NotNil(t, err, sql)
+	}
+}
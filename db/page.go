@@ -0,0 +1,295 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/sterrasi/pinion/app"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CursorParamName is the metadata key of the ValidationError returned for an invalid cursor
+const CursorParamName = "cursor"
+
+// Page is one page of a paginated query
+type Page[M any] struct {
+	Items []*M
+	// NextCursor continues the query after this page. It is empty if this is the last page
+	NextCursor string
+}
+
+// CursorCodec encodes the position of a page into an opaque cursor signed with HMAC-SHA256, so clients can
+// not forge cursors to skip filters or probe the key space. A cursor is only valid for the query (scope) it
+// was issued for
+type CursorCodec struct {
+	key []byte
+}
+
+// NewCursorCodec creates a CursorCodec signing with the given secret key
+func NewCursorCodec(key []byte) (*CursorCodec, app.Error) {
+	if len(key) < 16 {
+		return nil, app.BuildSysConfigError().
+			Msg("The cursor signing key must be at least 16 bytes")
+	}
+	return &CursorCodec{key: append([]byte{}, key...)}, nil
+}
+
+// Encode returns a signed cursor for the given JSON encodable values
+func (c *CursorCodec) Encode(scope string, values ...any) (string, app.Error) {
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", app.BuildIllegalArgumentError().
+			Cause(err).
+			Str("scope", scope).
+			Msg("Unable to encode the cursor values")
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(scope, payload)), nil
+}
+
+// Decode verifies the cursor and decodes its values into the given pointers. A ValidationError is returned
+// if the cursor is malformed, was tampered with or was issued for another scope
+func (c *CursorCodec) Decode(scope string, cursor string, dest ...any) app.Error {
+	encoded, signature, found := strings.Cut(cursor, ".")
+	if !found {
+		return invalidCursor(scope, nil)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return invalidCursor(scope, err)
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return invalidCursor(scope, err)
+	}
+	if !hmac.Equal(mac, c.sign(scope, payload)) {
+		return invalidCursor(scope, nil)
+	}
+
+	var values []json.RawMessage
+	if err = json.Unmarshal(payload, &values); err != nil {
+		return invalidCursor(scope, err)
+	}
+	if len(values) != len(dest) {
+		return invalidCursor(scope, nil)
+	}
+	for i, v := range values {
+		decoder := json.NewDecoder(bytes.NewReader(v))
+		decoder.UseNumber()
+		if err = decoder.Decode(dest[i]); err != nil {
+			return invalidCursor(scope, err)
+		}
+	}
+	return nil
+}
+
+func (c *CursorCodec) sign(scope string, payload []byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	_, _ = h.Write([]byte(scope))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(payload)
+	return h.Sum(nil)
+}
+
+func invalidCursor(scope string, cause error) app.Error {
+	return app.BuildValidationError().
+		Cause(cause).
+		Context(scope).
+		Str(CursorParamName, "is invalid").
+		Msg("Invalid page cursor")
+}
+
+func checkPageSize(scope string, size int) app.Error {
+	if size < 1 {
+		return app.BuildValidationError().
+			Context(scope).
+			Str("limit", "must be positive").
+			Msgf("Invalid page size %d", size)
+	}
+	return nil
+}
+
+// KeyColumn is a column of the ordering key of a Keyset
+type KeyColumn struct {
+	Name string
+	Desc bool
+}
+
+// Keyset pages through a query by the values of a unique ordering key, which stays fast and consistent
+// for large tables no matter how deep the page is:
+//
+//	users := &db.Keyset[User]{
+//		Name:    "ListUsers",
+//		Query:   db.Select("id", "name", "created_at").From("users").Where(db.IsNull("deleted_at")),
+//		Columns: []db.KeyColumn{{Name: "created_at", Desc: true}, {Name: "id"}},
+//		Key:     func(u *User) []any { return []any{u.CreatedAt, u.ID} },
+//		Mapper:  db.StructMapper[User](),
+//		Codec:   codec,
+//	}
+//	page, err := users.Page(ctx, handle, r.URL.Query().Get("cursor"), 50)
+type Keyset[M any] struct {
+	// Name of the query. It is also the scope of the cursors
+	Name string
+	// Query selects the rows. Its ORDER BY, LIMIT and OFFSET are replaced
+	Query *SelectBuilder
+	// Columns are the ordering key. The last column must make the key unique (ex. the primary key)
+	Columns []KeyColumn
+	// Key returns the values of the key columns for a model
+	Key    func(model *M) []any
+	Mapper MapperFn[M]
+	Codec  *CursorCodec
+	// Dialect defaults to Postgres
+	Dialect Dialect
+}
+
+// Page returns up to size rows following the cursor. An empty cursor starts at the first row
+func (k *Keyset[M]) Page(ctx context.Context, handle SqlHandle, cursor string, size int) (*Page[M], app.Error) {
+	if err := checkPageSize(k.Name, size); err != nil {
+		return nil, err
+	}
+
+	query := k.Query.clone()
+	if cursor != "" {
+		values, err := k.decodeKey(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.Where(k.after(values))
+	}
+	query.orderBy = make([]string, len(k.Columns))
+	for i, c := range k.Columns {
+		query.orderBy[i] = c.Name
+		if c.Desc {
+			query.orderBy[i] += " DESC"
+		}
+	}
+	query.Limit(uint64(size) + 1)
+	query.offset = nil
+
+	items, err := queryPage(ctx, handle, query, k.Dialect, k.Name, k.Mapper)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page[M]{Items: items}
+	if len(items) > size {
+		page.Items = items[:size]
+		if page.NextCursor, err = k.Codec.Encode(k.Name, k.Key(items[size-1])...); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// decodeKey decodes the cursor into values of the same types that the Key function returns
+func (k *Keyset[M]) decodeKey(cursor string) ([]any, app.Error) {
+	zero := k.Key(new(M))
+	if len(zero) != len(k.Columns) {
+		return nil, app.BuildIllegalStateError().
+			Context(k.Name).
+			Msgf("The keyset has %d columns but the key function returned %d values", len(k.Columns), len(zero))
+	}
+
+	pointers := make([]any, len(zero))
+	for i, v := range zero {
+		if v == nil {
+			return nil, app.BuildIllegalStateError().
+				Context(k.Name).
+				Msgf("The key function returned an untyped nil for column '%s'", k.Columns[i].Name)
+		}
+		pointers[i] = reflect.New(reflect.TypeOf(v)).Interface()
+	}
+	if err := k.Codec.Decode(k.Name, cursor, pointers...); err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(pointers))
+	for i, p := range pointers {
+		values[i] = reflect.ValueOf(p).Elem().Interface()
+	}
+	return values, nil
+}
+
+// after is the condition selecting the rows that follow the given key values in the keyset order:
+// (a > x) OR (a = x AND b > y) OR ...
+func (k *Keyset[M]) after(values []any) Condition {
+	alternatives := make([]Condition, len(k.Columns))
+	for i, c := range k.Columns {
+		conditions := make([]Condition, 0, i+1)
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, Eq(k.Columns[j].Name, values[j]))
+		}
+		if c.Desc {
+			conditions = append(conditions, Lt(c.Name, values[i]))
+		} else {
+			conditions = append(conditions, Gt(c.Name, values[i]))
+		}
+		alternatives[i] = And(conditions...)
+	}
+	return Or(alternatives...)
+}
+
+// Offset pages through a query by skipping rows. It supports any ordering, but deep pages get slower and
+// rows can be skipped or repeated when the table changes between pages. Prefer a Keyset for large tables
+type Offset[M any] struct {
+	// Name of the query. It is also the scope of the cursors
+	Name string
+	// Query selects the rows. It should have a deterministic ORDER BY. Its LIMIT and OFFSET are replaced
+	Query  *SelectBuilder
+	Mapper MapperFn[M]
+	Codec  *CursorCodec
+	// Dialect defaults to Postgres
+	Dialect Dialect
+}
+
+// Page returns up to size rows following the cursor. An empty cursor starts at the first row
+func (o *Offset[M]) Page(ctx context.Context, handle SqlHandle, cursor string, size int) (*Page[M], app.Error) {
+	if err := checkPageSize(o.Name, size); err != nil {
+		return nil, err
+	}
+
+	var offset uint64
+	if cursor != "" {
+		var encoded json.Number
+		if err := o.Codec.Decode(o.Name, cursor, &encoded); err != nil {
+			return nil, err
+		}
+		n, e := strconv.ParseUint(encoded.String(), 10, 64)
+		if e != nil {
+			return nil, invalidCursor(o.Name, e)
+		}
+		offset = n
+	}
+
+	query := o.Query.clone().Limit(uint64(size) + 1).Offset(offset)
+	items, err := queryPage(ctx, handle, query, o.Dialect, o.Name, o.Mapper)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page[M]{Items: items}
+	if len(items) > size {
+		page.Items = items[:size]
+		if page.NextCursor, err = o.Codec.Encode(o.Name, offset+uint64(size)); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// queryPage builds and executes the query of a page
+func queryPage[M any](ctx context.Context, handle SqlHandle, query *SelectBuilder, dialect Dialect, name string,
+	mapper MapperFn[M]) ([]*M, app.Error) {
+
+	if dialect == nil {
+		dialect = Postgres
+	}
+	stmt, args, err := BuildQuery(query, dialect, name, mapper)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(ctx, handle, args...)
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestCodec(t *testing.T) *CursorCodec {
+	codec, err := NewCursorCodec([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("unable to create codec: %s", err.Error())
+	}
+	return codec
+}
+
+// test that a cursor round trips and is bound to its scope and signature
+func TestCursorCodec(t *testing.T) {
+	codec := newTestCodec(t)
+	cursor, err := codec.Encode("ListItems", int64(42), "abc")
+	assert.Nil(t, err)
+
+	var id int64
+	var name string
+	assert.Nil(t, codec.Decode("ListItems", cursor, &id, &name))
+	assert.Equal(t, int64(42), id)
+	assert.Equal(t, "abc", name)
+
+	err = codec.Decode("ListUsers", cursor, &id, &name)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, app.ValidationErrorCode, err.Code())
+		assert.Equal(t, "is invalid", err.GetMetadata()[CursorParamName])
+	}
+
+	tampered := "WzQzLCJhYmMiXQ" + cursor[len("WzQyLCJhYmMiXQ"):]
+	assert.NotNil(t, codec.Decode("ListItems", tampered, &id, &name))
+	assert.NotNil(t, codec.Decode("ListItems", "garbage", &id, &name))
+}
+
+// test that a short signing key is rejected
+func TestNewCursorCodecShortKey(t *testing.T) {
+	_, err := NewCursorCodec([]byte("short"))
+	assert.NotNil(t, err)
+}
+
+// test paging through a keyset with a descending and an ascending column
+func TestKeysetPage(t *testing.T) {
+	handle := &fakeHandle{}
+	handle.query = func(string, []any) *fakeRows {
+		if len(handle.rows) == 0 {
+			return itemRows(1, 3)
+		}
+		return itemRows(4, 4)
+	}
+	keyset := &Keyset[item]{
+		Name:    "ListItems",
+		Query:   Select("id", "name").From("items").Where(Eq("active", true)).OrderBy("ignored"),
+		Columns: []KeyColumn{{Name: "name", Desc: true}, {Name: "id"}},
+		Key:     func(m *item) []any { return []any{m.Name, m.ID} },
+		Mapper:  StructMapper[item](),
+		Codec:   newTestCodec(t),
+	}
+
+	first, err := keyset.Page(context.Background(), handle, "", 2)
+	if err != nil {
+		t.Fatalf("first page failed: %s", err.Error())
+	}
+	assert.Equal(t, "SELECT id, name FROM items WHERE active = $1 ORDER BY name DESC, id LIMIT $2", handle.sql[0])
+	assert.Equal(t, []any{true, uint64(3)}, handle.args[0])
+	assert.Len(t, first.Items, 2)
+	assert.NotEmpty(t, first.NextCursor)
+
+	second, err := keyset.Page(context.Background(), handle, first.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("second page failed: %s", err.Error())
+	}
+	assert.Equal(t, "SELECT id, name FROM items WHERE (active = $1 AND (name < $2 OR (name = $3 AND id > $4))) "+
+		"ORDER BY name DESC, id LIMIT $5", handle.sql[1])
+	assert.Equal(t, []any{true, "item", "item", int64(2), uint64(3)}, handle.args[1])
+	assert.Len(t, second.Items, 1)
+	assert.Empty(t, second.NextCursor)
+
+	// the keyset query is not modified by paging
+	sql, _, _ := keyset.Query.Build(Postgres)
+	assert.Equal(t, "SELECT id, name FROM items WHERE active = $1 ORDER BY ignored", sql)
+}
+
+// test paging through a query by offset
+func TestOffsetPage(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 3) }}
+	offset := &Offset[item]{
+		Name:   "ListItems",
+		Query:  Select("id", "name").From("items").OrderBy("id"),
+		Mapper: StructMapper[item](),
+		Codec:  newTestCodec(t),
+	}
+
+	first, err := offset.Page(context.Background(), handle, "", 2)
+	if err != nil {
+		t.Fatalf("first page failed: %s", err.Error())
+	}
+	assert.Len(t, first.Items, 2)
+
+	_, err = offset.Page(context.Background(), handle, first.NextCursor, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id, name FROM items ORDER BY id LIMIT $1 OFFSET $2", handle.sql[1])
+	assert.Equal(t, []any{uint64(3), uint64(2)}, handle.args[1])
+
+	_, err = offset.Page(context.Background(), handle, "", 0)
+	assert.NotNil(t, err)
+}
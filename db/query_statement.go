@@ -4,21 +4,64 @@ import (
 	"context"
 	"github.com/sterrasi/pinion/app"
 	"github.com/sterrasi/pinion/logger"
+	"strings"
+	"time"
 )
 
+// QueryRow executes the query and maps its first row. It fails with a NotFoundError whose context is the
+// query name if the query selects no row
 func (q *QueryStatement[M]) QueryRow(ctx context.Context, handle SqlHandle, args ...any) (*M, app.Error) {
+	return q.queryRow(ctx, handle, false, args)
+}
+
+// QueryRowOpt executes the query and maps its first row, returning nil without an error if the query selects
+// no row
+func (q *QueryStatement[M]) QueryRowOpt(ctx context.Context, handle SqlHandle, args ...any) (*M, app.Error) {
+	return q.queryRow(ctx, handle, true, args)
+}
+
+// Exists returns true if the query selects at least one row. The query is executed as "SELECT EXISTS (...)",
+// so the rows are neither transferred nor mapped. It is observed and traced as the query name with the
+// ".exists" suffix
+func (q *QueryStatement[M]) Exists(ctx context.Context, handle SqlHandle, args ...any) (bool, app.Error) {
+	exists := &QueryStatement[ExistsValue]{
+		Name: q.Name + ".exists",
+		// the closing parenthesis is on its own line so that a trailing line comment cannot swallow it
+		SQL:    "SELECT EXISTS (" + strings.TrimSpace(strings.TrimRight(strings.TrimSpace(q.SQL), ";")) + "\n)",
+		Mapper: ExistsMapper,
+	}
+	ev, err := exists.QueryRow(ctx, handle, args...)
+	if err != nil {
+		return false, err
+	}
+	return ev.Exists, nil
+}
+
+func (q *QueryStatement[M]) queryRow(ctx context.Context, handle SqlHandle, optional bool, args []any) (*M,
+	app.Error) {
 
 	logger.Debug().
 		Str("queryName", q.Name).
 		Msg("Executing single row query")
 
+	start := time.Now()
+	defer ObserveStatement(q.Name, start)
+	ctx, span := StartStatementSpan(ctx, q.Name, q.SQL)
+	defer span.End()
+
 	row := handle.QueryRow(ctx, q.SQL, args...)
+	defer row.Close()
 	model := new(M)
 	err := q.Mapper(row, model)
 	if err != nil {
+		if optional && err.Code() == app.NotFoundErrorCode {
+			return nil, nil
+		}
 		err.SetContext(q.Name)
+		span.RecordError(err)
 		return nil, err
 	}
+	checkSlowQuery(ctx, handle, q.Name, q.SQL, args, time.Since(start), 1)
 
 	logger.Debug().
 		Str("queryName", q.Name).
@@ -33,28 +76,45 @@ func (q *QueryStatement[M]) Query(ctx context.Context, handle SqlHandle, args ..
 		Str("queryName", q.Name).
 		Msg("Executing multi-row query")
 
+	start := time.Now()
+	defer ObserveStatement(q.Name, start)
+	ctx, span := StartStatementSpan(ctx, q.Name, q.SQL)
+	defer span.End()
+
 	rows, appErr := handle.Query(ctx, q.SQL, args...)
 	if appErr != nil {
 		appErr.SetContext(q.Name)
+		span.RecordError(appErr)
+		return nil, appErr
+	}
+	results, appErr := collectRows(rows, q.Mapper)
+	if appErr != nil {
+		appErr.SetContext(q.Name)
+		span.RecordError(appErr)
 		return nil, appErr
 	}
+	span.SetAttribute("db.rows", len(results))
+	checkSlowQuery(ctx, handle, q.Name, q.SQL, args, time.Since(start), len(results))
+	return results, nil
+}
+
+// collectRows maps every row of the iterator and closes it
+func collectRows[M any](rows RowIterator, mapper MapperFn[M]) ([]*M, app.Error) {
 	defer rows.Close()
 	results := make([]*M, 0, 1)
 
 	for rows.Next() {
 
 		model := new(M)
-		if appErr = q.Mapper(rows, model); appErr != nil {
-			appErr.SetContext(q.Name)
-			return nil, appErr
+		if err := mapper(rows, model); err != nil {
+			return nil, err
 		}
 		results = append(results, model)
 	}
 
 	// Any errors encountered by rows.Next or rows.Scan will be returned here
-	if appErr = rows.Err(); appErr != nil {
-		appErr.SetContext(q.Name)
-		return nil, appErr
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 	return results, nil
 }
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test that a query selecting no row fails with a NotFoundError in the context of the query
+func TestQueryRowNotFound(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 0) }}
+
+	model, err := itemQuery.QueryRow(context.Background(), handle)
+	assert.Nil(t, model)
+	assert.NotNil(t, err)
+	assert.Equal(t, app.NotFoundErrorCode, err.Code())
+	assert.Equal(t, itemQuery.Name, err.GetContext())
+}
+
+// test that an optional query returns nil for no row and the model otherwise
+func TestQueryRowOpt(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 0) }}
+	model, err := itemQuery.QueryRowOpt(context.Background(), handle)
+	assert.Nil(t, err)
+	assert.Nil(t, model)
+
+	handle = &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(7, 7) }}
+	model, err = itemQuery.QueryRowOpt(context.Background(), handle)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), model.ID)
+}
+
+// test that the row is closed if the mapper fails before scanning it
+func TestQueryRowClosedOnMapperError(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows {
+		return &fakeRows{columns: []string{"id", "name", "extra"}, rows: [][]any{{int64(1), "a", "b"}}}
+	}}
+	query := &QueryStatement[item]{Name: "SelectItemExtra", SQL: "SELECT * FROM items", Mapper: StructMapper[item]()}
+
+	_, err := query.QueryRow(context.Background(), handle)
+	assert.NotNil(t, err)
+	assert.True(t, handle.rows[0].closed)
+}
+
+// test that Exists wraps the query in SELECT EXISTS
+func TestExists(t *testing.T) {
+	for _, expected := range []bool{true, false} {
+		handle := &fakeHandle{query: func(string, []any) *fakeRows {
+			return &fakeRows{columns: []string{"exists"}, rows: [][]any{{expected}}}
+		}}
+		exists, err := itemQuery.Exists(context.Background(), handle, int64(3))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, exists)
+		assert.Equal(t, "SELECT EXISTS ("+itemQuery.SQL+"\n)", handle.sql[0])
+		assert.Equal(t, []any{int64(3)}, handle.args[0])
+	}
+}
+
+// test that Exists is observed under its own name and closes the subquery after a trailing comment
+func TestExistsTrailingComment(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows {
+		return &fakeRows{columns: []string{"exists"}, rows: [][]any{{true}}}
+	}}
+	query := &QueryStatement[item]{Name: "SelectItemComment", SQL: "SELECT id FROM items -- by id\n;",
+		Mapper: itemQuery.Mapper}
+
+	_, err := query.Exists(context.Background(), handle)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT EXISTS (SELECT id FROM items -- by id\n)", handle.sql[0])
+	assert.Equal(t, uint64(1), statementDuration.With("SelectItemComment.exists").Count())
+	assert.Equal(t, uint64(0), statementDuration.With("SelectItemComment").Count())
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SlowQueryPolicy selects the QueryStatements that are logged as slow. The duration of QueryStatement.Each
+// includes the time spent handling the rows, as does the duration of QueryStatement.Stream, which executes
+// the query with Each
+type SlowQueryPolicy struct {
+	// Threshold is the duration after which a query is slow. Slow queries are not logged if it is 0
+	Threshold time.Duration
+	// Explain logs the plan of slow queries by executing them again with EXPLAIN (ANALYZE, BUFFERS). It is
+	// ignored under the production profile and for statements that are not a SELECT
+	Explain bool
+}
+
+var slowQueryPolicy atomic.Pointer[SlowQueryPolicy]
+
+// SetSlowQueryPolicy sets the process wide policy applied to every QueryStatement. It is called by database
+// drivers with the SlowQueryPolicy of the DbConfig if it has a threshold, so a database connected without
+// one (ex. an administrative connection) does not disable the policy of another
+func SetSlowQueryPolicy(policy SlowQueryPolicy) {
+	slowQueryPolicy.Store(&policy)
+}
+
+// checkSlowQuery logs the query at warn level if it took longer than the threshold of the SlowQueryPolicy,
+// attaching its plan if the policy explains slow queries
+func checkSlowQuery(ctx context.Context, handle SqlHandle, name string, sql string, args []any,
+	duration time.Duration, rows int) {
+
+	policy := slowQueryPolicy.Load()
+	if policy == nil || policy.Threshold <= 0 || duration < policy.Threshold {
+		return
+	}
+
+	event := logger.FromContext(ctx).Warn().
+		Str("queryName", name).
+		Str("sql", sql).
+		Int("argCount", len(args)).
+		Dur("duration", duration).
+		Int("rows", rows)
+
+	if policy.Explain && app.GetActiveProfile() != app.Production && isSelect(sql) {
+		plan, err := explain(ctx, handle, sql, args)
+		if err != nil {
+			event.Str("planError", err.Error())
+		} else {
+			event.Str("plan", plan)
+		}
+	}
+	event.Msg("Slow query")
+}
+
+// explainTimeout bounds the time spent executing a slow query again to explain it
+const explainTimeout = 5 * time.Second
+
+// errExplained rolls back the savepoint of an explained statement
+var errExplained = app.NewInternalError("Statement explained")
+
+// explain executes the statement with EXPLAIN (ANALYZE, BUFFERS) and returns the plan, giving up after the
+// explainTimeout. Within a transaction it is executed in a savepoint that is always rolled back, so that a
+// failure does not abort the transaction. The timeout is then a statement_timeout of the savepoint, since
+// cancelling a statement of the transaction through its context would close the connection
+func explain(ctx context.Context, handle SqlHandle, sql string, args []any) (string, app.Error) {
+	var plan string
+	run := func(ctx context.Context, h SqlHandle) app.Error {
+		rows, err := h.Query(ctx, "EXPLAIN (ANALYZE, BUFFERS) "+sql, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		lines := make([]string, 0, 16)
+		for rows.Next() {
+			var line string
+			if err = rows.Scan(&line); err != nil {
+				return err
+			}
+			lines = append(lines, line)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		plan = strings.Join(lines, "\n")
+		return nil
+	}
+
+	dh, ok := handle.(DatabaseHandle)
+	if !ok {
+		ctx, cancel := context.WithTimeout(ctx, explainTimeout)
+		defer cancel()
+		return plan, run(ctx, handle)
+	}
+
+	err := dh.Savepoint(ctx, func(h DatabaseHandle) app.Error {
+		timeout := fmt.Sprintf("SET LOCAL statement_timeout = %d", explainTimeout.Milliseconds())
+		if _, err := h.Exec(ctx, timeout); err != nil {
+			return err
+		}
+		if err := run(ctx, h); err != nil {
+			return err
+		}
+		return errExplained
+	})
+	if err == errExplained {
+		err = nil
+	}
+	return plan, err
+}
+
+// isSelect returns true if the statement is a SELECT, which can safely be executed again to be explained
+func isSelect(sql string) bool {
+	trimmed := strings.TrimSpace(sql)
+	return len(trimmed) >= 6 && strings.EqualFold(trimmed[:6], "select")
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withSlowQueryPolicy sets the policy and profile for the duration of a test
+func withSlowQueryPolicy(t *testing.T, policy SlowQueryPolicy, profile app.Profile) {
+	previous := app.GetActiveProfile()
+	SetSlowQueryPolicy(policy)
+	app.OverrideProfile(profile)
+	t.Cleanup(func() {
+		SetSlowQueryPolicy(SlowQueryPolicy{})
+		app.OverrideProfile(previous)
+	})
+}
+
+func planRows() *fakeRows {
+	return &fakeRows{columns: []string{"QUERY PLAN"}, rows: [][]any{{"Seq Scan on items"}, {"Execution Time: 1 ms"}}}
+}
+
+func slowQueryEvent(t *testing.T, buf *bytes.Buffer) map[string]any {
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		event := make(map[string]any)
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("unable to decode log event: %s", err.Error())
+		}
+		if event["message"] == "Slow query" {
+			return event
+		}
+	}
+	return nil
+}
+
+// test that a query over the threshold is logged with its plan in a non production profile
+func TestSlowQueryExplained(t *testing.T) {
+	withSlowQueryPolicy(t, SlowQueryPolicy{Threshold: time.Nanosecond, Explain: true}, app.Development)
+
+	var buf bytes.Buffer
+	ctx := logger.NewContext(context.Background(), zerolog.New(&buf))
+	handle := &fakeHandle{query: func(sql string, args []any) *fakeRows {
+		if strings.HasPrefix(sql, "EXPLAIN") {
+			return planRows()
+		}
+		return itemRows(1, 3)
+	}}
+
+	_, err := itemQuery.Query(ctx, handle, int64(5))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "EXPLAIN (ANALYZE, BUFFERS) "+itemQuery.SQL, handle.sql[1])
+	assert.Equal(t, []any{int64(5)}, handle.args[1])
+
+	event := slowQueryEvent(t, &buf)
+	assert.NotNil(t, event)
+	assert.Equal(t, "warn", event["level"])
+	assert.Equal(t, itemQuery.Name, event["queryName"])
+	assert.Equal(t, itemQuery.SQL, event["sql"])
+	assert.Equal(t, float64(1), event["argCount"])
+	assert.Equal(t, float64(3), event["rows"])
+	assert.Equal(t, "Seq Scan on items\nExecution Time: 1 ms", event["plan"])
+}
+
+// test that slow queries are not explained under the production profile
+func TestSlowQueryNotExplainedInProduction(t *testing.T) {
+	withSlowQueryPolicy(t, SlowQueryPolicy{Threshold: time.Nanosecond, Explain: true}, app.Production)
+
+	var buf bytes.Buffer
+	ctx := logger.NewContext(context.Background(), zerolog.New(&buf))
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 2) }}
+
+	err := itemQuery.Each(ctx, handle, func(*item) app.Error { return nil })
+	assert.Nil(t, err)
+
+	assert.Len(t, handle.sql, 1)
+	event := slowQueryEvent(t, &buf)
+	assert.NotNil(t, event)
+	assert.Equal(t, float64(2), event["rows"])
+	assert.NotContains(t, event, "plan")
+}
+
+// test that queries under the threshold, or without a threshold, are not logged
+func TestSlowQueryThreshold(t *testing.T) {
+	for _, policy := range []SlowQueryPolicy{{Threshold: time.Hour}, {}} {
+		withSlowQueryPolicy(t, policy, app.Development)
+
+		var buf bytes.Buffer
+		ctx := logger.NewContext(context.Background(), zerolog.New(&buf))
+		handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 1) }}
+
+		_, err := itemQuery.Query(ctx, handle)
+		assert.Nil(t, err)
+		assert.Nil(t, slowQueryEvent(t, &buf))
+	}
+}
+
+// test that only SELECT statements are explained
+func TestIsSelect(t *testing.T) {
+	assert.True(t, isSelect("  select * from items"))
+	assert.True(t, isSelect("SELECT 1"))
+	assert.False(t, isSelect("INSERT INTO items VALUES (1) RETURNING id"))
+	assert.False(t, isSelect("WITH d AS (DELETE FROM items RETURNING *) SELECT * FROM d"))
+	assert.False(t, isSelect("sel"))
+}
+
+// fakeTxHandle is a DatabaseHandle executing its statements and savepoints on a fakeHandle
+type fakeTxHandle struct {
+	DatabaseHandle
+	*fakeHandle
+	savepointErr app.Error
+}
+
+func (h *fakeTxHandle) Exec(_ context.Context, sql string, _ ...any) (*ExecResult, app.Error) {
+	h.sql = append(h.sql, sql)
+	h.args = append(h.args, nil)
+	return &ExecResult{}, nil
+}
+
+func (h *fakeTxHandle) Query(ctx context.Context, sql string, args ...any) (RowIterator, app.Error) {
+	return h.fakeHandle.Query(ctx, sql, args...)
+}
+
+func (h *fakeTxHandle) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	return h.fakeHandle.QueryRow(ctx, sql, args...)
+}
+
+func (h *fakeTxHandle) Savepoint(_ context.Context, fn TransactionFn) app.Error {
+	h.savepointErr = fn(h)
+	return h.savepointErr
+}
+
+// test that a query of a transaction is explained with a statement timeout in a savepoint that is rolled back
+func TestSlowQueryExplainedInTransaction(t *testing.T) {
+	withSlowQueryPolicy(t, SlowQueryPolicy{Threshold: time.Nanosecond, Explain: true}, app.Development)
+
+	var buf bytes.Buffer
+	ctx := logger.NewContext(context.Background(), zerolog.New(&buf))
+	handle := &fakeTxHandle{fakeHandle: &fakeHandle{query: func(sql string, args []any) *fakeRows {
+		if strings.HasPrefix(sql, "EXPLAIN") {
+			return planRows()
+		}
+		return itemRows(1, 3)
+	}}}
+
+	_, err := itemQuery.Query(ctx, handle)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{itemQuery.SQL, "SET LOCAL statement_timeout = 5000",
+		"EXPLAIN (ANALYZE, BUFFERS) " + itemQuery.SQL}, handle.sql)
+	assert.Same(t, errExplained, handle.savepointErr)
+	assert.Equal(t, "Seq Scan on items\nExecution Time: 1 ms", slowQueryEvent(t, &buf)["plan"])
+}
+
+// test that the queries of a stream are logged as slow
+func TestSlowQueryStream(t *testing.T) {
+	withSlowQueryPolicy(t, SlowQueryPolicy{Threshold: time.Nanosecond}, app.Development)
+
+	var buf bytes.Buffer
+	ctx := logger.NewContext(context.Background(), zerolog.New(&buf))
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 4) }}
+
+	stream := itemQuery.Stream(ctx, handle)
+	for range stream.Rows() {
+	}
+	assert.Nil(t, stream.Close())
+
+	event := slowQueryEvent(t, &buf)
+	if assert.NotNil(t, event) {
+		assert.Equal(t, float64(4), event["rows"])
+	}
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	"sync"
+	"time"
+)
+
+// EachFn is called for every row of QueryStatement.Each. Returning an error stops the iteration
+type EachFn[M any] func(model *M) app.Error
+
+// Each executes the query and calls the function for every mapped row without holding the whole result in
+// memory. It stops at the first error returned by the function, or when the context is done
+func (q *QueryStatement[M]) Each(ctx context.Context, handle SqlHandle, fn EachFn[M], args ...any) app.Error {
+
+	logger.Debug().
+		Str("queryName", q.Name).
+		Msg("Executing row by row query")
+
+	start := time.Now()
+	defer ObserveStatement(q.Name, start)
+	ctx, span := StartStatementSpan(ctx, q.Name, q.SQL)
+	defer span.End()
+
+	rows := 0
+	appErr := q.each(ctx, handle, func(model *M) app.Error {
+		rows++
+		return fn(model)
+	}, args...)
+	if appErr != nil {
+		span.RecordError(appErr)
+		return appErr
+	}
+	checkSlowQuery(ctx, handle, q.Name, q.SQL, args, time.Since(start), rows)
+	return nil
+}
+
+// each maps and hands every row to the function
+func (q *QueryStatement[M]) each(ctx context.Context, handle SqlHandle, fn EachFn[M], args ...any) app.Error {
+
+	rows, appErr := handle.Query(ctx, q.SQL, args...)
+	if appErr != nil {
+		appErr.SetContext(q.Name)
+		return appErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return BuildDatabaseError().
+				Cause(err).
+				Context(q.Name).
+				Msg("Query was cancelled")
+		}
+
+		model := new(M)
+		if appErr = q.Mapper(rows, model); appErr != nil {
+			appErr.SetContext(q.Name)
+			return appErr
+		}
+		if appErr = fn(model); appErr != nil {
+			return appErr
+		}
+	}
+
+	if appErr = rows.Err(); appErr != nil {
+		appErr.SetContext(q.Name)
+		return appErr
+	}
+	return nil
+}
+
+// Stream delivers the rows of a query over a channel. The producer only reads the next row once the
+// previous one was received, so a slow consumer applies backpressure to the database cursor
+type Stream[M any] struct {
+	rows   chan *M
+	parent context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+	err    app.Error
+}
+
+// Stream executes the query in a background goroutine delivering the mapped rows over the Stream's channel.
+// Like Each, the duration of the query is observed under its name and traced with a statement span. The handle must not be used by the caller until the Stream is closed. Close must always be called, either
+// after the channel is drained or to stop the query early:
+//
+//	stream := query.Stream(ctx, handle, args...)
+//	for model := range stream.Rows() {
+//		...
+//	}
+//	if err := stream.Close(); err != nil {
+//		...
+//	}
+func (q *QueryStatement[M]) Stream(ctx context.Context, handle SqlHandle, args ...any) *Stream[M] {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream[M]{
+		rows:   make(chan *M),
+		parent: parent,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		defer close(s.rows)
+
+		err := q.Each(ctx, handle, func(model *M) app.Error {
+			select {
+			case s.rows <- model:
+				return nil
+			case <-ctx.Done():
+				return BuildDatabaseError().
+					Cause(ctx.Err()).
+					Context(q.Name).
+					Msg("Query was cancelled")
+			}
+		}, args...)
+		s.err = err
+	}()
+	return s
+}
+
+// Rows returns the channel of mapped rows. It is closed when the query completes or fails
+func (s *Stream[M]) Rows() <-chan *M {
+	return s.rows
+}
+
+// Close stops the query if it is still running, waits for the producer to exit and returns the error that
+// ended the query, if any. Stopping a query early is not reported as an error, but an error of the query or
+// mapper, or the cancellation of the context the Stream was started with, is
+func (s *Stream[M]) Close() app.Error {
+	s.once.Do(func() {
+		s.cancel()
+		// unblock the producer if it is waiting on a send
+		for range s.rows {
+		}
+		<-s.done
+		if s.err != nil && s.parent.Err() == nil && errors.Is(s.err.Cause(), context.Canceled) {
+			// the query was cancelled by Close
+			s.err = nil
+		}
+	})
+	return s.err
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fakeRows is a RowIterator over rows of values
+type fakeRows struct {
+	columns []string
+	rows    [][]any
+	index   int
+	closed  bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Scan(dest ...any) app.Error {
+	row := &fakeRow{columns: r.columns, values: r.rows[r.index-1]}
+	return row.Scan(dest...)
+}
+
+func (r *fakeRows) Close() {
+	r.closed = true
+}
+
+func (r *fakeRows) Err() app.Error {
+	return nil
+}
+
+func (r *fakeRows) Next() bool {
+	if r.closed || r.index >= len(r.rows) {
+		return false
+	}
+	r.index++
+	return true
+}
+
+func (r *fakeRows) Values() ([]any, app.Error) {
+	return r.rows[r.index-1], nil
+}
+
+// fakeHandle is an SqlHandle returning the rows of a query function and recording the executed SQL
+type fakeHandle struct {
+	query func(sql string, args []any) *fakeRows
+	sql   []string
+	args  [][]any
+	rows  []*fakeRows
+}
+
+func (h *fakeHandle) Exec(context.Context, string, ...any) (*ExecResult, app.Error) {
+	return &ExecResult{}, nil
+}
+
+func (h *fakeHandle) Query(_ context.Context, sql string, args ...any) (RowIterator, app.Error) {
+	h.sql = append(h.sql, sql)
+	h.args = append(h.args, args)
+	rows := h.query(sql, args)
+	h.rows = append(h.rows, rows)
+	return rows, nil
+}
+
+// QueryRow returns the first row of the query function, failing with a NotFoundError if there is none
+func (h *fakeHandle) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	rows, _ := h.Query(ctx, sql, args...)
+	if !rows.Next() {
+		return &fakeRow{err: app.BuildNotFoundError().Msg("Query returned no rows")}
+	}
+	return &fakeRow{columns: rows.(*fakeRows).columns, values: rows.(*fakeRows).rows[0], source: rows.(*fakeRows)}
+}
+
+type item struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func itemRows(from int64, to int64) *fakeRows {
+	rows := &fakeRows{columns: []string{"id", "name"}}
+	for id := from; id <= to; id++ {
+		rows.rows = append(rows.rows, []any{id, "item"})
+	}
+	return rows
+}
+
+var itemQuery = &QueryStatement[item]{
+	Name:   "SelectItems",
+	SQL:    "SELECT id, name FROM items",
+	Mapper: StructMapper[item](),
+}
+
+// test that Each visits every row and stops at the first error
+func TestEach(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 5) }}
+
+	var ids []int64
+	err := itemQuery.Each(context.Background(), handle, func(model *item) app.Error {
+		ids = append(ids, model.ID)
+		if model.ID == 3 {
+			return app.NewIllegalStateError("stop")
+		}
+		return nil
+	})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "stop", app.MessageOf(err))
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+	assert.True(t, handle.rows[0].closed)
+}
+
+// test that a stream delivers every row and reports no error when drained
+func TestStream(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 100) }}
+
+	stream := itemQuery.Stream(context.Background(), handle)
+	count := 0
+	for range stream.Rows() {
+		count++
+	}
+	assert.Nil(t, stream.Close())
+	assert.Equal(t, 100, count)
+}
+
+// test that the duration of a streamed query is observed under the query name
+func TestStreamObservesStatement(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 3) }}
+	histogram := statementDuration.With(itemQuery.Name)
+	count := histogram.Count()
+
+	stream := itemQuery.Stream(context.Background(), handle)
+	for range stream.Rows() {
+	}
+	assert.Nil(t, stream.Close())
+	assert.Equal(t, count+1, histogram.Count())
+}
+
+// test that closing a stream early stops the producer
+func TestStreamClosedEarly(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 100) }}
+
+	stream := itemQuery.Stream(context.Background(), handle)
+	first := <-stream.Rows()
+	assert.Equal(t, int64(1), first.ID)
+	assert.Nil(t, stream.Close())
+	assert.True(t, handle.rows[0].closed)
+	assert.Less(t, handle.rows[0].index, 100)
+}
+
+// test that the error of a drained stream is returned by Close
+func TestStreamMapperError(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 10) }}
+	query := &QueryStatement[item]{
+		Name: "SelectItems",
+		SQL:  itemQuery.SQL,
+		Mapper: func(scanner Scanner, model *item) app.Error {
+			if appErr := itemQuery.Mapper(scanner, model); appErr != nil {
+				return appErr
+			}
+			if model.ID == 3 {
+				return app.NewIllegalStateError("bad row")
+			}
+			return nil
+		},
+	}
+
+	stream := query.Stream(context.Background(), handle)
+	count := 0
+	for range stream.Rows() {
+		count++
+	}
+	err := stream.Close()
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "bad row", app.MessageOf(err))
+		assert.Equal(t, "SelectItems", err.GetContext())
+	}
+	assert.Equal(t, 2, count)
+}
+
+// test that the cancellation of the stream's context is reported by Close
+func TestStreamContextCancelled(t *testing.T) {
+	handle := &fakeHandle{query: func(string, []any) *fakeRows { return itemRows(1, 100) }}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := itemQuery.Stream(ctx, handle)
+	<-stream.Rows()
+	cancel()
+	assert.NotNil(t, stream.Close())
+}
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/tracing"
+)
+
+// StartStatementSpan starts a client span named after the statement with its SQL as the db.statement
+// attribute, and stores the name in the returned context (see StatementNameFrom). It is called by the
+// QueryStatement methods and by database drivers for the statements they name (ex. InsertStatement)
+func StartStatementSpan(ctx context.Context, name string, sql string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(WithStatementName(ctx, name), name, tracing.ClientSpan)
+	span.SetAttribute("db.statement", sql)
+	return ctx, span
+}
@@ -1,5 +1,13 @@
 package db
 
+import (
+	"context"
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	"strconv"
+)
+
 type IsoLevel string
 
 // Transaction isolation levels
@@ -33,4 +41,46 @@ type TransactionOptions struct {
 	IsoLevel       IsoLevel
 	AccessMode     AccessMode
 	DeferrableMode DeferrableMode
+	// Retry overrides the database's default retry policy for transaction conflicts
+	Retry *RetryPolicy
+}
+
+// RetryPolicy describes how a transaction that failed due to a serialization failure or a deadlock is
+// retried. The TransactionFn is executed again for every attempt, so it should not have side effects outside
+// the transaction
+type RetryPolicy struct {
+	// MaxAttempts is the max number of times the transaction is executed. 0 or 1 disables retries
+	MaxAttempts uint
+	Backoff     pinion.Backoff
+}
+
+// NoRetry disables retrying transaction conflicts
+var NoRetry = &RetryPolicy{MaxAttempts: 1}
+
+// RunWithRetry executes a transaction attempt, executing it again with backoff for as long as it fails with a
+// transaction conflict and the policy allows. A TransactionRetriesExhausted error wrapping the last conflict is
+// returned if every attempt conflicted
+func RunWithRetry(ctx context.Context, policy *RetryPolicy, attemptFn func() app.Error) app.Error {
+	for attempt := uint(1); ; attempt++ {
+		err := attemptFn()
+		if !IsTransactionConflict(err) || policy.MaxAttempts <= 1 {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return BuildTransactionRetriesExhaustedError(attempt).
+				Cause(err).
+				Context(err.GetContext()).
+				Msg("Transaction conflicted with concurrent transactions on every attempt")
+		}
+
+		logger.Warn().
+			Str("attempt", strconv.FormatUint(uint64(attempt), 10)).
+			Str("maxAttempts", strconv.FormatUint(uint64(policy.MaxAttempts), 10)).
+			Str("error", err.Error()).
+			Msg("Retrying conflicting transaction")
+
+		if e := policy.Backoff.Wait(ctx, int(attempt)); e != nil {
+			return err
+		}
+	}
 }
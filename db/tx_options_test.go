@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = &RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     pinion.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 2},
+}
+
+func conflictError() app.Error {
+	return BuildTransactionConflictError().Context("UpdateBalance").Msg("conflict")
+}
+
+// test that a conflicting transaction is executed again until it succeeds
+func TestRunWithRetry(t *testing.T) {
+	attempts := 0
+	err := RunWithRetry(context.Background(), testRetryPolicy, func() app.Error {
+		attempts++
+		if attempts < 3 {
+			return conflictError()
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+// test the error returned once every attempt conflicted
+func TestRunWithRetryExhausted(t *testing.T) {
+	attempts := 0
+	err := RunWithRetry(context.Background(), testRetryPolicy, func() app.Error {
+		attempts++
+		return conflictError()
+	})
+	assert.Equal(t, 3, attempts)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, TransactionRetriesExhaustedErrorCode, err.Code())
+		assert.Equal(t, "UpdateBalance", err.GetContext())
+		assert.Equal(t, "3", err.GetMetadata()["attempts"])
+	}
+}
+
+// test that other errors and disabled retries are returned as is
+func TestRunWithRetryNotRetried(t *testing.T) {
+	attempts := 0
+	err := RunWithRetry(context.Background(), testRetryPolicy, func() app.Error {
+		attempts++
+		return BuildSqlError().Msg("syntax error")
+	})
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, SQLErrorCode, err.Code())
+
+	attempts = 0
+	err = RunWithRetry(context.Background(), NoRetry, func() app.Error {
+		attempts++
+		return conflictError()
+	})
+	assert.Equal(t, 1, attempts)
+	assert.True(t, IsTransactionConflict(err))
+}
+
+// test that read transactions are read only, so that they can be routed to a read replica
+func TestTxReadOptionsReadOnly(t *testing.T) {
+	assert.Equal(t, ReadOnly, TxReadOptions.AccessMode)
+	assert.Equal(t, ReadWrite, TxWriteOptions.AccessMode)
+}
@@ -0,0 +1,559 @@
+// Package dbtest provides an in-memory db.DB for unit testing code that executes statements, without a
+// database. The results of statements are programmed by statement name (ex. QueryStatement.Name) or by a
+// regular expression matching their SQL:
+//
+//	fake := dbtest.New(t)
+//	fake.ExpectQuery("GetUser").WithArgs(int64(1)).
+//		WillReturnRows(dbtest.NewRows("id", "name").AddRow(int64(1), "bob"))
+//	fake.ExpectExec(`^UPDATE users`).WillReturnError(app.NewNotFoundError("No such user"))
+//
+// Executed statements are recorded with the outcome of their transaction. A statement without a matching
+// expectation fails the test, as does an expectation that was not met by the end of the test
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxPendingNotifications is the number of notifications that can be sent with DB.Notify before they are
+// received
+const maxPendingNotifications = 64
+
+// TestingT is the part of testing.T used by the DB
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Cleanup(fn func())
+}
+
+// Outcome is the outcome of an executed statement or a transaction
+type Outcome int
+
+const (
+	// Pending statements belong to a transaction that has not completed
+	Pending Outcome = iota
+	// Committed statements were executed in autocommit mode or in a committed transaction
+	Committed
+	// RolledBack statements belong to a transaction or savepoint that was rolled back
+	RolledBack
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Committed:
+		return "committed"
+	case RolledBack:
+		return "rolled back"
+	default:
+		return "pending"
+	}
+}
+
+// Statement is a statement executed on the DB
+type Statement struct {
+	// Name is the name of the statement if it was executed through a QueryStatement, InsertStatement or a
+	// Batch, the table of a bulk insert or the path of an executed file
+	Name string
+	SQL  string
+	Args []any
+	// Rows are the rows of a bulk insert
+	Rows [][]any
+	// Tx is the transaction of the statement, or nil if it was executed in autocommit mode
+	Tx      *Transaction
+	Outcome Outcome
+}
+
+// Transaction is a transaction started on the DB
+type Transaction struct {
+	Options *db.TransactionOptions
+	Outcome Outcome
+}
+
+// DB is an in-memory db.DB returning the programmed results of the statements executed on it. It simulates
+// the transaction semantics of postgres: a failed statement aborts its transaction (or savepoint), read only
+// transactions reject writes and a transaction is rolled back if its function fails. It is safe for
+// concurrent use
+type DB struct {
+	t            TestingT
+	mu           sync.Mutex
+	expectations []*Expectation
+	statements   []*Statement
+	transactions []*Transaction
+	commitErrors []app.Error
+	acquired     int
+	closed       bool
+	// notifications are received by Conn.WaitForNotification
+	notifications chan *db.Notification
+}
+
+// New creates a DB that checks its expectations when the test completes
+func New(t TestingT) *DB {
+	d := &DB{t: t, notifications: make(chan *db.Notification, maxPendingNotifications)}
+	t.Cleanup(d.AssertExpectations)
+	return d
+}
+
+// ExpectQuery programs the result of the queries (Query, QueryRow and the QueryStatement methods) whose name
+// is the pattern or whose SQL matches it as a regular expression
+func (d *DB) ExpectQuery(pattern string) *Expectation {
+	return d.expect(queryKind, pattern)
+}
+
+// ExpectExec programs the result of the statements (Exec, Insert, BulkInsert, ExecFile and ExecFS) whose
+// name is the pattern or whose SQL matches it as a regular expression
+func (d *DB) ExpectExec(pattern string) *Expectation {
+	return d.expect(execKind, pattern)
+}
+
+func (d *DB) expect(kind statementKind, pattern string) *Expectation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e := newExpectation(kind, pattern)
+	d.expectations = append(d.expectations, e)
+	return e
+}
+
+// FailCommit makes the next commit fail with the error, rolling back the transaction
+func (d *DB) FailCommit(err app.Error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.commitErrors = append(d.commitErrors, err)
+}
+
+// Statements returns the executed statements in execution order
+func (d *DB) Statements() []*Statement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Statement(nil), d.statements...)
+}
+
+// Committed returns the statements whose changes were committed, in execution order
+func (d *DB) Committed() []*Statement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	committed := make([]*Statement, 0, len(d.statements))
+	for _, stmt := range d.statements {
+		if stmt.Outcome == Committed {
+			committed = append(committed, stmt)
+		}
+	}
+	return committed
+}
+
+// Transactions returns the started transactions in start order
+func (d *DB) Transactions() []*Transaction {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Transaction(nil), d.transactions...)
+}
+
+// AssertExpectations fails the test for every expectation that was not met and for connections that were
+// not released. It is called when the test completes
+func (d *DB) AssertExpectations() {
+	d.t.Helper()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.expectations {
+		if unmet := e.unmet(); unmet != "" {
+			d.t.Errorf("dbtest: unmet expectation: %s", unmet)
+		}
+	}
+	if d.acquired > 0 {
+		d.t.Errorf("dbtest: %d acquired connections were not released", d.acquired)
+	}
+}
+
+// Close closes the DB. Statements executed after it is closed fail
+func (d *DB) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+}
+
+func (d *DB) Exec(ctx context.Context, sql string, args ...any) (*db.ExecResult, app.Error) {
+	return d.autocommit().Exec(ctx, sql, args...)
+}
+
+func (d *DB) Query(ctx context.Context, sql string, args ...any) (db.RowIterator, app.Error) {
+	return d.autocommit().Query(ctx, sql, args...)
+}
+
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...any) db.Row {
+	return d.autocommit().QueryRow(ctx, sql, args...)
+}
+
+// Acquire returns a connection executing statements in autocommit mode. It must be released before the
+// test completes
+func (d *DB) Acquire(context.Context) (db.Conn, app.Error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, closedError()
+	}
+	d.acquired++
+	return &conn{handle: d.autocommit()}, nil
+}
+
+func (d *DB) ReadTransaction(ctx context.Context, tnFn db.TransactionFn) app.Error {
+	return d.Transaction(ctx, db.TxReadOptions, tnFn)
+}
+
+func (d *DB) WriteTransaction(ctx context.Context, tnFn db.TransactionFn) app.Error {
+	return d.Transaction(ctx, db.TxWriteOptions, tnFn)
+}
+
+func (d *DB) WriteSerializableTransaction(ctx context.Context, tnFn db.TransactionFn) app.Error {
+	return d.Transaction(ctx, db.TxSerializableWriteOptions, tnFn)
+}
+
+// Transaction executes the function in a transaction that is committed if it succeeds and rolled back
+// otherwise. Transaction conflicts are retried according to the options' RetryPolicy
+func (d *DB) Transaction(ctx context.Context, txOptions *db.TransactionOptions, tnFn db.TransactionFn) app.Error {
+	if txOptions == nil {
+		txOptions = db.TxWriteOptions
+	}
+	retry := db.NoRetry
+	if txOptions.Retry != nil {
+		retry = txOptions.Retry
+	}
+
+	return db.RunWithRetry(ctx, retry, func() app.Error {
+		tx, err := d.begin(txOptions)
+		if err != nil {
+			return err
+		}
+		h := &handle{db: d, tx: tx}
+		return d.complete(h, tnFn(h))
+	})
+}
+
+func (d *DB) InTx(ctx context.Context, txOptions *db.TransactionOptions, fn db.TxContextFn) app.Error {
+	return db.InTx(ctx, d, txOptions, fn)
+}
+
+func (d *DB) autocommit() *handle {
+	return &handle{db: d}
+}
+
+func (d *DB) begin(txOptions *db.TransactionOptions) (*Transaction, app.Error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, closedError()
+	}
+	tx := &Transaction{Options: txOptions}
+	d.transactions = append(d.transactions, tx)
+	return tx, nil
+}
+
+// complete commits the transaction of the handle, unless the function failed, the transaction was aborted
+// or the commit was programmed to fail
+func (d *DB) complete(h *handle, fnErr app.Error) app.Error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := fnErr
+	if err == nil && h.aborted {
+		err = db.BuildSqlError().
+			Str("operation", "commit").
+			Msg("Commit rolled back the aborted transaction")
+	}
+	if err == nil && len(d.commitErrors) > 0 {
+		err = d.commitErrors[0]
+		d.commitErrors = d.commitErrors[1:]
+	}
+
+	outcome := Committed
+	if err != nil {
+		outcome = RolledBack
+	}
+	h.tx.Outcome = outcome
+	for _, stmt := range h.executed {
+		stmt.Outcome = outcome
+	}
+	return err
+}
+
+// writeKeywords are the leading keywords of the statements that postgres rejects in a read only transaction
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "CREATE": true, "ALTER": true, "DROP": true,
+	"TRUNCATE": true, "COPY": true,
+}
+
+// isWrite returns true if the statement writes, judging by its leading keyword. Other statements (ex. SELECT
+// or SET LOCAL) are allowed in a read only transaction
+func isWrite(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	for strings.HasPrefix(sql, "--") || strings.HasPrefix(sql, "/*") {
+		end := "\n"
+		if strings.HasPrefix(sql, "/*") {
+			end = "*/"
+		}
+		i := strings.Index(sql, end)
+		if i < 0 {
+			return false
+		}
+		sql = strings.TrimSpace(sql[i+len(end):])
+	}
+	keyword := strings.FieldsFunc(sql, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	})
+	return len(keyword) > 0 && writeKeywords[strings.ToUpper(keyword[0])]
+}
+
+// run records the statement and returns the expectation it matches. A statement that is unexpected, or that
+// is executed in an aborted transaction or as a write in a read only transaction, fails
+func (d *DB) run(h *handle, kind statementKind, write bool, stmt *Statement) (*Expectation, app.Error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, closedError()
+	}
+	if h.tx != nil {
+		if h.tx.Outcome != Pending {
+			return nil, app.BuildIllegalStateError().
+				Context(stmt.Name).
+				Msg("Statement executed after the transaction completed")
+		}
+		if h.aborted {
+			return nil, db.BuildSqlError().
+				Context(stmt.Name).
+				Str("sql", stmt.SQL).
+				Msg("Current transaction is aborted, commands ignored until end of transaction block")
+		}
+		if write && h.tx.Options.AccessMode == db.ReadOnly {
+			h.aborted = true
+			return nil, app.BuildIllegalStateError().
+				Context(stmt.Name).
+				Str("sql", stmt.SQL).
+				Msg("Cannot execute a write statement in a read-only transaction")
+		}
+	}
+
+	stmt.Tx = h.tx
+	if h.tx == nil {
+		stmt.Outcome = Committed
+	} else {
+		h.executed = append(h.executed, stmt)
+	}
+	d.statements = append(d.statements, stmt)
+
+	for _, e := range d.expectations {
+		if e.matches(kind, stmt) {
+			e.calls++
+			if e.err != nil && h.tx != nil {
+				h.aborted = true
+			}
+			return e, e.err
+		}
+	}
+
+	d.t.Errorf("dbtest: unexpected %s statement '%s': %s %v", kind, stmt.Name, stmt.SQL, stmt.Args)
+	if h.tx != nil {
+		h.aborted = true
+	}
+	return nil, db.BuildSqlError().
+		Context(stmt.Name).
+		Str("sql", stmt.SQL).
+		Msg("Unexpected statement")
+}
+
+func closedError() app.Error {
+	return app.BuildIllegalStateError().Msg("Database is closed")
+}
+
+// handle implements a db.DatabaseHandle executing statements in a transaction, a savepoint, or in
+// autocommit mode if there is no transaction
+type handle struct {
+	db *DB
+	tx *Transaction
+	// executed are the statements executed in the transaction or savepoint of the handle
+	executed []*Statement
+	// aborted is set when a statement fails in a transaction, after which statements fail until it ends
+	aborted bool
+}
+
+func (h *handle) Exec(ctx context.Context, sql string, args ...any) (*db.ExecResult, app.Error) {
+	return h.exec(&Statement{Name: db.StatementNameFrom(ctx), SQL: sql, Args: args})
+}
+
+func (h *handle) exec(stmt *Statement) (*db.ExecResult, app.Error) {
+	e, err := h.db.run(h, execKind, isWrite(stmt.SQL), stmt)
+	if err != nil {
+		return nil, err
+	}
+	result := *e.result
+	return &result, nil
+}
+
+func (h *handle) Query(ctx context.Context, sql string, args ...any) (db.RowIterator, app.Error) {
+	return h.query(&Statement{Name: db.StatementNameFrom(ctx), SQL: sql, Args: args})
+}
+
+func (h *handle) query(stmt *Statement) (db.RowIterator, app.Error) {
+	e, err := h.db.run(h, queryKind, isWrite(stmt.SQL), stmt)
+	if err != nil {
+		return nil, err
+	}
+	return &rowIterator{rows: e.rows}, nil
+}
+
+func (h *handle) QueryRow(ctx context.Context, sql string, args ...any) db.Row {
+	e, err := h.db.run(h, queryKind, isWrite(sql), &Statement{Name: db.StatementNameFrom(ctx), SQL: sql, Args: args})
+	if err != nil {
+		return &row{err: err, sql: sql}
+	}
+	return &row{rows: e.rows, sql: sql}
+}
+
+func (h *handle) ExecFile(filePath string) app.Error {
+	c, err := os.ReadFile(filePath)
+	if err != nil {
+		return app.BuildIOError().
+			Str("file", filePath).
+			Msg("Error reading file")
+	}
+	_, appErr := h.exec(&Statement{Name: filePath, SQL: string(c)})
+	return appErr
+}
+
+func (h *handle) ExecFS(_ context.Context, fsys fs.FS, filePath string) app.Error {
+	c, err := fs.ReadFile(fsys, filePath)
+	if err != nil {
+		return app.BuildIOError().
+			Str("file", filePath).
+			Msg("Error reading file")
+	}
+	_, appErr := h.exec(&Statement{Name: filePath, SQL: string(c)})
+	return appErr
+}
+
+// Insert executes the insert statement, failing if the programmed result has no affected rows
+func (h *handle) Insert(_ context.Context, stmt *db.InsertStatement, args ...any) app.Error {
+	result, err := h.exec(&Statement{Name: stmt.Name, SQL: stmt.SQL, Args: args})
+	if err != nil {
+		err.SetContext(stmt.Name)
+		return err
+	}
+	if result.RowsAffected == 0 {
+		return db.BuildSqlError().
+			Context(stmt.Name).
+			Msg("Record was not inserted")
+	}
+	return nil
+}
+
+// BulkInsert reads the rows of the source into an exec statement named after the table
+func (h *handle) BulkInsert(_ context.Context, table string, columns []string,
+	source db.RowSource) (int64, app.Error) {
+
+	var rows [][]any
+	for source.Next() {
+		values, err := source.Values()
+		if err != nil {
+			return 0, db.BuildSqlError().Cause(err).Context(table).Msg("Error reading the bulk insert rows")
+		}
+		rows = append(rows, values)
+	}
+	if err := source.Err(); err != nil {
+		return 0, db.BuildSqlError().Cause(err).Context(table).Msg("Error reading the bulk insert rows")
+	}
+
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(columns, ", "))
+	if _, err := h.exec(&Statement{Name: table, SQL: sql, Rows: rows}); err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), nil
+}
+
+// SendBatch executes the queued statements in order and returns the first error
+func (h *handle) SendBatch(_ context.Context, batch *db.Batch) app.Error {
+	var firstErr app.Error
+	for _, stmt := range batch.Statements() {
+		reader := &batchReader{handle: h, stmt: stmt}
+		if err := stmt.Read(reader); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Savepoint executes the function in a nested handle whose statements are rolled back if it fails
+func (h *handle) Savepoint(_ context.Context, fn db.TransactionFn) app.Error {
+	if h.tx == nil {
+		return db.BuildSqlError().Msg("SAVEPOINT can only be used in transaction blocks")
+	}
+	nested := &handle{db: h.db, tx: h.tx}
+	fnErr := fn(nested)
+
+	h.db.mu.Lock()
+	defer h.db.mu.Unlock()
+	if fnErr != nil {
+		for _, stmt := range nested.executed {
+			stmt.Outcome = RolledBack
+		}
+		return fnErr
+	}
+	h.executed = append(h.executed, nested.executed...)
+	if nested.aborted {
+		h.aborted = true
+		return db.BuildSqlError().
+			Str("operation", "release savepoint").
+			Msg("Current transaction is aborted, commands ignored until end of transaction block")
+	}
+	return nil
+}
+
+// batchReader implements a db.BatchReader executing a queued statement
+type batchReader struct {
+	handle *handle
+	stmt   *db.QueuedStatement
+}
+
+func (br *batchReader) Exec() (*db.ExecResult, app.Error) {
+	return br.handle.exec(&Statement{Name: br.stmt.Name, SQL: br.stmt.SQL, Args: br.stmt.Args})
+}
+
+func (br *batchReader) Query() (db.RowIterator, app.Error) {
+	return br.handle.query(&Statement{Name: br.stmt.Name, SQL: br.stmt.SQL, Args: br.stmt.Args})
+}
+
+// Notify sends a notification that is received by the next Conn.WaitForNotification call. It blocks once
+// 64 notifications are pending
+func (d *DB) Notify(channel string, payload string) {
+	d.notifications <- &db.Notification{Channel: channel, Payload: payload}
+}
+
+// conn implements a db.Conn
+type conn struct {
+	*handle
+	released bool
+}
+
+func (c *conn) WaitForNotification(ctx context.Context) (*db.Notification, app.Error) {
+	select {
+	case n := <-c.db.notifications:
+		return n, nil
+	case <-ctx.Done():
+		return nil, db.BuildDatabaseError().
+			Cause(ctx.Err()).
+			Msg("Waiting for a notification was cancelled")
+	}
+}
+
+func (c *conn) Release() {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if !c.released {
+		c.released = true
+		c.db.acquired--
+	}
+}
@@ -0,0 +1,244 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type user struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+var getUser = &db.QueryStatement[user]{
+	Name:   "GetUser",
+	SQL:    "SELECT id, name FROM users WHERE id = $1",
+	Mapper: db.StructMapper[user](),
+}
+
+var insertUser = &db.InsertStatement{
+	Name: "InsertUser",
+	SQL:  "INSERT INTO users (name) VALUES ($1)",
+}
+
+// recordingT is a TestingT recording the failures of the test
+type recordingT struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Cleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+// test that query statements are matched by name and arguments and return the programmed rows
+func TestExpectQuery(t *testing.T) {
+	fake := New(t)
+	fake.ExpectQuery("GetUser").WithArgs(int64(1)).
+		WillReturnRows(NewRows("id", "name").AddRow(1, "bob"))
+	fake.ExpectQuery(`FROM users WHERE id`).WithArgs(AnyArg()).WillReturnRows(NewRows("id", "name")).AnyTimes()
+
+	model, err := getUser.QueryRow(context.Background(), fake, int64(1))
+	assert.Nil(t, err)
+	assert.Equal(t, &user{ID: 1, Name: "bob"}, model)
+
+	_, err = getUser.QueryRow(context.Background(), fake, int64(2))
+	assert.NotNil(t, err)
+	assert.Equal(t, app.NotFoundErrorCode, err.Code())
+	assert.Equal(t, "GetUser", err.GetContext())
+
+	statements := fake.Statements()
+	assert.Len(t, statements, 2)
+	assert.Equal(t, "GetUser", statements[0].Name)
+	assert.Equal(t, []any{int64(1)}, statements[0].Args)
+	assert.Equal(t, Committed, statements[0].Outcome)
+}
+
+// test that a programmed error is returned and aborts the transaction, which is rolled back
+func TestTransactionRollback(t *testing.T) {
+	fake := New(t)
+	fake.ExpectExec("InsertUser").WillReturnError(app.BuildAlreadyExistsError().Msg("User exists"))
+
+	err := fake.WriteTransaction(context.Background(), func(handle db.DatabaseHandle) app.Error {
+		if err := handle.Insert(context.Background(), insertUser, "bob"); err != nil {
+			assert.Equal(t, app.AlreadyExistsErrorCode, err.Code())
+			assert.Equal(t, "InsertUser", err.GetContext())
+		}
+		_, err := handle.Exec(context.Background(), "UPDATE users SET name = $1", "alice")
+		return err
+	})
+	assert.NotNil(t, err)
+
+	assert.Len(t, fake.Statements(), 1)
+	assert.Equal(t, RolledBack, fake.Statements()[0].Outcome)
+	assert.Equal(t, RolledBack, fake.Transactions()[0].Outcome)
+	assert.Empty(t, fake.Committed())
+}
+
+// test that the statements of a failed savepoint are rolled back while the transaction commits
+func TestSavepoint(t *testing.T) {
+	fake := New(t)
+	fake.ExpectExec(`^INSERT INTO users`).Times(2)
+
+	err := fake.WriteTransaction(context.Background(), func(handle db.DatabaseHandle) app.Error {
+		if err := handle.Insert(context.Background(), insertUser, "bob"); err != nil {
+			return err
+		}
+		_ = handle.Savepoint(context.Background(), func(nested db.DatabaseHandle) app.Error {
+			_ = nested.Insert(context.Background(), insertUser, "alice")
+			return app.BuildValidationError().Msg("Invalid user")
+		})
+		return nil
+	})
+	assert.Nil(t, err)
+
+	statements := fake.Statements()
+	assert.Equal(t, Committed, statements[0].Outcome)
+	assert.Equal(t, RolledBack, statements[1].Outcome)
+	assert.Equal(t, []any{"bob"}, fake.Committed()[0].Args)
+}
+
+// test that read only transactions reject writes and that a failed commit rolls back
+func TestTransactionSemantics(t *testing.T) {
+	fake := New(t)
+	err := fake.ReadTransaction(context.Background(), func(handle db.DatabaseHandle) app.Error {
+		_, err := handle.Exec(context.Background(), "DELETE FROM users")
+		return err
+	})
+	assert.NotNil(t, err)
+	assert.Empty(t, fake.Statements())
+
+	fake.ExpectExec("DELETE FROM users")
+	fake.FailCommit(db.BuildTransactionConflictError().Msg("Conflict"))
+	err = fake.WriteTransaction(context.Background(), func(handle db.DatabaseHandle) app.Error {
+		_, err := handle.Exec(context.Background(), "DELETE FROM users")
+		return err
+	})
+	assert.True(t, db.IsTransactionConflict(err))
+	assert.Equal(t, RolledBack, fake.Statements()[0].Outcome)
+}
+
+// test that statements that do not write are allowed in read only transactions
+func TestReadOnlyTransactionAllowsNonWrites(t *testing.T) {
+	fake := New(t)
+	fake.ExpectExec(`^SET LOCAL statement_timeout`)
+	fake.ExpectExec(`pg_advisory_xact_lock`)
+	err := fake.ReadTransaction(context.Background(), func(handle db.DatabaseHandle) app.Error {
+		if _, err := handle.Exec(context.Background(), "SET LOCAL statement_timeout = 5000"); err != nil {
+			return err
+		}
+		_, err := handle.Exec(context.Background(), "SELECT pg_advisory_xact_lock($1)", int64(1))
+		return err
+	})
+	assert.Nil(t, err)
+
+	err = fake.ReadTransaction(context.Background(), func(handle db.DatabaseHandle) app.Error {
+		_, err := handle.Query(context.Background(), "INSERT INTO users (name) VALUES ($1) RETURNING id", "bob")
+		return err
+	})
+	assert.NotNil(t, err)
+}
+
+// test that writes are recognized by the leading keyword of the statement
+func TestIsWrite(t *testing.T) {
+	assert.True(t, isWrite("  insert into users (name) values ($1)"))
+	assert.True(t, isWrite("-- remove them\n/* all */ DELETE FROM users"))
+	assert.True(t, isWrite("COPY users (name) FROM STDIN"))
+	assert.False(t, isWrite("SELECT * FROM users"))
+	assert.False(t, isWrite("(SELECT 1)"))
+	assert.False(t, isWrite("SET LOCAL statement_timeout = 5000"))
+	assert.False(t, isWrite("-- only a comment"))
+}
+
+// test that batches and bulk inserts are matched per statement
+func TestBatchAndBulkInsert(t *testing.T) {
+	fake := New(t)
+	fake.ExpectExec("InsertUser").WithArgs("bob")
+	fake.ExpectQuery("GetUser").WillReturnRows(NewRows("id", "name").AddRow(int64(1), "bob"))
+	fake.ExpectExec("users")
+
+	batch := &db.Batch{}
+	inserted := batch.Insert(insertUser, "bob")
+	users := db.QueueQuery(batch, getUser, int64(1))
+	err := fake.WriteTransaction(context.Background(), func(handle db.DatabaseHandle) app.Error {
+		if err := handle.SendBatch(context.Background(), batch); err != nil {
+			return err
+		}
+		count, err := handle.BulkInsert(context.Background(), "users", []string{"name"},
+			db.RowsFromSlice([][]any{{"a"}, {"b"}}))
+		assert.Equal(t, int64(2), count)
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, inserted.Err)
+	assert.Equal(t, []*user{{ID: 1, Name: "bob"}}, users.Rows)
+	assert.Equal(t, [][]any{{"a"}, {"b"}}, fake.Statements()[2].Rows)
+}
+
+// test that unexpected statements, unmet expectations and unreleased connections fail the test
+func TestAssertExpectations(t *testing.T) {
+	rt := &recordingT{}
+	fake := New(rt)
+	fake.ExpectQuery("GetUser")
+
+	_, err := fake.Exec(context.Background(), "DELETE FROM users")
+	assert.NotNil(t, err)
+	_, err = fake.Acquire(context.Background())
+	assert.Nil(t, err)
+
+	for _, cleanup := range rt.cleanups {
+		cleanup()
+	}
+	assert.Len(t, rt.errors, 3)
+	assert.Contains(t, rt.errors[0], "unexpected exec statement")
+	assert.Contains(t, rt.errors[1], "query 'GetUser' matched 0 of 1 statements")
+	assert.Contains(t, rt.errors[2], "1 acquired connections were not released")
+}
+
+// test that values are converted to the scan destinations
+func TestAssign(t *testing.T) {
+	var i int64
+	var f float64
+	var s *string
+	assert.Nil(t, assign(&i, 3))
+	assert.Nil(t, assign(&f, int32(2)))
+	assert.Nil(t, assign(&s, "a"))
+	assert.Equal(t, int64(3), i)
+	assert.Equal(t, float64(2), f)
+	assert.Equal(t, "a", *s)
+
+	assert.Nil(t, assign(&s, nil))
+	assert.Nil(t, s)
+	assert.NotNil(t, assign(&i, nil))
+	assert.NotNil(t, assign(&i, "3"))
+}
+
+// test that notifications are received by acquired connections until the context is done
+func TestWaitForNotification(t *testing.T) {
+	fake := New(t)
+	conn, err := fake.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Error acquiring connection: %s", err.Error())
+	}
+	defer conn.Release()
+
+	fake.Notify("events", "created")
+	n, err := conn.WaitForNotification(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &db.Notification{Channel: "events", Payload: "created"}, n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = conn.WaitForNotification(ctx)
+	assert.NotNil(t, err)
+}
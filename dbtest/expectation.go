@@ -0,0 +1,151 @@
+package dbtest
+
+import (
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"reflect"
+	"regexp"
+)
+
+// statementKind tells queries, which return rows, from statements that return an db.ExecResult
+type statementKind int
+
+const (
+	queryKind statementKind = iota
+	execKind
+)
+
+func (k statementKind) String() string {
+	if k == queryKind {
+		return "query"
+	}
+	return "exec"
+}
+
+// Argument matches a statement argument given to Expectation.WithArgs, for arguments whose value is not
+// known upfront (ex. a generated id or timestamp)
+type Argument interface {
+	Match(value any) bool
+}
+
+// ArgumentFunc is an Argument matching the values for which the function returns true
+type ArgumentFunc func(value any) bool
+
+func (f ArgumentFunc) Match(value any) bool {
+	return f(value)
+}
+
+// AnyArg matches any argument value
+func AnyArg() Argument {
+	return ArgumentFunc(func(any) bool { return true })
+}
+
+// Expectation is the programmed result of the statements matching its name or SQL pattern. It matches a
+// single statement unless Times or AnyTimes is called
+type Expectation struct {
+	kind    statementKind
+	pattern string
+	sql     *regexp.Regexp
+	args    []any
+	anyArgs bool
+	rows    *Rows
+	result  *db.ExecResult
+	err     app.Error
+	// times is the number of statements that are expected to match, or -1 for any number
+	times int
+	calls int
+}
+
+func newExpectation(kind statementKind, pattern string) *Expectation {
+	sql, err := regexp.Compile(pattern)
+	if err != nil {
+		sql = regexp.MustCompile(regexp.QuoteMeta(pattern))
+	}
+	return &Expectation{
+		kind:    kind,
+		pattern: pattern,
+		sql:     sql,
+		anyArgs: true,
+		rows:    NewRows(),
+		result:  &db.ExecResult{RowsAffected: 1},
+		times:   1,
+	}
+}
+
+// WithArgs restricts the expectation to the statements executed with the given arguments. Arguments are
+// compared with reflect.DeepEqual unless they are an Argument
+func (e *Expectation) WithArgs(args ...any) *Expectation {
+	e.args = args
+	e.anyArgs = false
+	return e
+}
+
+// WillReturnRows sets the rows returned by the matching queries
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult sets the result of the matching statements. It defaults to one affected row
+func (e *Expectation) WillReturnResult(result *db.ExecResult) *Expectation {
+	e.result = result
+	return e
+}
+
+// WillReturnError makes the matching statements fail with the error
+func (e *Expectation) WillReturnError(err app.Error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times sets the number of statements that are expected to match
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes lets any number of statements match, including none
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+// matches returns true if the expectation applies to the statement and has not been used up
+func (e *Expectation) matches(kind statementKind, stmt *Statement) bool {
+	if e.kind != kind || (e.times >= 0 && e.calls >= e.times) {
+		return false
+	}
+	if stmt.Name != e.pattern && !e.sql.MatchString(stmt.SQL) {
+		return false
+	}
+	return e.anyArgs || argsMatch(e.args, stmt.Args)
+}
+
+// unmet returns a description of the expectation if fewer statements than expected matched it
+func (e *Expectation) unmet() string {
+	if e.times < 0 || e.calls >= e.times {
+		return ""
+	}
+	description := fmt.Sprintf("%s '%s' matched %d of %d statements", e.kind, e.pattern, e.calls, e.times)
+	if !e.anyArgs {
+		description += fmt.Sprintf(" with arguments %v", e.args)
+	}
+	return description
+}
+
+func argsMatch(expected []any, actual []any) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i, arg := range expected {
+		if matcher, ok := arg.(Argument); ok {
+			if !matcher.Match(actual[i]) {
+				return false
+			}
+		} else if !reflect.DeepEqual(arg, actual[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"reflect"
+)
+
+// Rows are the result rows of an expected query
+type Rows struct {
+	columns []string
+	values  [][]any
+}
+
+// NewRows creates an empty result with the given columns
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+// AddRow adds a row with a value per column. It panics if the number of values does not match the columns
+func (r *Rows) AddRow(values ...any) *Rows {
+	if len(values) != len(r.columns) {
+		panic(fmt.Sprintf("dbtest: row has %d values for %d columns", len(values), len(r.columns)))
+	}
+	r.values = append(r.values, values)
+	return r
+}
+
+// rowIterator implements a db.RowIterator and a db.ColumnScanner over Rows
+type rowIterator struct {
+	rows   *Rows
+	index  int
+	closed bool
+}
+
+func (it *rowIterator) Columns() []string {
+	return it.rows.columns
+}
+
+func (it *rowIterator) Close() {
+	it.closed = true
+}
+
+func (it *rowIterator) Err() app.Error {
+	return nil
+}
+
+func (it *rowIterator) Next() bool {
+	if it.closed || it.index >= len(it.rows.values) {
+		it.closed = true
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *rowIterator) Scan(dest ...any) app.Error {
+	if it.index == 0 || it.index > len(it.rows.values) {
+		return app.BuildIllegalStateError().Msg("Scan called without a current row")
+	}
+	return scanValues(it.rows.values[it.index-1], dest)
+}
+
+func (it *rowIterator) Values() ([]any, app.Error) {
+	if it.index == 0 || it.index > len(it.rows.values) {
+		return nil, app.BuildIllegalStateError().Msg("Values called without a current row")
+	}
+	return append([]any(nil), it.rows.values[it.index-1]...), nil
+}
+
+// row implements a db.Row and a db.ColumnScanner over the first row of Rows. Any error is deferred until
+// Scan is called
+type row struct {
+	rows *Rows
+	err  app.Error
+	sql  string
+}
+
+func (r *row) Columns() []string {
+	if r.err != nil {
+		return nil
+	}
+	return r.rows.columns
+}
+
+func (r *row) Close() {
+}
+
+func (r *row) Scan(dest ...any) app.Error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.rows.values) == 0 {
+		return app.BuildNotFoundError().
+			Str("sql", r.sql).
+			Str("operation", "single-row query").
+			Msg("Query returned no rows")
+	}
+	return scanValues(r.rows.values[0], dest)
+}
+
+// scanValues assigns the values of a row to the scan destinations
+func scanValues(values []any, dest []any) app.Error {
+	if len(dest) != len(values) {
+		return app.BuildIllegalArgumentError().
+			Msgf("Expected %d scan destinations but got %d", len(values), len(dest))
+	}
+	for i, d := range dest {
+		if d == nil {
+			continue
+		}
+		if err := assign(d, values[i]); err != nil {
+			return db.BuildSqlError().
+				Cause(err).
+				Msgf("Unable to scan column %d", i)
+		}
+	}
+	return nil
+}
+
+// assign sets the value into the destination pointer, converting between numeric types and between string
+// types the way a database driver would
+func assign(dest any, value any) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("destination %T is not a non nil pointer", dest)
+	}
+	target = target.Elem()
+
+	if value == nil {
+		switch target.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %s", target.Type())
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type().AssignableTo(target.Type()):
+		target.Set(v)
+	case target.Kind() == reflect.Pointer:
+		ptr := reflect.New(target.Type().Elem())
+		if err := assign(ptr.Interface(), value); err != nil {
+			return err
+		}
+		target.Set(ptr)
+	case isNumeric(v.Kind()) == isNumeric(target.Kind()) && v.Type().ConvertibleTo(target.Type()):
+		target.Set(v.Convert(target.Type()))
+	default:
+		return fmt.Errorf("cannot scan %T into %s", value, target.Type())
+	}
+	return nil
+}
+
+func isNumeric(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
@@ -0,0 +1,187 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"io"
+	"os"
+)
+
+// NewClientConn creates a connection to the grpc service described in the given ClientConfig. The connection
+// translates failed calls into app.Errors, retries codes configured as retryable, traces calls and records
+// the count and duration of unary calls. Additional dial options
+// are appended after the ones derived from the config.
+func NewClientConn(cfg *ClientConfig, opts ...grpclib.DialOption) (*grpclib.ClientConn, app.Error) {
+
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dialOpts := []grpclib.DialOption{
+		grpclib.WithTransportCredentials(creds),
+		grpclib.WithChainUnaryInterceptor(unaryClientTracingInterceptor(), unaryClientMetricsInterceptor(cfg.Name),
+			UnaryClientInterceptor(cfg)),
+		grpclib.WithChainStreamInterceptor(streamClientTracingInterceptor(), StreamClientInterceptor(cfg)),
+	}
+	if cfg.KeepaliveTime > 0 {
+		dialOpts = append(dialOpts, grpclib.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}))
+	}
+	dialOpts = append(dialOpts, opts...)
+
+	conn, e := grpclib.Dial(cfg.Target, dialOpts...)
+	if e != nil {
+		return nil, app.BuildSysConfigError().Cause(e).
+			Str("client", cfg.Name).
+			Str("target", cfg.Target).
+			Msg("Error creating grpc client connection")
+	}
+
+	logger.Info().
+		Str("client", cfg.Name).
+		Str("target", cfg.Target).
+		Bool("tls", cfg.TLSEnabled).
+		Msg("Created grpc client connection")
+
+	return conn, nil
+}
+
+// UnaryClientInterceptor applies the default deadline of the ClientConfig, retries calls failing with a
+// retryable code and converts the final status into an app.Error
+func UnaryClientInterceptor(cfg *ClientConfig) grpclib.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpclib.ClientConn,
+		invoker grpclib.UnaryInvoker, opts ...grpclib.CallOption) error {
+
+		if _, hasDeadline := ctx.Deadline(); !hasDeadline && cfg.Deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.Deadline)
+			defer cancel()
+		}
+
+		err := withRetries(ctx, cfg, method, func() error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+		if err != nil {
+			return FromStatus(err)
+		}
+		return nil
+	}
+}
+
+// StreamClientInterceptor retries the creation of a stream failing with a retryable code and converts
+// statuses returned by the stream into app.Errors. Streams are not subject to the default deadline.
+func StreamClientInterceptor(cfg *ClientConfig) grpclib.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpclib.StreamDesc, cc *grpclib.ClientConn, method string,
+		streamer grpclib.Streamer, opts ...grpclib.CallOption) (grpclib.ClientStream, error) {
+
+		var stream grpclib.ClientStream
+		err := withRetries(ctx, cfg, method, func() error {
+			var e error
+			stream, e = streamer(ctx, desc, cc, method, opts...)
+			return e
+		})
+		if err != nil {
+			return nil, FromStatus(err)
+		}
+		return &clientStream{ClientStream: stream}, nil
+	}
+}
+
+// withRetries invokes the call until it succeeds, fails with a code that is not retryable or the
+// configured max attempts are reached
+func withRetries(ctx context.Context, cfg *ClientConfig, method string, call func() error) error {
+	var err error
+	for attempt := uint(1); ; attempt++ {
+		if err = call(); err == nil {
+			return nil
+		}
+
+		code := status.Code(err)
+		if attempt >= cfg.MaxAttempts || !cfg.IsRetryable(code) {
+			return err
+		}
+
+		logger.Debug().
+			Str("client", cfg.Name).
+			Str("method", method).
+			Str("code", code.String()).
+			Uint("attempt", attempt).
+			Msg("Retrying grpc call")
+
+		if e := cfg.Backoff.Wait(ctx, int(attempt)); e != nil {
+			return err
+		}
+	}
+}
+
+// clientStream converts the statuses returned while sending and receiving messages into app.Errors
+type clientStream struct {
+	grpclib.ClientStream
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	return translateStreamError(s.ClientStream.SendMsg(m))
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	return translateStreamError(s.ClientStream.RecvMsg(m))
+}
+
+func translateStreamError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return FromStatus(err)
+}
+
+// transportCredentials creates the transport credentials described in the ClientConfig
+func transportCredentials(cfg *ClientConfig) (credentials.TransportCredentials, app.Error) {
+	if !cfg.TLSEnabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.TLSServerName,
+	}
+
+	if cfg.TLSCaFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCaFile)
+		if err != nil {
+			return nil, app.BuildIOError().Cause(err).
+				Str("file", cfg.TLSCaFile).
+				Msg("Error reading grpc CA certificate file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, app.BuildSysConfigError().
+				Str("file", cfg.TLSCaFile).
+				Msg("No certificates found in grpc CA certificate file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, app.BuildSysConfigError().Cause(err).
+				Str("certFile", cfg.TLSCertFile).
+				Str("keyFile", cfg.TLSKeyFile).
+				Msg("Error loading grpc client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
@@ -0,0 +1,305 @@
+package grpc
+
+import (
+	"fmt"
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	"google.golang.org/grpc/codes"
+	"strings"
+	"time"
+)
+
+const targetFieldName = "grpcTarget"
+const tlsEnabledFieldName = "grpcTlsEnabled"
+const tlsCaFileFieldName = "grpcTlsCaFile"
+const tlsCertFileFieldName = "grpcTlsCertFile"
+const tlsKeyFileFieldName = "grpcTlsKeyFile"
+const tlsServerNameFieldName = "grpcTlsServerName"
+const deadlineFieldName = "grpcDeadline"
+const maxAttemptsFieldName = "grpcMaxAttempts"
+const initialBackoffFieldName = "grpcInitialBackoff"
+const maxBackoffFieldName = "grpcMaxBackoff"
+const backoffMultiplierFieldName = "grpcBackoffMultiplier"
+const retryableCodesFieldName = "grpcRetryableCodes"
+const keepaliveTimeFieldName = "grpcKeepaliveTime"
+const keepaliveTimeoutFieldName = "grpcKeepaliveTimeout"
+
+// ClientConfig contains the values required to create a connection to a grpc service
+type ClientConfig struct {
+	Name           string
+	Target         string
+	TLSEnabled     bool
+	TLSCaFile      string
+	TLSCertFile    string
+	TLSKeyFile     string
+	TLSServerName  string
+	Deadline       time.Duration
+	MaxAttempts    uint
+	Backoff        pinion.Backoff
+	RetryableCodes []codes.Code
+	KeepaliveTime  time.Duration
+	// KeepaliveTimeout is only applied if KeepaliveTime is set
+	KeepaliveTimeout time.Duration
+}
+
+// IsRetryable returns true if the given status code is configured to be retried
+func (c *ClientConfig) IsRetryable(code codes.Code) bool {
+	for _, rc := range c.RetryableCodes {
+		if rc == code {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterClientConfig will register the config field definitions needed for connecting to the grpc service
+// with the given client name. The fields are read from the "GrpcClient.<name>" ini section, command line
+// arguments prefixed with "<name>-grpc-" and environment variables prefixed with "<NAME>_GRPC_".
+func RegisterClientConfig(reg *app.FieldRegistry, name string) {
+	section := clientSectionName(name)
+
+	// service target (Required)
+	// ex. dns:///users.internal:9090
+	reg.CreateStringField(clientFieldName(name, targetFieldName)).
+		ArgName(clientArgName(name, "target")).
+		EnvVar(clientEnvVar(name, "TARGET")).
+		ConfigName(section, "Target").
+		ShortDesc("Grpc service target").
+		Required().
+		Register()
+
+	// use transport security
+	reg.CreateBooleanField(clientFieldName(name, tlsEnabledFieldName)).
+		ArgName(clientArgName(name, "tls")).
+		EnvVar(clientEnvVar(name, "TLS")).
+		ConfigName(section, "TLS").
+		ShortDesc("Use TLS when connecting to the grpc service").
+		Default(false).
+		Register()
+
+	// CA certificate used to verify the server. The system roots are used if not set
+	reg.CreateStringField(clientFieldName(name, tlsCaFileFieldName)).
+		ArgName(clientArgName(name, "tls-ca-file")).
+		EnvVar(clientEnvVar(name, "TLS_CA_FILE")).
+		ConfigName(section, "TLSCaFile").
+		ShortDesc("Grpc TLS CA certificate file").
+		Register()
+
+	// client certificate for mutual TLS
+	reg.CreateStringField(clientFieldName(name, tlsCertFileFieldName)).
+		ArgName(clientArgName(name, "tls-cert-file")).
+		EnvVar(clientEnvVar(name, "TLS_CERT_FILE")).
+		ConfigName(section, "TLSCertFile").
+		ShortDesc("Grpc TLS client certificate file").
+		Register()
+
+	// client key for mutual TLS
+	reg.CreateStringField(clientFieldName(name, tlsKeyFileFieldName)).
+		ArgName(clientArgName(name, "tls-key-file")).
+		EnvVar(clientEnvVar(name, "TLS_KEY_FILE")).
+		ConfigName(section, "TLSKeyFile").
+		ShortDesc("Grpc TLS client key file").
+		Register()
+
+	// overrides the server name used to verify the server certificate
+	reg.CreateStringField(clientFieldName(name, tlsServerNameFieldName)).
+		ArgName(clientArgName(name, "tls-server-name")).
+		EnvVar(clientEnvVar(name, "TLS_SERVER_NAME")).
+		ConfigName(section, "TLSServerName").
+		ShortDesc("Grpc TLS server name override").
+		Register()
+
+	// deadline applied to unary calls whose context has no deadline
+	reg.CreateStringField(clientFieldName(name, deadlineFieldName)).
+		ArgName(clientArgName(name, "deadline")).
+		EnvVar(clientEnvVar(name, "DEADLINE")).
+		ConfigName(section, "Deadline").
+		ShortDesc("Default grpc call deadline").
+		Default("10s").
+		Register()
+
+	// max attempts (including the first) for calls failing with a retryable code
+	reg.CreateUintField(clientFieldName(name, maxAttemptsFieldName)).
+		ArgName(clientArgName(name, "max-attempts")).
+		ConfigName(section, "MaxAttempts").
+		ShortDesc("Max number of attempts for a grpc call").
+		Default(3).
+		Register()
+
+	reg.CreateStringField(clientFieldName(name, initialBackoffFieldName)).
+		ArgName(clientArgName(name, "initial-backoff")).
+		ConfigName(section, "InitialBackoff").
+		ShortDesc("Backoff before the first grpc retry").
+		Default(pinion.DefaultBackoff.Initial.String()).
+		Register()
+
+	reg.CreateStringField(clientFieldName(name, maxBackoffFieldName)).
+		ArgName(clientArgName(name, "max-backoff")).
+		ConfigName(section, "MaxBackoff").
+		ShortDesc("Max backoff between grpc retries").
+		Default(pinion.DefaultBackoff.Max.String()).
+		Register()
+
+	reg.CreateFloatField(clientFieldName(name, backoffMultiplierFieldName)).
+		ArgName(clientArgName(name, "backoff-multiplier")).
+		ConfigName(section, "BackoffMultiplier").
+		ShortDesc("Growth factor of the backoff between grpc retries").
+		Default(pinion.DefaultBackoff.Multiplier).
+		Register()
+
+	// comma separated list of status codes
+	// ex. UNAVAILABLE,RESOURCE_EXHAUSTED
+	reg.CreateStringField(clientFieldName(name, retryableCodesFieldName)).
+		ArgName(clientArgName(name, "retryable-codes")).
+		ConfigName(section, "RetryableCodes").
+		ShortDesc("Grpc status codes that are retried").
+		Default("UNAVAILABLE").
+		Register()
+
+	// keepalive ping interval, keepalive is disabled if not set
+	reg.CreateStringField(clientFieldName(name, keepaliveTimeFieldName)).
+		ArgName(clientArgName(name, "keepalive-time")).
+		ConfigName(section, "KeepaliveTime").
+		ShortDesc("Grpc keepalive ping interval").
+		Register()
+
+	reg.CreateStringField(clientFieldName(name, keepaliveTimeoutFieldName)).
+		ArgName(clientArgName(name, "keepalive-timeout")).
+		ConfigName(section, "KeepaliveTimeout").
+		ShortDesc("Grpc keepalive ping acknowledgement timeout").
+		Default("20s").
+		Register()
+}
+
+// NewClientConfig creates a ClientConfig for the given client name from the parsed app.Configuration
+func NewClientConfig(cfg *app.Configuration, name string) (*ClientConfig, app.Error) {
+
+	target, err := cfg.GetStringValue(clientFieldName(name, targetFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsEnabled, err := cfg.GetBoolValue(clientFieldName(name, tlsEnabledFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCaFile, err := cfg.GetStringValue(clientFieldName(name, tlsCaFileFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCertFile, err := cfg.GetStringValue(clientFieldName(name, tlsCertFileFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsKeyFile, err := cfg.GetStringValue(clientFieldName(name, tlsKeyFileFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsServerName, err := cfg.GetStringValue(clientFieldName(name, tlsServerNameFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, err := cfg.GetDurationValue(clientFieldName(name, deadlineFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	maxAttempts, err := cfg.GetUintValue(clientFieldName(name, maxAttemptsFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	initialBackoff, err := cfg.GetDurationValue(clientFieldName(name, initialBackoffFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	maxBackoff, err := cfg.GetDurationValue(clientFieldName(name, maxBackoffFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	backoffMultiplier, err := cfg.GetFloatValue(clientFieldName(name, backoffMultiplierFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	rawCodes, err := cfg.GetStringValue(clientFieldName(name, retryableCodesFieldName))
+	if err != nil {
+		return nil, err
+	}
+	retryableCodes, err := parseCodes(*rawCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	keepaliveTime, err := cfg.GetDurationValue(clientFieldName(name, keepaliveTimeFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	keepaliveTimeout, err := cfg.GetDurationValue(clientFieldName(name, keepaliveTimeoutFieldName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientConfig{
+		Name:          name,
+		Target:        *target,
+		TLSEnabled:    *tlsEnabled,
+		TLSCaFile:     *tlsCaFile,
+		TLSCertFile:   *tlsCertFile,
+		TLSKeyFile:    *tlsKeyFile,
+		TLSServerName: *tlsServerName,
+		Deadline:      *deadline,
+		MaxAttempts:   *maxAttempts,
+		Backoff: pinion.Backoff{
+			Initial:    *initialBackoff,
+			Max:        *maxBackoff,
+			Multiplier: *backoffMultiplier,
+		},
+		RetryableCodes:   retryableCodes,
+		KeepaliveTime:    *keepaliveTime,
+		KeepaliveTimeout: *keepaliveTimeout,
+	}, nil
+}
+
+// parseCodes parses a comma separated list of grpc status code names
+func parseCodes(value string) ([]codes.Code, app.Error) {
+	result := make([]codes.Code, 0)
+	for _, raw := range strings.Split(value, ",") {
+		name := strings.ToUpper(strings.TrimSpace(raw))
+		if name == "" {
+			continue
+		}
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(`"` + name + `"`)); err != nil {
+			return nil, app.BuildSysConfigError().Cause(err).
+				Str("code", raw).
+				Msg("Unknown grpc status code")
+		}
+		result = append(result, code)
+	}
+	return result, nil
+}
+
+func clientSectionName(name string) string {
+	return "GrpcClient." + name
+}
+
+func clientFieldName(name string, field string) string {
+	return fmt.Sprintf("%s.%s", name, field)
+}
+
+func clientArgName(name string, arg string) string {
+	return fmt.Sprintf("%s-grpc-%s", name, arg)
+}
+
+func clientEnvVar(name string, envVar string) string {
+	return fmt.Sprintf("%s_GRPC_%s", strings.ToUpper(strings.ReplaceAll(name, "-", "_")), envVar)
+}
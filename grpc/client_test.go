@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"context"
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func testClientConfig() *ClientConfig {
+	return &ClientConfig{
+		Name:           "test",
+		Deadline:       time.Second,
+		MaxAttempts:    3,
+		Backoff:        pinion.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1},
+		RetryableCodes: []codes.Code{codes.Unavailable},
+	}
+}
+
+// Retryable codes should be retried until the max attempts are reached and then converted to an app.Error
+func TestUnaryClientInterceptor_RetriesRetryableCodes(t *testing.T) {
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpclib.ClientConn,
+		opts ...grpclib.CallOption) error {
+		attempts++
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	err := UnaryClientInterceptor(testClientConfig())(context.Background(), "/svc/Method", nil, nil, nil, invoker)
+	assert.Equal(t, 3, attempts)
+	appErr, ok := err.(app.Error)
+	assert.True(t, ok)
+	assert.Equal(t, app.ServiceUnavailableErrorCode, appErr.Code())
+}
+
+// Codes that are not retryable should fail on the first attempt
+func TestUnaryClientInterceptor_DoesNotRetryOtherCodes(t *testing.T) {
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpclib.ClientConn,
+		opts ...grpclib.CallOption) error {
+		attempts++
+		_, err := ToStatus(app.NewNotFoundError("no such user"))
+		return err
+	}
+
+	err := UnaryClientInterceptor(testClientConfig())(context.Background(), "/svc/Method", nil, nil, nil, invoker)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, app.NotFoundErrorCode, err.(app.Error).Code())
+	assert.Equal(t, "no such user", app.MessageOf(err.(app.Error)))
+}
+
+// A call that succeeds after a retry should not return an error
+func TestUnaryClientInterceptor_SucceedsAfterRetry(t *testing.T) {
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpclib.ClientConn,
+		opts ...grpclib.CallOption) error {
+		attempts++
+		if attempts == 1 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	}
+
+	err := UnaryClientInterceptor(testClientConfig())(context.Background(), "/svc/Method", nil, nil, nil, invoker)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestParseCodes(t *testing.T) {
+	c, err := parseCodes(" unavailable, RESOURCE_EXHAUSTED ,")
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.ResourceExhausted}, c)
+
+	_, err = parseCodes("NOT_A_CODE")
+	assert.Equal(t, app.SystemConfigurationErrorCode, err.Code())
+}
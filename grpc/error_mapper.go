@@ -1,38 +1,258 @@
 package grpc
 
 import (
+	"github.com/golang/protobuf/proto"
 	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"sort"
+	"strconv"
+	"time"
 )
 
+// ErrorDomain is the google.rpc.ErrorInfo domain attached to statuses created from an app.Error
+const ErrorDomain = "pinion"
+
+// google.rpc.ErrorInfo metadata keys carrying the app.Error fields that are not metadata. They take
+// precedence over the metadata of the app.Error with the same keys
+const codeMetadataKey = "code"
+const contextMetadataKey = "context"
+
+// DefaultRetryDelay is the delay advertised in the google.rpc.RetryInfo of service unavailable statuses if
+// the StatusOptions do not set one
+const DefaultRetryDelay = time.Second
+
+// StatusOptions configure the statuses created by ToStatusWithOptions
+type StatusOptions struct {
+	// RetryDelay is the delay advertised in the google.rpc.RetryInfo of service unavailable statuses
+	RetryDelay time.Duration
+}
+
 // ToStatus will return the corresponding status.Error for the given app.Error. If the app.Error cannot
-// be identified then false will be returned
+// be identified then false will be returned. The default StatusOptions are used
 func ToStatus(err app.Error) (bool, error) {
+	return ToStatusWithOptions(err, nil)
+}
+
+// ToStatusWithOptions will return the corresponding status.Error for the given app.Error. If the app.Error
+// cannot be identified then false will be returned. If opts is nil then the defaults are used.
+//
+// The status message is the message of the app.Error, and the status carries a google.rpc.ErrorInfo detail
+// (reason = CodeValue(), metadata = GetMetadata() with the code and context) so that FromStatus can
+// reconstruct the app.Error on the client side. Validation errors additionally carry a google.rpc.BadRequest
+// detail with a field violation per metadata entry and service unavailable errors carry a
+// google.rpc.RetryInfo detail. Internal, unavailable and deadline exceeded statuses only carry the code of the
+// app.Error, so that its message, context, metadata and cause are not leaked to the client
+func ToStatusWithOptions(err app.Error, opts *StatusOptions) (bool, error) {
+	found, code := GetStatusCode(err)
+	if !found {
+		return false, nil
+	}
+	retryDelay := DefaultRetryDelay
+	if opts != nil && opts.RetryDelay > 0 {
+		retryDelay = opts.RetryDelay
+	}
+
+	message := app.MessageOf(err)
+	if isServerError(code) {
+		message = code.String()
+	}
+	st := status.New(code, message)
+	withDetails, e := st.WithDetails(buildDetails(err, code, retryDelay)...)
+	if e != nil {
+		// fall back to the flattened status if the details cannot be marshalled
+		return true, st.Err()
+	}
+	return true, withDetails.Err()
+}
+
+// isServerError returns true for the status codes of failures of the server, whose details are not sent
+func isServerError(code codes.Code) bool {
+	return code == codes.Internal || code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+// GetStatusCode returns the grpc codes.Code for the given app.Error. If the error code is unknown
+// then false is returned
+func GetStatusCode(err app.Error) (bool, codes.Code) {
 	switch err.Code() {
 	case app.InternalErrorCode:
 		fallthrough
 	case app.IllegalArgumentError:
 		fallthrough
 	case app.SystemConfigurationErrorCode:
-		return true, status.Error(codes.Internal, err.Error())
+		return true, codes.Internal
 
 	case app.ServiceUnavailableErrorCode:
-		return true, status.Error(codes.Unavailable, err.Error())
+		return true, codes.Unavailable
 
 	case app.ValidationErrorCode:
-		return true, status.Error(codes.InvalidArgument, err.Error())
+		return true, codes.InvalidArgument
 
 	case app.IllegalStateErrorCode:
-		return true, status.Error(codes.FailedPrecondition, err.Error())
+		return true, codes.FailedPrecondition
 
 	case app.NotFoundErrorCode:
-		return true, status.Error(codes.NotFound, err.Error())
+		return true, codes.NotFound
 
 	case app.AlreadyExistsErrorCode:
-		return true, status.Error(codes.AlreadyExists, err.Error())
+		return true, codes.AlreadyExists
+
+	case db.TransactionConflictErrorCode:
+		fallthrough
+	case db.TransactionRetriesExhaustedErrorCode:
+		return true, codes.Aborted
+
+	case db.TimeoutErrorCode:
+		return true, codes.DeadlineExceeded
 
 	default:
-		return false, nil
+		return false, codes.Unknown
+	}
+}
+
+// FromStatus reconstructs an app.Error from an error returned by a grpc call. If the status was created by
+// ToStatus then the original error code, code value, context, message and metadata are restored. Otherwise
+// the error is mapped using the grpc status code. A nil error or an OK status results in nil and errors that
+// are already an app.Error are returned as is.
+func FromStatus(err error) app.Error {
+	if err == nil {
+		return nil
+	}
+	if appErr, isAppErr := err.(app.Error); isAppErr {
+		return appErr
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return app.BuildInternalError().Cause(err).
+			Msg("grpc call failed with a non status error")
+	}
+	if st.Code() == codes.OK {
+		return nil
+	}
+
+	// use the error info attached by ToStatus if present
+	for _, detail := range st.Details() {
+		info, isInfo := detail.(*errdetails.ErrorInfo)
+		if isInfo && info.GetDomain() == ErrorDomain {
+			return fromErrorInfo(info, st)
+		}
+	}
+
+	// map the status code
+	builder := buildErrorFromCode(st.Code()).Cause(err)
+	for _, detail := range st.Details() {
+		if badRequest, isBadRequest := detail.(*errdetails.BadRequest); isBadRequest {
+			for _, v := range badRequest.GetFieldViolations() {
+				builder.Str(v.GetField(), v.GetDescription())
+			}
+		}
+	}
+	return builder.Msg(st.Message())
+}
+
+// buildErrorFromCode returns the app.ErrorBuilder corresponding to the given grpc status code
+func buildErrorFromCode(code codes.Code) *app.ErrorBuilder {
+	switch code {
+	case codes.Unavailable:
+		fallthrough
+	case codes.DeadlineExceeded:
+		fallthrough
+	case codes.ResourceExhausted:
+		return app.BuildSvcUnavailableError()
+
+	case codes.InvalidArgument:
+		fallthrough
+	case codes.OutOfRange:
+		return app.BuildValidationError()
+
+	case codes.FailedPrecondition:
+		fallthrough
+	case codes.Aborted:
+		return app.BuildIllegalStateError()
+
+	case codes.NotFound:
+		return app.BuildNotFoundError()
+
+	case codes.AlreadyExists:
+		return app.BuildAlreadyExistsError()
+
+	default:
+		return app.BuildInternalError()
+	}
+}
+
+// fromErrorInfo reconstructs the app.Error described in the given ErrorInfo
+func fromErrorInfo(info *errdetails.ErrorInfo, st *status.Status) app.Error {
+
+	var builder *app.ErrorBuilder
+	code, err := strconv.ParseUint(info.GetMetadata()[codeMetadataKey], 10, 8)
+	if err == nil {
+		builder = app.NewErrorBuilder(app.ErrorCode(code), info.GetReason())
+	} else {
+		builder = buildErrorFromCode(st.Code())
+	}
+
+	for k, v := range info.GetMetadata() {
+		switch k {
+		case codeMetadataKey:
+			// already applied to the builder
+		case contextMetadataKey:
+			builder.Context(v)
+		default:
+			builder.Str(k, v)
+		}
+	}
+	return builder.Msg(st.Message())
+}
+
+// buildDetails creates the status details for the given app.Error
+func buildDetails(err app.Error, code codes.Code, retryDelay time.Duration) []proto.Message {
+
+	metadata := make(map[string]string, len(err.GetMetadata())+2)
+	if !isServerError(code) {
+		for k, v := range err.GetMetadata() {
+			metadata[k] = v
+		}
+		if err.GetContext() != "" {
+			metadata[contextMetadataKey] = err.GetContext()
+		}
+	}
+	metadata[codeMetadataKey] = strconv.Itoa(int(err.Code()))
+
+	details := []proto.Message{&errdetails.ErrorInfo{
+		Reason:   err.CodeValue(),
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	}}
+
+	switch err.Code() {
+	case app.ValidationErrorCode:
+		if len(err.GetMetadata()) > 0 {
+			details = append(details, &errdetails.BadRequest{FieldViolations: toFieldViolations(err.GetMetadata())})
+		}
+	case app.ServiceUnavailableErrorCode:
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+	}
+	return details
+}
+
+// toFieldViolations converts validation error metadata into field violations ordered by field name
+func toFieldViolations(metadata map[string]string) []*errdetails.BadRequest_FieldViolation {
+	fields := make([]string, 0, len(metadata))
+	for k := range metadata {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(fields))
+	for _, f := range fields {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       f,
+			Description: metadata[f],
+		})
 	}
+	return violations
 }
@@ -0,0 +1,118 @@
+package grpc
+
+import (
+	"errors"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// An app.Error should survive the round trip through a grpc status
+func TestToStatus_RoundTrip(t *testing.T) {
+	orig := app.BuildNotFoundError().Context("GetUser").
+		Str("userId", "42").
+		Msg("user does not exist")
+
+	found, err := ToStatus(orig)
+	assert.True(t, found)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	appErr := FromStatus(err)
+	assert.Equal(t, app.NotFoundErrorCode, appErr.Code())
+	assert.Equal(t, "not-found", appErr.CodeValue())
+	assert.Equal(t, "GetUser", appErr.GetContext())
+	assert.Equal(t, "user does not exist", app.MessageOf(appErr))
+	assert.Equal(t, map[string]string{"userId": "42"}, appErr.GetMetadata())
+	assert.Equal(t, orig.Error(), appErr.Error())
+}
+
+// Validation errors should carry a BadRequest detail with a violation per metadata entry
+func TestToStatus_ValidationFieldViolations(t *testing.T) {
+	_, err := ToStatus(app.BuildValidationError().
+		Str("name", "is required").
+		Str("age", "must be at least 0").
+		Msg("invalid user"))
+
+	var badRequest *errdetails.BadRequest
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			badRequest = br
+		}
+	}
+	assert.NotNil(t, badRequest)
+	assert.Len(t, badRequest.GetFieldViolations(), 2)
+	assert.Equal(t, "age", badRequest.GetFieldViolations()[0].GetField())
+	assert.Equal(t, "name", badRequest.GetFieldViolations()[1].GetField())
+}
+
+// Service unavailable errors should carry a RetryInfo detail
+func TestToStatus_RetryInfo(t *testing.T) {
+	_, err := ToStatus(app.NewSvcUnavailableError("down"))
+
+	var retryInfo *errdetails.RetryInfo
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			retryInfo = ri
+		}
+	}
+	assert.NotNil(t, retryInfo)
+	assert.Equal(t, DefaultRetryDelay, retryInfo.GetRetryDelay().AsDuration())
+
+	_, err = ToStatusWithOptions(app.NewSvcUnavailableError("down"), &StatusOptions{RetryDelay: time.Minute})
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			retryInfo = ri
+		}
+	}
+	assert.Equal(t, time.Minute, retryInfo.GetRetryDelay().AsDuration())
+}
+
+// Internal errors should only carry their code, without their message, context, metadata or cause
+func TestToStatus_RedactsInternalErrors(t *testing.T) {
+	_, err := ToStatus(app.BuildInternalError().Context("GetUser").
+		Cause(errors.New("dial tcp 10.0.0.1:5432: connection refused")).
+		Str("sql", "SELECT * FROM users").
+		Msg("Error querying users"))
+	assert.Equal(t, "Internal", status.Convert(err).Message())
+
+	appErr := FromStatus(err)
+	assert.Equal(t, app.InternalErrorCode, appErr.Code())
+	assert.Equal(t, "", appErr.GetContext())
+	assert.Empty(t, appErr.GetMetadata())
+	assert.Equal(t, "Internal", app.MessageOf(appErr))
+}
+
+// Database timeouts and transaction conflicts should be mapped to their grpc codes, with timeouts redacted
+func TestToStatus_DatabaseErrors(t *testing.T) {
+	for expected, appErr := range map[codes.Code]app.Error{
+		codes.Aborted:          db.BuildTransactionConflictError().Msg("conflict"),
+		codes.DeadlineExceeded: db.BuildTimeoutError().Str("sql", "SELECT 1").Msg("statement timeout"),
+	} {
+		found, err := ToStatus(appErr)
+		assert.True(t, found)
+		assert.Equal(t, expected, status.Code(err))
+		assert.Equal(t, appErr.Code(), FromStatus(err).Code())
+	}
+
+	found, code := GetStatusCode(db.BuildTransactionRetriesExhaustedError(3).Msg("exhausted"))
+	assert.True(t, found)
+	assert.Equal(t, codes.Aborted, code)
+
+	_, err := ToStatus(db.BuildTimeoutError().Str("sql", "SELECT 1").Msg("statement timeout"))
+	assert.Empty(t, FromStatus(err).GetMetadata())
+}
+
+// Statuses that were not created by ToStatus should be mapped by their status code
+func TestFromStatus_ForeignStatus(t *testing.T) {
+	assert.Nil(t, FromStatus(nil))
+	assert.Equal(t, app.ServiceUnavailableErrorCode,
+		FromStatus(status.Error(codes.DeadlineExceeded, "too slow")).Code())
+	assert.Equal(t, app.IllegalStateErrorCode,
+		FromStatus(status.Error(codes.FailedPrecondition, "not ready")).Code())
+	assert.Equal(t, app.InternalErrorCode, FromStatus(errors.New("boom")).Code())
+}
@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/metrics"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+var serverCallCount = metrics.Default.NewCounterVec("pinion_grpc_server_handled_total",
+	"grpc calls handled by the server by method and status code", "method", "code")
+
+var serverCallDuration = metrics.Default.NewHistogramVec("pinion_grpc_server_handling_seconds",
+	"Duration of grpc calls handled by the server by method", nil, "method")
+
+var clientCallCount = metrics.Default.NewCounterVec("pinion_grpc_client_handled_total",
+	"grpc calls completed by clients by client name, method and status code", "client", "method", "code")
+
+var clientCallDuration = metrics.Default.NewHistogramVec("pinion_grpc_client_handling_seconds",
+	"Duration of grpc calls made by clients, including retries, by client name and method", nil,
+	"client", "method")
+
+// UnaryServerMetricsInterceptor records the count and duration of unary calls handled by the server
+func UnaryServerMetricsInterceptor() grpclib.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpclib.UnaryServerInfo,
+		handler grpclib.UnaryHandler) (any, error) {
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeServerCall(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerMetricsInterceptor records the count and duration of streams handled by the server
+func StreamServerMetricsInterceptor() grpclib.StreamServerInterceptor {
+	return func(srv any, ss grpclib.ServerStream, info *grpclib.StreamServerInfo,
+		handler grpclib.StreamHandler) error {
+
+		start := time.Now()
+		err := handler(srv, ss)
+		observeServerCall(info.FullMethod, start, err)
+		return err
+	}
+}
+
+// unaryClientMetricsInterceptor records the count and duration of unary calls made by the named client
+func unaryClientMetricsInterceptor(client string) grpclib.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpclib.ClientConn,
+		invoker grpclib.UnaryInvoker, opts ...grpclib.CallOption) error {
+
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		clientCallCount.With(client, method, codeOf(err).String()).Inc()
+		clientCallDuration.With(client, method).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func observeServerCall(method string, start time.Time, err error) {
+	serverCallCount.With(method, codeOf(err).String()).Inc()
+	serverCallDuration.With(method).Observe(time.Since(start).Seconds())
+}
+
+// codeOf returns the grpc code of an error which is either a status or an app.Error
+func codeOf(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	var appErr app.Error
+	if errors.As(err, &appErr) {
+		if found, code := GetStatusCode(appErr); found {
+			return code
+		}
+		return codes.Unknown
+	}
+	return status.Code(err)
+}
@@ -0,0 +1,115 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/tracing"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServerTracingInterceptor starts a server span for every unary call, continuing the trace of the
+// traceparent metadata sent by the caller
+func UnaryServerTracingInterceptor() grpclib.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpclib.UnaryServerInfo,
+		handler grpclib.UnaryHandler) (any, error) {
+
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+		recordCall(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerTracingInterceptor starts a server span for every stream, continuing the trace of the
+// traceparent metadata sent by the caller
+func StreamServerTracingInterceptor() grpclib.StreamServerInterceptor {
+	return func(srv any, ss grpclib.ServerStream, info *grpclib.StreamServerInfo,
+		handler grpclib.StreamHandler) error {
+
+		ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+		defer span.End()
+
+		err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+		recordCall(span, err)
+		return err
+	}
+}
+
+// unaryClientTracingInterceptor starts a client span for every unary call and propagates it in the
+// traceparent metadata
+func unaryClientTracingInterceptor() grpclib.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpclib.ClientConn,
+		invoker grpclib.UnaryInvoker, opts ...grpclib.CallOption) error {
+
+		ctx, span := tracing.Start(ctx, method, tracing.ClientSpan)
+		defer span.End()
+		span.SetAttribute("rpc.system", "grpc")
+		span.SetAttribute("rpc.method", method)
+
+		if sc := tracing.SpanContextFrom(ctx); sc.IsValid() {
+			ctx = metadata.AppendToOutgoingContext(ctx, tracing.TraceParentHeader, tracing.FormatTraceParent(sc))
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		recordCall(span, err)
+		return err
+	}
+}
+
+// streamClientTracingInterceptor propagates the active span of the context in the traceparent metadata of
+// new streams
+func streamClientTracingInterceptor() grpclib.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpclib.StreamDesc, cc *grpclib.ClientConn, method string,
+		streamer grpclib.Streamer, opts ...grpclib.CallOption) (grpclib.ClientStream, error) {
+
+		if sc := tracing.SpanContextFrom(ctx); sc.IsValid() {
+			ctx = metadata.AppendToOutgoingContext(ctx, tracing.TraceParentHeader, tracing.FormatTraceParent(sc))
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func startServerSpan(ctx context.Context, method string) (context.Context, *tracing.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(tracing.TraceParentHeader); len(values) > 0 {
+			if sc, valid := tracing.ParseTraceParent(values[0]); valid {
+				ctx = tracing.WithRemoteSpanContext(ctx, sc)
+			}
+		}
+	}
+	ctx, span := tracing.Start(ctx, method, tracing.ServerSpan)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", method)
+	return ctx, span
+}
+
+// recordCall records the status code of the call and the app.Error it failed with
+func recordCall(span *tracing.Span, err error) {
+	code := codeOf(err)
+	span.SetAttribute("rpc.grpc.status_code", int(code))
+	if err == nil {
+		return
+	}
+	var appErr app.Error
+	if errors.As(err, &appErr) {
+		span.RecordError(appErr)
+		return
+	}
+	if code != codes.OK {
+		span.SetStatus(tracing.StatusError, err.Error())
+	}
+}
+
+// tracedServerStream replaces the context of a server stream with the one carrying its span
+type tracedServerStream struct {
+	grpclib.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
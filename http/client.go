@@ -0,0 +1,258 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	"github.com/sterrasi/pinion/tracing"
+	"io"
+	"mime"
+	nethttp "net/http"
+	"time"
+)
+
+// maxErrorBodySize is the max number of bytes read from a non-2xx response body
+const maxErrorBodySize = 64 * 1024
+
+// ClientConfig configures a Client
+type ClientConfig struct {
+	// Timeout is the time limit of a single attempt, including reading the response body
+	Timeout time.Duration
+	// MaxAttempts is the max number of attempts (including the first) for retryable failures
+	MaxAttempts uint
+	Backoff     pinion.Backoff
+}
+
+// DefaultClientConfig is used by NewClient when no ClientConfig is given
+var DefaultClientConfig = ClientConfig{
+	Timeout:     10 * time.Second,
+	MaxAttempts: 3,
+	Backoff:     pinion.DefaultBackoff,
+}
+
+// Client is an http client for service to service calls. It applies a timeout to each attempt, retries
+// idempotent requests failing with a transport error or a 429, 502, 503 or 504 status, propagates the request
+// id and translates non-2xx responses into app.Errors
+type Client struct {
+	cfg    ClientConfig
+	client *nethttp.Client
+}
+
+// NewClient creates a Client from the given ClientConfig. If cfg is nil then DefaultClientConfig is used
+func NewClient(cfg *ClientConfig) *Client {
+	if cfg == nil {
+		cfg = &DefaultClientConfig
+	}
+	return &Client{
+		cfg:    *cfg,
+		client: &nethttp.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Do sends the request and returns the response if it has a 2xx status. Any other status is returned as
+// an app.Error, decoded from the response body if it is an RFC 7807 problem. The caller must close the body
+// of the returned response. The request is traced with a client span that is propagated in the traceparent
+// header
+func (c *Client) Do(req *nethttp.Request) (*nethttp.Response, app.Error) {
+	ctx, span := tracing.Start(req.Context(), "HTTP "+req.Method, tracing.ClientSpan)
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Redacted())
+
+	req = req.WithContext(ctx)
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.do(req)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttribute("http.status_code", resp.StatusCode)
+	}
+	return resp, err
+}
+
+// do sends the request, retrying retryable failures
+func (c *Client) do(req *nethttp.Request) (*nethttp.Response, app.Error) {
+	ctx := req.Context()
+	log := logger.FromContext(ctx)
+
+	if requestID := RequestIDFrom(ctx); requestID != "" && req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	retryable := isIdempotent(req.Method) && (req.Body == nil || req.GetBody != nil)
+	for attempt := uint(1); ; attempt++ {
+
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, app.BuildInternalError().Cause(err).
+					Context(describe(req)).
+					Msg("Error rewinding request body for retry")
+			}
+			req.Body = body
+		}
+
+		start := time.Now()
+		resp, err := c.client.Do(req)
+		canRetry := retryable && attempt < c.cfg.MaxAttempts
+
+		if err != nil {
+			if !canRetry || ctx.Err() != nil {
+				return nil, app.BuildSvcUnavailableError().Cause(err).
+					Context(describe(req)).
+					Msg("Error sending http request")
+			}
+		} else {
+			log.Debug().
+				Str("method", req.Method).
+				Str("url", req.URL.String()).
+				Int("status", resp.StatusCode).
+				Dur("duration", time.Since(start)).
+				Uint("attempt", attempt).
+				Msg("Executed http request")
+
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return resp, nil
+			}
+			if !canRetry || !isRetryableStatus(resp.StatusCode) {
+				return nil, decodeErrorResponse(req, resp)
+			}
+			drain(resp)
+		}
+
+		log.Debug().
+			Str("method", req.Method).
+			Str("url", req.URL.String()).
+			Uint("attempt", attempt).
+			Msg("Retrying http request")
+
+		if e := c.cfg.Backoff.Wait(ctx, int(attempt)); e != nil {
+			return nil, app.BuildSvcUnavailableError().Cause(e).
+				Context(describe(req)).
+				Msg("Http request cancelled while waiting to retry")
+		}
+	}
+}
+
+// DoJSON sends a request with the JSON encoded body (if not nil) and decodes the JSON response into out
+// (if not nil)
+func (c *Client) DoJSON(ctx context.Context, method string, url string, body any, out any) app.Error {
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return app.BuildIllegalArgumentError().Cause(err).
+				Context(method + " " + url).
+				Msg("Error encoding http request body")
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := nethttp.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return app.BuildIllegalArgumentError().Cause(err).
+			Context(method + " " + url).
+			Msg("Error creating http request")
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, appErr := c.Do(req)
+	if appErr != nil {
+		return appErr
+	}
+	defer drain(resp)
+
+	if out != nil && resp.StatusCode != nethttp.StatusNoContent {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return app.BuildInternalError().Cause(err).
+				Context(describe(req)).
+				Msg("Error decoding http response body")
+		}
+	}
+	return nil
+}
+
+// GetJSON sends a GET request and decodes the JSON response into a T
+func GetJSON[T any](ctx context.Context, c *Client, url string) (*T, app.Error) {
+	out := new(T)
+	if err := c.DoJSON(ctx, nethttp.MethodGet, url, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SendJSON sends a request with the JSON encoded body and decodes the JSON response into a T
+func SendJSON[T any](ctx context.Context, c *Client, method string, url string, body any) (*T, app.Error) {
+	out := new(T)
+	if err := c.DoJSON(ctx, method, url, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decodeErrorResponse translates a non-2xx response into an app.Error and closes its body
+func decodeErrorResponse(req *nethttp.Request, resp *nethttp.Response) app.Error {
+	defer drain(resp)
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == ProblemContentType {
+		problem := &Problem{}
+		err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodySize)).Decode(problem)
+		if err == nil {
+			if problem.Status == 0 {
+				problem.Status = resp.StatusCode
+			}
+			appErr := problem.ToError()
+			if appErr.GetContext() == "" {
+				appErr.SetContext(describe(req))
+			}
+			return appErr
+		}
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	builder := BuildErrorFromStatusCode(resp.StatusCode).
+		Context(describe(req)).
+		Str("status", resp.Status)
+	if len(body) > 0 {
+		builder.Str("body", string(body))
+	}
+	return builder.Msgf("Http request failed with status %d", resp.StatusCode)
+}
+
+// drain reads the remainder of the response body so the connection can be reused, then closes it
+func drain(resp *nethttp.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+	_ = resp.Body.Close()
+}
+
+func describe(req *nethttp.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case nethttp.MethodGet, nethttp.MethodHead, nethttp.MethodOptions, nethttp.MethodPut, nethttp.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case nethttp.StatusTooManyRequests, nethttp.StatusBadGateway, nethttp.StatusServiceUnavailable,
+		nethttp.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+func testClient() *Client {
+	return NewClient(&ClientConfig{
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     pinion.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1},
+	})
+}
+
+// A successful response should be decoded and the request id propagated
+func TestClient_GetJSON(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		assert.Equal(t, "req-1", r.Header.Get(RequestIDHeader))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"bob"}`))
+	}))
+	defer server.Close()
+
+	u, err := GetJSON[user](WithRequestID(context.Background(), "req-1"), testClient(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", u.Name)
+}
+
+// A problem response should be decoded back into the original app.Error
+func TestClient_ProblemResponse(t *testing.T) {
+	t.Cleanup(RegisterProblemMetadata("name"))
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		WriteError(w, app.BuildAlreadyExistsError().Context("CreateUser").
+			Str("name", "bob").
+			Msg("user already exists"))
+	}))
+	defer server.Close()
+
+	_, err := SendJSON[user](context.Background(), testClient(), nethttp.MethodPost, server.URL, &user{Name: "bob"})
+	assert.Equal(t, app.AlreadyExistsErrorCode, err.Code())
+	assert.Equal(t, "already-exists", err.CodeValue())
+	assert.Equal(t, "CreateUser", err.GetContext())
+	assert.Equal(t, "user already exists", app.MessageOf(err))
+	assert.Equal(t, "bob", err.GetMetadataValue("name"))
+}
+
+// A plain error response should be mapped by its status code
+func TestClient_StatusCodeResponse(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		nethttp.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	_, err := GetJSON[user](context.Background(), testClient(), server.URL)
+	assert.Equal(t, app.NotFoundErrorCode, err.Code())
+}
+
+// Idempotent requests should be retried on a retryable status
+func TestClient_RetriesUnavailable(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"alice"}`))
+	}))
+	defer server.Close()
+
+	u, err := GetJSON[user](context.Background(), testClient(), server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", u.Name)
+	assert.Equal(t, 3, attempts)
+}
+
+// Non idempotent requests should not be retried
+func TestClient_DoesNotRetryPost(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		attempts++
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := SendJSON[user](context.Background(), testClient(), nethttp.MethodPost, server.URL, &user{})
+	assert.Equal(t, app.ServiceUnavailableErrorCode, err.Code())
+	assert.Equal(t, 1, attempts)
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"io"
+	"mime"
+	nethttp "net/http"
+	"strings"
+)
+
+// MaxRequestBodySize is the max number of bytes DecodeJSON will read from a request body
+var MaxRequestBodySize int64 = 1 << 20
+
+// DecodeJSON decodes the JSON body of the request into a T and validates it (see Validate). The request must
+// have a JSON content type, contain a single JSON value and must not contain fields unknown to T. Every
+// failure is returned as a ValidationErrorCode error.
+func DecodeJSON[T any](r *nethttp.Request) (*T, app.Error) {
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !isJSONMediaType(mediaType) {
+		return nil, app.BuildValidationError().
+			Str("contentType", contentType).
+			Msg("Request body must be JSON")
+	}
+	if r.Body == nil {
+		return nil, app.NewValidationError("Request body is empty")
+	}
+
+	decoder := json.NewDecoder(nethttp.MaxBytesReader(nil, r.Body, MaxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	model := new(T)
+	if err = decoder.Decode(model); err != nil {
+		return nil, decodeError(err)
+	}
+	if decoder.More() {
+		return nil, app.NewValidationError("Request body must contain a single JSON value")
+	}
+
+	if appErr := Validate(model); appErr != nil {
+		return nil, appErr
+	}
+	return model, nil
+}
+
+// decodeError converts a json decoding error into a ValidationErrorCode error
+func decodeError(err error) app.Error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *nethttp.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return app.NewValidationError("Request body is empty")
+
+	case errors.As(err, &maxBytesErr):
+		return app.BuildValidationError().
+			Str("maxSize", fmt.Sprintf("%d", maxBytesErr.Limit)).
+			Msg("Request body is too large")
+
+	case errors.As(err, &syntaxErr):
+		return app.BuildValidationError().Cause(err).
+			Str("offset", fmt.Sprintf("%d", syntaxErr.Offset)).
+			Msg("Request body contains malformed JSON")
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return app.BuildValidationError().Cause(err).
+			Msg("Request body contains malformed JSON")
+
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return &requestError{appError: app.BuildValidationError().Cause(err).
+			Str(field, "must be "+withArticle(typeErr.Type.String())).
+			Msgf("Invalid value for %s", field)}
+
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &requestError{appError: app.BuildValidationError().
+			Str(field, "is not a known field").
+			Msgf("Unknown field %s", field)}
+
+	default:
+		return app.BuildValidationError().Cause(err).
+			Msg("Error decoding request body")
+	}
+}
+
+// withArticle prefixes the type name with its indefinite article
+func withArticle(typeName string) string {
+	if strings.ContainsAny(typeName[:1], "aeiou") {
+		return "an " + typeName
+	}
+	return "a " + typeName
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	Street string `json:"street" validate:"required"`
+	Zip    string `json:"zip" validate:"pattern=^[0-9]{5}$"`
+}
+
+type createUser struct {
+	Name      string    `json:"name" validate:"required,max=8"`
+	Age       *int      `json:"age" validate:"required,min=0,max=150"`
+	Role      string    `json:"role" validate:"enum=admin|member"`
+	Tags      []string  `json:"tags" validate:"max=2"`
+	Code      string    `json:"code" validate:"len=3"`
+	Addresses []address `json:"addresses"`
+}
+
+func newJSONRequest(body string) *nethttp.Request {
+	r := httptest.NewRequest(nethttp.MethodPost, "/users", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return r
+}
+
+func TestDecodeJSON_Valid(t *testing.T) {
+	u, err := DecodeJSON[createUser](newJSONRequest(
+		`{"name":"bob","age":30,"role":"admin","code":"abc","addresses":[{"street":"main","zip":"12345"}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", u.Name)
+	assert.Equal(t, 30, *u.Age)
+}
+
+// Every violating field should be listed in the metadata of a single validation error
+func TestDecodeJSON_ValidationViolations(t *testing.T) {
+	_, err := DecodeJSON[createUser](newJSONRequest(
+		`{"name":"bartholomew","role":"owner","tags":["a","b","c"],"code":"ab",` +
+			`"addresses":[{"street":"main","zip":"12345"},{"zip":"abc"}]}`))
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+	assert.Equal(t, "must have a length of at most 8", err.GetMetadataValue("name"))
+	assert.Equal(t, "is required", err.GetMetadataValue("age"))
+	assert.Equal(t, "must be one of admin, member", err.GetMetadataValue("role"))
+	assert.Equal(t, "must have a length of at most 2", err.GetMetadataValue("tags"))
+	assert.Equal(t, "must have a length of 3", err.GetMetadataValue("code"))
+	assert.Equal(t, "is required", err.GetMetadataValue("addresses[1].street"))
+	assert.Equal(t, "must match the pattern ^[0-9]{5}$", err.GetMetadataValue("addresses[1].zip"))
+	assert.Len(t, err.GetMetadata(), 7)
+}
+
+func TestDecodeJSON_RejectsUnknownFields(t *testing.T) {
+	_, err := DecodeJSON[createUser](newJSONRequest(`{"name":"bob","age":1,"admin":true}`))
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+	assert.Equal(t, "is not a known field", err.GetMetadataValue("admin"))
+}
+
+func TestDecodeJSON_RejectsWrongTypes(t *testing.T) {
+	_, err := DecodeJSON[createUser](newJSONRequest(`{"name":"bob","age":"old"}`))
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+	assert.Equal(t, "must be an int", err.GetMetadataValue("age"))
+}
+
+func TestDecodeJSON_RejectsMalformedBodies(t *testing.T) {
+	_, err := DecodeJSON[createUser](newJSONRequest(`{"name":`))
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+
+	_, err = DecodeJSON[createUser](newJSONRequest(`{"name":"bob","age":1} {}`))
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+
+	_, err = DecodeJSON[createUser](newJSONRequest(``))
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+}
+
+func TestDecodeJSON_RequiresJSONContentType(t *testing.T) {
+	r := newJSONRequest(`{"name":"bob","age":1}`)
+	r.Header.Set("Content-Type", "text/plain")
+	_, err := DecodeJSON[createUser](r)
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+	assert.Equal(t, "text/plain", err.GetMetadataValue("contentType"))
+}
+
+func TestValidate_InvalidTag(t *testing.T) {
+	type bad struct {
+		Count int `validate:"min=lots"`
+	}
+	err := Validate(&bad{Count: 1})
+	assert.Equal(t, app.IllegalArgumentError, err.Code())
+}
+
+// Omitted optional fields should not be validated against their rules
+func TestValidate_OmittedOptionalFields(t *testing.T) {
+	age := 30
+	assert.Nil(t, Validate(&createUser{Name: "bob", Age: &age}))
+	assert.Nil(t, Validate(&address{Street: "main"}))
+
+	err := Validate(&address{})
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+	assert.Equal(t, "is required", err.GetMetadataValue("street"))
+	assert.Len(t, err.GetMetadata(), 1)
+}
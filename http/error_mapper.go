@@ -2,6 +2,7 @@ package http
 
 import (
 	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
 	nethttp "net/http"
 )
 
@@ -31,7 +32,48 @@ func GetHttpStatusCode(err app.Error) (bool, int) {
 	case app.NotFoundErrorCode:
 		return true, nethttp.StatusNotFound
 
+	case db.TransactionConflictErrorCode:
+		fallthrough
+	case db.TransactionRetriesExhaustedErrorCode:
+		return true, nethttp.StatusConflict
+
+	case db.TimeoutErrorCode:
+		return true, nethttp.StatusGatewayTimeout
+
 	default:
 		return false, 0
 	}
 }
+
+// BuildErrorFromStatusCode returns the app.ErrorBuilder for the given non-2xx http status code. It is the
+// inverse of GetHttpStatusCode; a conflict is interpreted as an illegal state error since the code value is
+// needed to distinguish it from an already exists error
+func BuildErrorFromStatusCode(statusCode int) *app.ErrorBuilder {
+
+	switch statusCode {
+	case nethttp.StatusServiceUnavailable:
+		fallthrough
+	case nethttp.StatusBadGateway:
+		fallthrough
+	case nethttp.StatusGatewayTimeout:
+		fallthrough
+	case nethttp.StatusTooManyRequests:
+		return app.BuildSvcUnavailableError()
+
+	case nethttp.StatusNotFound:
+		fallthrough
+	case nethttp.StatusGone:
+		return app.BuildNotFoundError()
+
+	case nethttp.StatusConflict:
+		fallthrough
+	case nethttp.StatusPreconditionFailed:
+		return app.BuildIllegalStateError()
+
+	default:
+		if statusCode >= 400 && statusCode < 500 {
+			return app.BuildValidationError()
+		}
+		return app.BuildInternalError()
+	}
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"github.com/sterrasi/pinion/metrics"
+	"io"
+	"net"
+	nethttp "net/http"
+	"strconv"
+	"time"
+)
+
+// UnmatchedRoute is the route label of requests that did not match a registered route
+const UnmatchedRoute = "unmatched"
+
+var requestCount = metrics.Default.NewCounterVec("pinion_http_server_requests_total",
+	"HTTP requests handled by method, route and status code", "method", "route", "status")
+
+var requestDuration = metrics.Default.NewHistogramVec("pinion_http_server_request_duration_seconds",
+	"Duration of HTTP requests by method and route", nil, "method", "route")
+
+var requestsInFlight = metrics.Default.NewGauge("pinion_http_server_requests_in_flight",
+	"HTTP requests currently being handled")
+
+// routeKey is the context.Context key of the matchedRoute filled in by the Router
+type routeKey struct{}
+
+// matchedRoute receives the pattern of the route that the Router matched
+type matchedRoute struct {
+	pattern string
+}
+
+// withMatchedRoute returns the request with a matchedRoute in its context, reusing the one added by outer
+// middleware
+func withMatchedRoute(r *nethttp.Request) (*nethttp.Request, *matchedRoute) {
+	if route, ok := r.Context().Value(routeKey{}).(*matchedRoute); ok {
+		return r, route
+	}
+	route := &matchedRoute{}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, route)), route
+}
+
+// Metrics returns middleware recording the count and duration of requests. Requests are labelled by the
+// pattern of the matched route (ex. "/users/:id") rather than the raw path, so it must be added to the
+// Router with Router.Use
+func Metrics() Middleware {
+	return func(next nethttp.Handler) nethttp.Handler {
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			start := time.Now()
+			requestsInFlight.Inc()
+			defer requestsInFlight.Dec()
+
+			r, route := withMatchedRoute(r)
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			pattern := route.pattern
+			if pattern == "" {
+				pattern = UnmatchedRoute
+			}
+			requestCount.With(r.Method, pattern, strconv.Itoa(recorder.Status())).Inc()
+			requestDuration.With(r.Method, pattern).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// statusRecorder captures the status code written to the response
+type statusRecorder struct {
+	nethttp.ResponseWriter
+	status int
+}
+
+// WriteHeader satisfies the nethttp.ResponseWriter interface
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.status == 0 {
+		sr.status = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write satisfies the nethttp.ResponseWriter interface
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = nethttp.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Status returns the written status code, which is 200 if the handler did not write one
+func (sr *statusRecorder) Status() int {
+	if sr.status == 0 {
+		return nethttp.StatusOK
+	}
+	return sr.status
+}
+
+// Flush satisfies the nethttp.Flusher interface. It does nothing if the wrapped writer can not flush
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(nethttp.Flusher); ok {
+		if sr.status == 0 {
+			sr.status = nethttp.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack satisfies the nethttp.Hijacker interface. It fails if the wrapped writer can not be hijacked
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(nethttp.Hijacker)
+	if !ok {
+		return nil, nil, nethttp.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && sr.status == 0 {
+		sr.status = nethttp.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// ReadFrom satisfies the io.ReaderFrom interface, so the wrapped writer can still send files efficiently
+func (sr *statusRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if sr.status == 0 {
+		sr.status = nethttp.StatusOK
+	}
+	return io.Copy(sr.ResponseWriter, r)
+}
+
+// Unwrap returns the wrapped writer for use by nethttp.ResponseController
+func (sr *statusRecorder) Unwrap() nethttp.ResponseWriter {
+	return sr.ResponseWriter
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// test that requests are counted by the pattern of the matched route and the written status
+func TestMetrics_LabelsRequestsByRoute(t *testing.T) {
+	rt := NewRouter()
+	rt.Use(Metrics())
+	rt.Get("/metrics-test/:id", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		w.WriteHeader(nethttp.StatusAccepted)
+		return nil
+	})
+
+	serve(rt, nethttp.MethodGet, "/metrics-test/1")
+	serve(rt, nethttp.MethodGet, "/metrics-test/2")
+	serve(rt, nethttp.MethodGet, "/metrics-test-missing")
+
+	assert.Equal(t, float64(2), requestCount.With("GET", "/metrics-test/:id", "202").Value())
+	assert.Equal(t, uint64(2), requestDuration.With("GET", "/metrics-test/:id").Count())
+	assert.Equal(t, float64(1), requestCount.With("GET", UnmatchedRoute, "404").Value())
+	assert.Equal(t, float64(0), requestsInFlight.Value())
+}
+
+// test that the recorder forwards flushing and hijacking to the wrapped writer
+func TestStatusRecorder_ForwardsOptionalInterfaces(t *testing.T) {
+	w := httptest.NewRecorder()
+	var rw nethttp.ResponseWriter = &statusRecorder{ResponseWriter: w}
+
+	flusher, ok := rw.(nethttp.Flusher)
+	assert.True(t, ok)
+	flusher.Flush()
+	assert.True(t, w.Flushed)
+
+	n, err := rw.(io.ReaderFrom).ReadFrom(strings.NewReader("body"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.Equal(t, "body", w.Body.String())
+	assert.Equal(t, nethttp.StatusOK, rw.(*statusRecorder).Status())
+
+	// httptest.ResponseRecorder can not be hijacked
+	_, _, err = rw.(nethttp.Hijacker).Hijack()
+	assert.Equal(t, nethttp.ErrNotSupported, err)
+}
+
+// test that a handler behind the metrics and tracing middleware can hijack the connection
+func TestStatusRecorder_Hijack(t *testing.T) {
+	rt := NewRouter()
+	rt.Use(Metrics(), Tracing())
+	rt.Get("/hijack", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		conn, rw, err := w.(nethttp.Hijacker).Hijack()
+		if assert.Nil(t, err) {
+			_, _ = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+			_ = rw.Flush()
+			_ = conn.Close()
+		}
+		return nil
+	})
+	server := httptest.NewServer(rt)
+	defer server.Close()
+
+	resp, err := nethttp.Get(server.URL + "/hijack")
+	if assert.Nil(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, "ok", string(body))
+	}
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"github.com/sterrasi/pinion"
+	"github.com/sterrasi/pinion/app"
+	nethttp "net/http"
+	"strconv"
+	"time"
+)
+
+// PathString returns the value of a required path parameter
+func PathString(r *nethttp.Request, name string) (string, app.Error) {
+	raw := PathParam(r, name)
+	if raw == "" {
+		return "", missingParam("path", name)
+	}
+	return raw, nil
+}
+
+// PathInt parses a required path parameter as an int
+func PathInt(r *nethttp.Request, name string) (int, app.Error) {
+	raw, err := PathString(r, name)
+	if err != nil {
+		return 0, err
+	}
+	return parseInt("path", name, raw)
+}
+
+// PathInt64 parses a required path parameter as an int64
+func PathInt64(r *nethttp.Request, name string) (int64, app.Error) {
+	raw, err := PathString(r, name)
+	if err != nil {
+		return 0, err
+	}
+	return parseInt64("path", name, raw)
+}
+
+// PathUUID parses a required path parameter as a pinion.UUID
+func PathUUID(r *nethttp.Request, name string) (pinion.UUID, app.Error) {
+	raw, err := PathString(r, name)
+	if err != nil {
+		return pinion.UUID{}, err
+	}
+	return parseUUID("path", name, raw)
+}
+
+// QueryString returns the value of a query parameter, or the default if it is not present
+func QueryString(r *nethttp.Request, name string, defaultValue string) string {
+	if raw := r.URL.Query().Get(name); raw != "" {
+		return raw
+	}
+	return defaultValue
+}
+
+// QueryInt parses a query parameter as an int, returning the default if it is not present
+func QueryInt(r *nethttp.Request, name string, defaultValue int) (int, app.Error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+	return parseInt("query", name, raw)
+}
+
+// QueryInt64 parses a query parameter as an int64, returning the default if it is not present
+func QueryInt64(r *nethttp.Request, name string, defaultValue int64) (int64, app.Error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+	return parseInt64("query", name, raw)
+}
+
+// QueryBool parses a query parameter as a bool, returning the default if it is not present
+func QueryBool(r *nethttp.Request, name string, defaultValue bool) (bool, app.Error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, invalidParam("query", name, raw, "must be a boolean")
+	}
+	return b, nil
+}
+
+// QueryUUID parses an optional query parameter as a pinion.UUID. Nil is returned if it is not present
+func QueryUUID(r *nethttp.Request, name string) (*pinion.UUID, app.Error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := parseUUID("query", name, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// QueryTime parses an optional RFC 3339 query parameter as a time.Time. Nil is returned if it is not present
+func QueryTime(r *nethttp.Request, name string) (*time.Time, app.Error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, invalidParam("query", name, raw, "must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+func parseInt(location string, name string, raw string) (int, app.Error) {
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, invalidParam(location, name, raw, "must be an integer")
+	}
+	return n, nil
+}
+
+func parseInt64(location string, name string, raw string) (int64, app.Error) {
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, invalidParam(location, name, raw, "must be an integer")
+	}
+	return n, nil
+}
+
+func parseUUID(location string, name string, raw string) (pinion.UUID, app.Error) {
+	u, err := pinion.ParseUUID(raw)
+	if err != nil {
+		return u, invalidParam(location, name, raw, "must be a UUID")
+	}
+	return u, nil
+}
+
+func missingParam(location string, name string) app.Error {
+	return &requestError{appError: app.BuildValidationError().
+		Str(name, "is required").
+		Msgf("Missing %s parameter %s", location, name)}
+}
+
+func invalidParam(location string, name string, raw string, description string) app.Error {
+	return &requestError{appError: app.BuildValidationError().
+		Str(name, description).
+		Msgf("Invalid %s parameter %s '%s'", location, name, raw)}
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	nethttp "net/http"
+	"sync"
+)
+
+// ProblemContentType is the media type of an RFC 7807 problem details document
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document describing an app.Error. The pinion specific members
+// (code, errorCode, context and metadata) allow the app.Error to be reconstructed by a client
+type Problem struct {
+	Type      string            `json:"type,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Status    int               `json:"status,omitempty"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code,omitempty"`
+	ErrorCode *app.ErrorCode    `json:"errorCode,omitempty"`
+	Context   string            `json:"context,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// publicMetadata are the metadata keys of client errors written to a Problem
+var publicMetadata sync.Map
+
+func init() {
+	// the metadata of the errors written by this package
+	RegisterProblemMetadata("path", "method", "allowed", "contentType", "maxSize", "offset")
+}
+
+// RegisterProblemMetadata allows the metadata with the given keys to be written to the Problem of a client
+// error. Other metadata, such as the sql and postgres details of a database error, is not sent to the client.
+// The returned function unregisters the keys
+func RegisterProblemMetadata(keys ...string) (unregister func()) {
+	for _, key := range keys {
+		publicMetadata.Store(key, true)
+	}
+	return func() {
+		for _, key := range keys {
+			publicMetadata.Delete(key)
+		}
+	}
+}
+
+// requestError is an app.Error describing an invalid request (ex. the field violations of Validate), whose
+// metadata is written to the Problem in full
+type requestError struct {
+	appError
+}
+
+// appError is embedded by requestError, since the embedded field can not be named Error
+type appError = app.Error
+
+// Message returns the message of the embedded error, which the Problem detail is written from
+func (e *requestError) Message() string {
+	return app.MessageOf(e.appError)
+}
+
+// NewProblem creates the Problem describing the given app.Error. Errors with an unknown code are
+// described as internal server errors. Server errors (5xx) are described by their code and status only, so
+// that their message and metadata are not leaked to the client. Client errors (4xx) are described by their
+// message, context and the registered metadata (see RegisterProblemMetadata)
+func NewProblem(err app.Error) *Problem {
+	found, statusCode := GetHttpStatusCode(err)
+	if !found {
+		statusCode = nethttp.StatusInternalServerError
+	}
+	code := err.Code()
+	problem := &Problem{
+		Type:      "about:blank",
+		Title:     nethttp.StatusText(statusCode),
+		Status:    statusCode,
+		Detail:    nethttp.StatusText(statusCode),
+		Code:      err.CodeValue(),
+		ErrorCode: &code,
+	}
+	if statusCode >= nethttp.StatusInternalServerError {
+		return problem
+	}
+
+	problem.Detail = app.MessageOf(err)
+	problem.Context = err.GetContext()
+	_, public := err.(*requestError)
+	for k, v := range err.GetMetadata() {
+		if _, registered := publicMetadata.Load(k); public || registered {
+			if problem.Metadata == nil {
+				problem.Metadata = make(map[string]string)
+			}
+			problem.Metadata[k] = v
+		}
+	}
+	return problem
+}
+
+// ToError reconstructs the app.Error described by the Problem. If the Problem was not created by pinion
+// then the error is derived from its status code
+func (p *Problem) ToError() app.Error {
+	var builder *app.ErrorBuilder
+	if p.ErrorCode != nil && p.Code != "" {
+		builder = app.NewErrorBuilder(*p.ErrorCode, p.Code)
+	} else {
+		builder = BuildErrorFromStatusCode(p.Status)
+	}
+
+	for k, v := range p.Metadata {
+		builder.Str(k, v)
+	}
+	if p.Context != "" {
+		builder.Context(p.Context)
+	}
+
+	message := p.Detail
+	if message == "" {
+		message = p.Title
+	}
+	return builder.Msg(message)
+}
+
+// WriteError writes the given app.Error to the response as an RFC 7807 problem details document (see
+// NewProblem). Server errors are logged since their details are not part of the response
+func WriteError(w nethttp.ResponseWriter, err app.Error) {
+	problem := NewProblem(err)
+	if problem.Status >= nethttp.StatusInternalServerError {
+		logger.Error().Err(err).
+			Str("errorCode", problem.Code).
+			Msg("Error handling request")
+	}
+	writeProblem(w, problem)
+}
+
+// writeProblem writes the Problem to the response using its status
+func writeProblem(w nethttp.ResponseWriter, problem *Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	if e := json.NewEncoder(w).Encode(problem); e != nil {
+		logger.Error().Err(e).
+			Str("errorCode", problem.Code).
+			Msg("Error writing problem response")
+	}
+}
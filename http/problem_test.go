@@ -0,0 +1,75 @@
+package http
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Server errors should be described by their code only, without their message, context or metadata
+func TestNewProblem_RedactsServerErrors(t *testing.T) {
+	problem := NewProblem(app.BuildSysConfigError().Context("GetUser").
+		Str("sql", "SELECT * FROM users").
+		Msg("Error connecting to 10.0.0.1"))
+	assert.Equal(t, nethttp.StatusInternalServerError, problem.Status)
+	assert.Equal(t, nethttp.StatusText(nethttp.StatusInternalServerError), problem.Detail)
+	assert.Equal(t, "", problem.Context)
+	assert.Nil(t, problem.Metadata)
+	assert.Equal(t, app.SystemConfigurationErrorCode, problem.ToError().Code())
+}
+
+// Client errors should only expose registered metadata, unless they describe an invalid request
+func TestNewProblem_ClientErrorMetadata(t *testing.T) {
+	problem := NewProblem(app.BuildValidationError().
+		Str("path", "/users").
+		Str("postgresCode", "23503").
+		Str("constraintName", "users_org_fk").
+		Msg("Organization does not exist"))
+	assert.Equal(t, nethttp.StatusBadRequest, problem.Status)
+	assert.Equal(t, "Organization does not exist", problem.Detail)
+	assert.Equal(t, map[string]string{"path": "/users"}, problem.Metadata)
+
+	t.Cleanup(RegisterProblemMetadata("constraintName"))
+	problem = NewProblem(app.BuildValidationError().Str("constraintName", "users_org_fk").Msg("Invalid"))
+	assert.Equal(t, "users_org_fk", problem.Metadata["constraintName"])
+
+	type org struct {
+		Name string `json:"name" validate:"required"`
+	}
+	problem = NewProblem(Validate(&org{}))
+	assert.Equal(t, "Invalid value for name", problem.Detail)
+	assert.Equal(t, "is required", problem.Metadata["name"])
+}
+
+// The detail of decoding and parameter errors should be their message, without the code or the cause
+func TestNewProblem_RequestErrorDetail(t *testing.T) {
+	type org struct {
+		Name string `json:"name"`
+	}
+	_, err := DecodeJSON[org](newJSONRequest(`{"name":1}`))
+	assert.Equal(t, "Invalid value for name", NewProblem(err).Detail)
+
+	_, err = DecodeJSON[org](newJSONRequest(`{"name":"acme","admin":true}`))
+	assert.Equal(t, "Unknown field admin", NewProblem(err).Detail)
+
+	r := httptest.NewRequest(nethttp.MethodGet, "/orgs?limit=ten", nil)
+	_, err = QueryInt(r, "limit", 10)
+	problem := NewProblem(err)
+	assert.Equal(t, "Invalid query parameter limit 'ten'", problem.Detail)
+	assert.Equal(t, "must be an integer", problem.Metadata["limit"])
+}
+
+// Database timeouts and transaction conflicts should be mapped to their http status codes
+func TestNewProblem_DatabaseErrors(t *testing.T) {
+	assert.Equal(t, nethttp.StatusConflict, NewProblem(db.BuildTransactionConflictError().Msg("conflict")).Status)
+	assert.Equal(t, nethttp.StatusConflict,
+		NewProblem(db.BuildTransactionRetriesExhaustedError(3).Msg("exhausted")).Status)
+
+	problem := NewProblem(db.BuildTimeoutError().Str("sql", "SELECT 1").Msg("statement timeout"))
+	assert.Equal(t, nethttp.StatusGatewayTimeout, problem.Status)
+	assert.Equal(t, nethttp.StatusText(nethttp.StatusGatewayTimeout), problem.Detail)
+	assert.Equal(t, db.TimeoutErrorCode, problem.ToError().Code())
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/sterrasi/pinion/logger"
+	nethttp "net/http"
+)
+
+// RequestIDHeader is the header used to propagate the id of a request across services
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the max length of a request id accepted from a caller
+const maxRequestIDLength = 128
+
+// requestIDKey is the context.Context key for the request id
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the context carrying the given request id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFrom returns the request id stored in the context, or a blank string if there is none
+func RequestIDFrom(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// RequestID returns middleware identifying every request with the id of the RequestIDHeader sent by the
+// caller, or a generated one. The id is returned in the response header and stored in the request context,
+// both with WithRequestID so that a Client propagates it, and as a "requestId" field of the context logger
+// (see logger.FromContext). It must be added to the Router with Router.Use
+func RequestID() Middleware {
+	return func(next nethttp.Handler) nethttp.Handler {
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			ctx := WithRequestID(r.Context(), requestID)
+			ctx = logger.NewContext(ctx, logger.FromContext(ctx).With().Str("requestId", requestID).Logger())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// newRequestID generates a random request id
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/logger"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The request id sent by the caller should be stored in the context and returned, or generated if missing
+func TestRequestID(t *testing.T) {
+	var requestID string
+	rt := NewRouter()
+	rt.Use(RequestID())
+	rt.Get("/request-id", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		requestID = RequestIDFrom(r.Context())
+		assert.NotSame(t, logger.FromContext(context.Background()), logger.FromContext(r.Context()))
+		return nil
+	})
+
+	r := httptest.NewRequest(nethttp.MethodGet, "/request-id", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	assert.Equal(t, "req-1", requestID)
+	assert.Equal(t, "req-1", w.Header().Get(RequestIDHeader))
+
+	w = serve(rt, nethttp.MethodGet, "/request-id")
+	assert.Len(t, requestID, 32)
+	assert.Equal(t, requestID, w.Header().Get(RequestIDHeader))
+}
@@ -0,0 +1,285 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/tracing"
+	nethttp "net/http"
+	"sort"
+	"strings"
+)
+
+// Middleware wraps a handler with additional behavior
+type Middleware func(nethttp.Handler) nethttp.Handler
+
+// HandlerFunc is a handler that returns an app.Error instead of writing it. A returned error is written to
+// the response as an RFC 7807 problem (see WriteError) and recorded on the active span of the request
+type HandlerFunc func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error
+
+// ServeHTTP satisfies the nethttp.Handler interface
+func (f HandlerFunc) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	if err := f(w, r); err != nil {
+		tracing.SpanFrom(r.Context()).RecordError(err)
+		WriteError(w, err)
+	}
+}
+
+// Router dispatches requests by method and path. Paths are made up of '/' separated segments which are either
+// static, a named parameter (":id") or a trailing catch-all parameter ("*path"). Static segments take precedence
+// over parameters. Unmatched paths result in a 404 and unmatched methods in a 405 problem response.
+type Router struct {
+	RouteGroup
+	root       *node
+	middleware []Middleware
+}
+
+// RouteGroup registers routes under a common path prefix and middleware
+type RouteGroup struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// node is a path segment of the routing tree
+type node struct {
+	static    map[string]*node
+	param     *node
+	wildcard  *node
+	paramName string
+	pattern   string
+	handlers  map[string]nethttp.Handler
+}
+
+// pathParamsKey is the context.Context key for the matched path parameters
+type pathParamsKey struct{}
+
+// NewRouter creates an empty Router
+func NewRouter() *Router {
+	r := &Router{root: &node{}}
+	r.RouteGroup = RouteGroup{router: r}
+	return r
+}
+
+// Use adds middleware that is applied to every request handled by the router, including unmatched ones
+func (rt *Router) Use(middleware ...Middleware) {
+	rt.middleware = append(rt.middleware, middleware...)
+}
+
+// ServeHTTP satisfies the nethttp.Handler interface
+func (rt *Router) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	var h nethttp.Handler = nethttp.HandlerFunc(rt.dispatch)
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	h.ServeHTTP(w, r)
+}
+
+// dispatch routes the request to the handler matching its method and path
+func (rt *Router) dispatch(w nethttp.ResponseWriter, r *nethttp.Request) {
+	params := make(map[string]string)
+	n := rt.root.match(splitPath(r.URL.Path), params)
+	if n == nil {
+		WriteError(w, app.BuildNotFoundError().
+			Str("path", r.URL.Path).
+			Msg("No route matches the request path"))
+		return
+	}
+
+	if route, ok := r.Context().Value(routeKey{}).(*matchedRoute); ok {
+		route.pattern = n.pattern
+	}
+
+	h, found := n.handlers[r.Method]
+	if !found && r.Method == nethttp.MethodHead {
+		h, found = n.handlers[nethttp.MethodGet]
+	}
+	if !found {
+		writeMethodNotAllowed(w, r, n)
+		return
+	}
+
+	if len(params) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+	}
+	h.ServeHTTP(w, r)
+}
+
+// Group creates a sub group of routes whose paths are prefixed with the given prefix and whose handlers are
+// wrapped with this group's middleware followed by the given middleware
+func (g *RouteGroup) Group(prefix string, middleware ...Middleware) *RouteGroup {
+	combined := make([]Middleware, 0, len(g.middleware)+len(middleware))
+	combined = append(combined, g.middleware...)
+	combined = append(combined, middleware...)
+	return &RouteGroup{
+		router:     g.router,
+		prefix:     joinRoutePath(g.prefix, prefix),
+		middleware: combined,
+	}
+}
+
+// Use adds middleware to the routes registered on the group after this call
+func (g *RouteGroup) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// Handle registers the handler for the given method and path. It panics if the route is already registered
+// or conflicts with the parameter name of an existing route
+func (g *RouteGroup) Handle(method string, path string, handler nethttp.Handler) {
+	pattern := joinRoutePath(g.prefix, path)
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		handler = g.middleware[i](handler)
+	}
+	g.router.root.insert(pattern, splitPath(pattern), method, handler)
+}
+
+// HandleFunc registers the HandlerFunc for the given method and path
+func (g *RouteGroup) HandleFunc(method string, path string, handler HandlerFunc) {
+	g.Handle(method, path, handler)
+}
+
+// Get registers a GET route
+func (g *RouteGroup) Get(path string, handler HandlerFunc) {
+	g.Handle(nethttp.MethodGet, path, handler)
+}
+
+// Post registers a POST route
+func (g *RouteGroup) Post(path string, handler HandlerFunc) {
+	g.Handle(nethttp.MethodPost, path, handler)
+}
+
+// Put registers a PUT route
+func (g *RouteGroup) Put(path string, handler HandlerFunc) {
+	g.Handle(nethttp.MethodPut, path, handler)
+}
+
+// Patch registers a PATCH route
+func (g *RouteGroup) Patch(path string, handler HandlerFunc) {
+	g.Handle(nethttp.MethodPatch, path, handler)
+}
+
+// Delete registers a DELETE route
+func (g *RouteGroup) Delete(path string, handler HandlerFunc) {
+	g.Handle(nethttp.MethodDelete, path, handler)
+}
+
+// PathParam returns the raw value of the named path parameter, or a blank string if it was not matched
+func PathParam(r *nethttp.Request, name string) string {
+	if params, ok := r.Context().Value(pathParamsKey{}).(map[string]string); ok {
+		return params[name]
+	}
+	return ""
+}
+
+// insert adds the route described by the path segments below this node
+func (n *node) insert(pattern string, segments []string, method string, handler nethttp.Handler) {
+	current := n
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			current = current.child(&current.param, seg[1:], pattern)
+
+		case strings.HasPrefix(seg, "*"):
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("http: catch-all parameter must be the last segment of route '%s'", pattern))
+			}
+			current = current.child(&current.wildcard, seg[1:], pattern)
+
+		default:
+			if current.static == nil {
+				current.static = make(map[string]*node)
+			}
+			next, found := current.static[seg]
+			if !found {
+				next = &node{}
+				current.static[seg] = next
+			}
+			current = next
+		}
+	}
+
+	if current.handlers == nil {
+		current.handlers = make(map[string]nethttp.Handler)
+	}
+	if _, exists := current.handlers[method]; exists {
+		panic(fmt.Sprintf("http: route %s '%s' is already registered", method, pattern))
+	}
+	current.pattern = pattern
+	current.handlers[method] = handler
+}
+
+// child returns the parameter node stored in the given slot, creating it if needed
+func (n *node) child(slot **node, name string, pattern string) *node {
+	if name == "" {
+		panic(fmt.Sprintf("http: unnamed parameter in route '%s'", pattern))
+	}
+	if *slot == nil {
+		*slot = &node{paramName: name}
+	} else if (*slot).paramName != name {
+		panic(fmt.Sprintf("http: parameter '%s' in route '%s' conflicts with existing parameter '%s'",
+			name, pattern, (*slot).paramName))
+	}
+	return *slot
+}
+
+// match finds the node with handlers matching the path segments, collecting the parameter values
+func (n *node) match(segments []string, params map[string]string) *node {
+	if len(segments) == 0 {
+		if n.handlers != nil {
+			return n
+		}
+		return nil
+	}
+
+	seg := segments[0]
+	if next, found := n.static[seg]; found {
+		if m := next.match(segments[1:], params); m != nil {
+			return m
+		}
+	}
+	if n.param != nil && seg != "" {
+		if m := n.param.match(segments[1:], params); m != nil {
+			params[n.param.paramName] = seg
+			return m
+		}
+	}
+	if n.wildcard != nil && n.wildcard.handlers != nil {
+		params[n.wildcard.paramName] = strings.Join(segments, "/")
+		return n.wildcard
+	}
+	return nil
+}
+
+func writeMethodNotAllowed(w nethttp.ResponseWriter, r *nethttp.Request, n *node) {
+	allowed := make([]string, 0, len(n.handlers))
+	for method := range n.handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+	problem := NewProblem(app.BuildIllegalStateError().
+		Str("method", r.Method).
+		Str("allowed", strings.Join(allowed, ", ")).
+		Msgf("Method %s is not allowed for %s", r.Method, n.pattern))
+	problem.Status = nethttp.StatusMethodNotAllowed
+	problem.Title = nethttp.StatusText(nethttp.StatusMethodNotAllowed)
+	writeProblem(w, problem)
+}
+
+// splitPath splits a path into its segments ignoring leading and trailing slashes
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func joinRoutePath(prefix string, path string) string {
+	joined := strings.TrimRight(prefix, "/") + "/" + strings.TrimLeft(path, "/")
+	if len(joined) > 1 {
+		joined = strings.TrimRight(joined, "/")
+	}
+	return joined
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serve(rt *Router, method string, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) *Problem {
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	p := &Problem{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(p))
+	return p
+}
+
+func TestRouter_MatchesMethodsAndParameters(t *testing.T) {
+	rt := NewRouter()
+	rt.Get("/users/:id", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		id, err := PathInt(r, "id")
+		if err != nil {
+			return err
+		}
+		_, _ = w.Write([]byte("user " + PathParam(r, "id")))
+		assert.Equal(t, 42, id)
+		return nil
+	})
+	rt.Get("/users/me", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		_, _ = w.Write([]byte("me"))
+		return nil
+	})
+	rt.Get("/files/*path", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		_, _ = w.Write([]byte(PathParam(r, "path")))
+		return nil
+	})
+
+	assert.Equal(t, "user 42", serve(rt, nethttp.MethodGet, "/users/42").Body.String())
+	assert.Equal(t, "me", serve(rt, nethttp.MethodGet, "/users/me/").Body.String())
+	assert.Equal(t, "a/b/c.txt", serve(rt, nethttp.MethodGet, "/files/a/b/c.txt").Body.String())
+
+	w := serve(rt, nethttp.MethodGet, "/users/bob")
+	assert.Equal(t, nethttp.StatusBadRequest, w.Code)
+	assert.Equal(t, "must be an integer", decodeProblem(t, w).Metadata["id"])
+
+	w = serve(rt, nethttp.MethodGet, "/accounts")
+	assert.Equal(t, nethttp.StatusNotFound, w.Code)
+
+	w = serve(rt, nethttp.MethodDelete, "/users/42")
+	assert.Equal(t, nethttp.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+}
+
+func TestRouter_GroupsApplyPrefixAndMiddleware(t *testing.T) {
+	tag := func(name string) Middleware {
+		return func(next nethttp.Handler) nethttp.Handler {
+			return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				w.Header().Add("X-Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	rt := NewRouter()
+	rt.Use(tag("router"))
+	api := rt.Group("/api", tag("api"))
+	v1 := api.Group("/v1/", tag("v1"))
+	v1.Post("/things", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		w.WriteHeader(nethttp.StatusCreated)
+		return nil
+	})
+
+	w := serve(rt, nethttp.MethodPost, "/api/v1/things")
+	assert.Equal(t, nethttp.StatusCreated, w.Code)
+	assert.Equal(t, []string{"router", "api", "v1"}, w.Header().Values("X-Middleware"))
+
+	// router middleware also applies to unmatched requests
+	w = serve(rt, nethttp.MethodPost, "/api/v2/things")
+	assert.Equal(t, nethttp.StatusNotFound, w.Code)
+	assert.Equal(t, []string{"router"}, w.Header().Values("X-Middleware"))
+}
+
+func TestRouter_PanicsOnConflicts(t *testing.T) {
+	rt := NewRouter()
+	rt.Get("/users/:id", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error { return nil })
+
+	assert.Panics(t, func() {
+		rt.Get("/users/:id", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error { return nil })
+	})
+	assert.Panics(t, func() {
+		rt.Get("/users/:name/posts", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error { return nil })
+	})
+}
+
+func TestQueryBinding(t *testing.T) {
+	r := httptest.NewRequest(nethttp.MethodGet,
+		"/?limit=10&since=2023-01-02T03:04:05Z&owner=6ba7b810-9dad-11d1-80b4-00c04fd430c8&bad=x", nil)
+
+	limit, err := QueryInt(r, "limit", 20)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, limit)
+
+	offset, err := QueryInt(r, "offset", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, offset)
+
+	since, err := QueryTime(r, "since")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), *since)
+
+	owner, err := QueryUUID(r, "owner")
+	assert.Nil(t, err)
+	assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", owner.String())
+
+	missing, err := QueryUUID(r, "missing")
+	assert.Nil(t, err)
+	assert.Nil(t, missing)
+
+	_, err = QueryUUID(r, "bad")
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+	_, err = QueryTime(r, "bad")
+	assert.Equal(t, app.ValidationErrorCode, err.Code())
+	_, err = QueryInt(r, "bad", 0)
+	assert.Equal(t, "must be an integer", err.GetMetadataValue("bad"))
+}
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"github.com/sterrasi/pinion/tracing"
+	nethttp "net/http"
+)
+
+// Tracing returns middleware starting a server span for every request. The span continues the trace of the
+// traceparent header sent by the caller, is named after the method and the pattern of the matched route
+// (ex. "GET /users/:id") and records the app.Error returned by a HandlerFunc. It must be added to the Router
+// with Router.Use
+func Tracing() Middleware {
+	return func(next nethttp.Handler) nethttp.Handler {
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			ctx := tracing.Extract(r.Context(), r.Header)
+			ctx, span := tracing.Start(ctx, "HTTP "+r.Method, tracing.ServerSpan)
+			defer span.End()
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.Path)
+
+			r, route := withMatchedRoute(r.WithContext(ctx))
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			if route.pattern != "" {
+				span.SetName(r.Method + " " + route.pattern)
+				span.SetAttribute("http.route", route.pattern)
+			}
+			status := recorder.Status()
+			span.SetAttribute("http.status_code", status)
+			if status >= nethttp.StatusInternalServerError {
+				span.SetStatus(tracing.StatusError, nethttp.StatusText(status))
+			}
+		})
+	}
+}
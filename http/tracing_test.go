@@ -0,0 +1,46 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/tracing"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// test that the server span continues the caller's trace, is named after the route and records the error
+func TestTracing_StartsServerSpan(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer("svc", tracing.NewWriterExporter(&buf), 1)
+	previous := tracing.Default()
+	tracing.SetDefault(tracer)
+	defer tracing.SetDefault(previous)
+
+	rt := NewRouter()
+	rt.Use(Metrics(), Tracing())
+	rt.Get("/tracing-test/:id", func(w nethttp.ResponseWriter, r *nethttp.Request) app.Error {
+		return app.BuildNotFoundError().Msg("Item not found")
+	})
+
+	req := httptest.NewRequest(nethttp.MethodGet, "/tracing-test/7", nil)
+	req.Header.Set(tracing.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rt.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Nil(t, tracer.Shutdown(context.Background()))
+
+	var span map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &span))
+	assert.Equal(t, "GET /tracing-test/:id", span["name"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["parentSpanId"])
+	assert.Equal(t, "Item not found", span["statusMessage"])
+
+	attributes := span["attributes"].(map[string]any)
+	assert.Equal(t, float64(404), attributes["http.status_code"])
+	assert.Equal(t, "/tracing-test/:id", attributes["http.route"])
+	assert.Equal(t, float64(1), requestCount.With("GET", "/tracing-test/:id", "404").Value())
+}
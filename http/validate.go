@@ -0,0 +1,308 @@
+package http
+
+import (
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ValidateTagName is the struct tag holding the validation rules of a field. Rules are comma separated:
+//   - required: the value cannot be the zero value (a nil pointer, an empty string or collection, etc.)
+//   - min=n / max=n: bounds the value of a number or the length of a string, slice or map
+//   - len=n: the exact length of a string, slice or map
+//   - enum=a|b|c: the value must be one of the listed values
+//   - pattern=regex: a string must match the regular expression. This must be the last rule since the
+//     expression may contain commas
+//
+// ex. `validate:"required,min=1,max=64,pattern=^[a-z]+$"`
+const ValidateTagName = "validate"
+
+// compiled validation patterns
+var patterns sync.Map
+
+// Validate checks the validate struct tags of the given struct (or pointer to struct) and its nested structs,
+// slices and maps. A single ValidationErrorCode error is returned listing every violating field path (using the
+// json field names, ex. "items[0].name") in its metadata. An IllegalArgumentError is returned if a tag cannot
+// be interpreted.
+func Validate(v any) app.Error {
+	violations := make(map[string][]string)
+	if err := validateValue(reflect.ValueOf(v), "", violations); err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(violations))
+	builder := app.BuildValidationError()
+	for path, msgs := range violations {
+		builder.Str(path, strings.Join(msgs, "; "))
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return &requestError{appError: builder.Msgf("Invalid value for %s", strings.Join(paths, ", "))}
+}
+
+// validateValue recursively validates the struct fields reachable from the given value
+func validateValue(v reflect.Value, path string, violations map[string][]string) app.Error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			name, skip := jsonFieldName(sf)
+			if skip {
+				continue
+			}
+			fieldPath := joinPath(path, name)
+			if sf.Anonymous && sf.Tag.Get("json") == "" {
+				// embedded struct fields are promoted to the parent
+				fieldPath = path
+			}
+
+			fv := v.Field(i)
+			if tag, ok := sf.Tag.Lookup(ValidateTagName); ok {
+				if err := validateField(fv, fieldPath, tag, violations); err != nil {
+					return err
+				}
+			}
+			if err := validateValue(fv, fieldPath, violations); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), violations); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elemPath := fmt.Sprintf("%s[%v]", path, iter.Key().Interface())
+			if err := validateValue(iter.Value(), elemPath, violations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField applies the rules of the given validate tag to the field value
+func validateField(v reflect.Value, path string, tag string, violations map[string][]string) app.Error {
+	rules := splitRules(tag)
+
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if _, required := rules["required"]; required {
+				violations[path] = append(violations[path], "is required")
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+	if _, required := rules["required"]; !required && v.IsZero() {
+		// an omitted optional value is valid
+		return nil
+	}
+
+	for _, rule := range orderedRules(rules) {
+		arg := rules[rule]
+		msg, err := applyRule(v, rule, arg)
+		if err != nil {
+			return app.BuildIllegalArgumentError().Cause(err).
+				Str("field", path).
+				Str("tag", tag).
+				Msgf("Invalid '%s' validation rule", rule)
+		}
+		if msg != "" {
+			violations[path] = append(violations[path], msg)
+			if rule == "required" {
+				// the remaining rules are meaningless for a missing value
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// applyRule returns a violation message if the value does not satisfy the rule
+func applyRule(v reflect.Value, rule string, arg string) (string, error) {
+	switch rule {
+	case "required":
+		if v.IsZero() {
+			return "is required", nil
+		}
+
+	case "min", "max":
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "", err
+		}
+		n, isLength, err := magnitude(v)
+		if err != nil {
+			return "", err
+		}
+		if rule == "min" && n < bound {
+			if isLength {
+				return fmt.Sprintf("must have a length of at least %s", arg), nil
+			}
+			return fmt.Sprintf("must be at least %s", arg), nil
+		}
+		if rule == "max" && n > bound {
+			if isLength {
+				return fmt.Sprintf("must have a length of at most %s", arg), nil
+			}
+			return fmt.Sprintf("must be at most %s", arg), nil
+		}
+
+	case "len":
+		expected, err := strconv.Atoi(arg)
+		if err != nil {
+			return "", err
+		}
+		switch v.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			if length(v) != expected {
+				return fmt.Sprintf("must have a length of %d", expected), nil
+			}
+		default:
+			return "", fmt.Errorf("len cannot be applied to a %s", v.Kind())
+		}
+
+	case "enum":
+		value := fmt.Sprintf("%v", v.Interface())
+		allowed := strings.Split(arg, "|")
+		for _, a := range allowed {
+			if a == value {
+				return "", nil
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(allowed, ", ")), nil
+
+	case "pattern":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("pattern cannot be applied to a %s", v.Kind())
+		}
+		re, err := compilePattern(arg)
+		if err != nil {
+			return "", err
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Sprintf("must match the pattern %s", arg), nil
+		}
+
+	default:
+		return "", fmt.Errorf("unknown validation rule '%s'", rule)
+	}
+	return "", nil
+}
+
+// magnitude returns the numeric value of a number or the length of a string or collection
+func magnitude(v reflect.Value) (float64, bool, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, nil
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(length(v)), true, nil
+	default:
+		return 0, false, fmt.Errorf("min/max cannot be applied to a %s", v.Kind())
+	}
+}
+
+// length returns the length of a collection or the number of characters in a string
+func length(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return len([]rune(v.String()))
+	}
+	return v.Len()
+}
+
+// splitRules parses a validate tag into a map of rule names to their arguments
+func splitRules(tag string) map[string]string {
+	rules := make(map[string]string)
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "pattern=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name != "" {
+			rules[name] = arg
+		}
+	}
+	return rules
+}
+
+// orderedRules returns the rule names with 'required' first so that missing values are reported once
+func orderedRules(rules map[string]string) []string {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		if name != "required" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, required := rules["required"]; required {
+		names = append([]string{"required"}, names...)
+	}
+	return names
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// jsonFieldName returns the name of the struct field as it appears in JSON and if it is skipped
+func jsonFieldName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = sf.Name
+	}
+	return name, false
+}
+
+func joinPath(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"github.com/rs/zerolog"
 	"io"
@@ -72,3 +73,27 @@ func ConfigureLogging(level zerolog.Level, unstructured bool) {
 
 	rootLogger = zerolog.New(writer).With().Timestamp().Logger()
 }
+
+// contextKey is the key type for values stored in a context.Context by this package
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the given logger. Use it to attach fields (ex. a
+// request id) that should be present on every log event written for that context
+func NewContext(ctx context.Context, l zerolog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &l)
+}
+
+// FromContext returns the logger stored in the context by NewContext, or the root logger if there is none
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*zerolog.Logger); ok {
+			return l
+		}
+	}
+	return &rootLogger
+}
+
+// Root returns the root logger
+func Root() zerolog.Logger {
+	return rootLogger
+}
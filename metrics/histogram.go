@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram bucket upper bounds suited to latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations (ex. request durations) in buckets
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomicFloat
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets))}
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	h.sum.add(v)
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the sum of the observations
+func (h *Histogram) Sum() float64 {
+	return h.sum.load()
+}
+
+// samples returns the cumulative bucket, sum and count samples of the histogram
+func (h *Histogram) samples(labels []string, values []string) []Sample {
+	bucketLabels := append(append([]string{}, labels...), "le")
+	result := make([]Sample, 0, len(h.buckets)+3)
+
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i].Load()
+		result = append(result, Sample{
+			Suffix:      "_bucket",
+			LabelNames:  bucketLabels,
+			LabelValues: append(append([]string{}, values...), formatFloat(upper)),
+			Value:       float64(cumulative),
+		})
+	}
+	count := h.count.Load()
+	result = append(result,
+		Sample{
+			Suffix:      "_bucket",
+			LabelNames:  bucketLabels,
+			LabelValues: append(append([]string{}, values...), "+Inf"),
+			Value:       float64(count),
+		},
+		Sample{Suffix: "_sum", LabelNames: labels, LabelValues: values, Value: h.sum.load()},
+		Sample{Suffix: "_count", LabelNames: labels, LabelValues: values, Value: float64(count)},
+	)
+	return result
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	name string
+	help string
+	vec  *vec[Histogram]
+}
+
+// With returns the histogram of the given label values, in the order of the label names
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.vec.with(values)
+}
+
+// Collect satisfies the Collector interface
+func (hv *HistogramVec) Collect() []*Family {
+	f := &Family{Name: hv.name, Help: hv.help, Type: HistogramType}
+	hv.vec.each(func(values []string, h *Histogram) {
+		f.Samples = append(f.Samples, h.samples(hv.vec.labels, values)...)
+	})
+	return []*Family{f}
+}
+
+// NewHistogram registers a histogram without labels. DefaultBuckets are used if buckets is nil
+func (r *Registry) NewHistogram(name string, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+// NewHistogramVec registers a family of histograms with the given label names. DefaultBuckets are used if
+// buckets is nil
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	hv := &HistogramVec{name: name, help: help, vec: newVec(labels, func() *Histogram {
+		return newHistogram(buckets)
+	})}
+	r.register(name, labels, hv)
+	return hv
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// atomicFloat is a float64 that can be updated concurrently
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter is a value that only goes up (ex. the number of requests served)
+type Counter struct {
+	value atomicFloat
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.value.add(1)
+}
+
+// Add adds the given non negative value to the counter
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counters can not decrease")
+	}
+	c.value.add(v)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() float64 {
+	return c.value.load()
+}
+
+// Gauge is a value that can go up and down (ex. the number of connections in use)
+type Gauge struct {
+	value atomicFloat
+}
+
+// Set sets the value of the gauge
+func (g *Gauge) Set(v float64) {
+	g.value.set(v)
+}
+
+// Add adds the given (possibly negative) value to the gauge
+func (g *Gauge) Add(v float64) {
+	g.value.add(v)
+}
+
+// Inc adds one to the gauge
+func (g *Gauge) Inc() {
+	g.value.add(1)
+}
+
+// Dec subtracts one from the gauge
+func (g *Gauge) Dec() {
+	g.value.add(-1)
+}
+
+// Value returns the current value of the gauge
+func (g *Gauge) Value() float64 {
+	return g.value.load()
+}
+
+// vec is a set of metrics of the same family that are distinguished by their label values
+type vec[T any] struct {
+	labels   []string
+	mu       sync.RWMutex
+	children map[string]*child[T]
+	newFn    func() *T
+}
+
+type child[T any] struct {
+	values []string
+	metric *T
+}
+
+func newVec[T any](labels []string, newFn func() *T) *vec[T] {
+	return &vec[T]{labels: labels, children: make(map[string]*child[T]), newFn: newFn}
+}
+
+// with returns the metric of the label values, creating it on first use
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("expected %d label values but got %d", len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	c, found := v.children[key]
+	v.mu.RUnlock()
+	if found {
+		return c.metric
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, found = v.children[key]; !found {
+		c = &child[T]{values: append([]string{}, values...), metric: v.newFn()}
+		v.children[key] = c
+	}
+	return c.metric
+}
+
+// each calls the function for every child ordered by label values
+func (v *vec[T]) each(fn func(values []string, metric *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	children := make([]*child[T], len(keys))
+	for i, k := range keys {
+		children[i] = v.children[k]
+	}
+	v.mu.RUnlock()
+
+	for _, c := range children {
+		fn(c.values, c.metric)
+	}
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct {
+	name string
+	help string
+	vec  *vec[Counter]
+}
+
+// With returns the counter of the given label values, in the order of the label names
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.vec.with(values)
+}
+
+// Collect satisfies the Collector interface
+func (cv *CounterVec) Collect() []*Family {
+	f := &Family{Name: cv.name, Help: cv.help, Type: CounterType}
+	cv.vec.each(func(values []string, c *Counter) {
+		f.Samples = append(f.Samples, Sample{LabelNames: cv.vec.labels, LabelValues: values, Value: c.Value()})
+	})
+	return []*Family{f}
+}
+
+// GaugeVec is a family of gauges partitioned by labels
+type GaugeVec struct {
+	name string
+	help string
+	vec  *vec[Gauge]
+}
+
+// With returns the gauge of the given label values, in the order of the label names
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.vec.with(values)
+}
+
+// Collect satisfies the Collector interface
+func (gv *GaugeVec) Collect() []*Family {
+	f := &Family{Name: gv.name, Help: gv.help, Type: GaugeType}
+	gv.vec.each(func(values []string, g *Gauge) {
+		f.Samples = append(f.Samples, Sample{LabelNames: gv.vec.labels, LabelValues: values, Value: g.Value()})
+	})
+	return []*Family{f}
+}
+
+// NewCounter registers a counter without labels
+func (r *Registry) NewCounter(name string, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+// NewCounterVec registers a family of counters with the given label names
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{name: name, help: help, vec: newVec(labels, func() *Counter { return &Counter{} })}
+	r.register(name, labels, cv)
+	return cv
+}
+
+// NewGauge registers a gauge without labels
+func (r *Registry) NewGauge(name string, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+// NewGaugeVec registers a family of gauges with the given label names
+func (r *Registry) NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	gv := &GaugeVec{name: name, help: help, vec: newVec(labels, func() *Gauge { return &Gauge{} })}
+	r.register(name, labels, gv)
+	return gv
+}
+
+// funcMetric reports the value returned by a function when the registry is gathered
+type funcMetric struct {
+	name string
+	help string
+	typ  Type
+	fn   func() float64
+}
+
+// Collect satisfies the Collector interface
+func (m *funcMetric) Collect() []*Family {
+	return []*Family{{Name: m.name, Help: m.help, Type: m.typ, Samples: []Sample{{Value: m.fn()}}}}
+}
+
+// NewGaugeFunc registers a gauge whose value is read from the function when the registry is gathered
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(name, nil, &funcMetric{name: name, help: help, typ: GaugeType, fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from the function when the registry is gathered.
+// The function must return a value that never decreases
+func (r *Registry) NewCounterFunc(name string, help string, fn func() float64) {
+	r.register(name, nil, &funcMetric{name: name, help: help, typ: CounterType, fn: fn})
+}
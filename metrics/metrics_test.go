@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func gatherText(t *testing.T, r *Registry) string {
+	var buf bytes.Buffer
+	if err := WriteText(&buf, r.Gather()); err != nil {
+		t.Fatalf("unable to write metrics: %s", err.Error())
+	}
+	return buf.String()
+}
+
+// test that counters and gauges are written in the text exposition format ordered by name and labels
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests served", "method", "status")
+	inFlight := r.NewGauge("in_flight", "Requests in flight\nnow")
+
+	requests.With("POST", "200").Inc()
+	requests.With("GET", "200").Add(2)
+	requests.With("GET", "200").Inc()
+	inFlight.Set(4)
+	inFlight.Dec()
+
+	expected := "# HELP in_flight Requests in flight\\nnow\n" +
+		"# TYPE in_flight gauge\n" +
+		"in_flight 3\n" +
+		"# HELP requests_total Requests served\n" +
+		"# TYPE requests_total counter\n" +
+		"requests_total{method=\"GET\",status=\"200\"} 3\n" +
+		"requests_total{method=\"POST\",status=\"200\"} 1\n"
+	assert.Equal(t, expected, gatherText(t, r))
+}
+
+// test that label values are escaped
+func TestWriteTextEscapesLabels(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("paths_total", "", "path").With("a\"b\\c").Inc()
+
+	assert.Equal(t, "# TYPE paths_total counter\npaths_total{path=\"a\\\"b\\\\c\"} 1\n", gatherText(t, r))
+}
+
+// test that histogram buckets are cumulative and include the +Inf bucket, sum and count
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("latency_seconds", "Latency", []float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	assert.Equal(t, uint64(4), h.Count())
+	assert.Equal(t, 3.65, h.Sum())
+
+	expected := "# HELP latency_seconds Latency\n" +
+		"# TYPE latency_seconds histogram\n" +
+		"latency_seconds_bucket{le=\"0.1\"} 2\n" +
+		"latency_seconds_bucket{le=\"1\"} 3\n" +
+		"latency_seconds_bucket{le=\"+Inf\"} 4\n" +
+		"latency_seconds_sum 3.65\n" +
+		"latency_seconds_count 4\n"
+	assert.Equal(t, expected, gatherText(t, r))
+}
+
+// test that families reported by custom collectors are merged by name
+func TestCustomCollector(t *testing.T) {
+	r := NewRegistry()
+	c := &staticCollector{instance: "a", value: 7}
+	r.Register(c)
+	r.Register(&staticCollector{instance: "b", value: 8})
+
+	families := r.Gather()
+	assert.Len(t, families, 1)
+	assert.Len(t, families[0].Samples, 2)
+
+	r.Unregister(c)
+	families = r.Gather()
+	assert.Len(t, families[0].Samples, 1)
+	assert.Equal(t, float64(8), families[0].Samples[0].Value)
+}
+
+// test that invalid and duplicate registrations panic
+func TestRegisterPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("events_total", "")
+
+	assert.Panics(t, func() { r.NewCounter("events_total", "") })
+	assert.Panics(t, func() { r.NewGauge("bad-name", "") })
+	assert.Panics(t, func() { r.NewHistogramVec("sizes", "", nil, "le") })
+	assert.Panics(t, func() { r.NewCounter("negative_total", "").Add(-1) })
+	assert.Panics(t, func() { r.NewCounterVec("labelled_total", "", "a").With() })
+}
+
+// test that the handler serves the registry with the text content type
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler(r).ServeHTTP(rec, httptest.NewRequest(nethttp.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, TextContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE hits_total counter\nhits_total 1\n", rec.Body.String())
+}
+
+// test that samples of merged families with a label set that was already reported are dropped
+func TestGatherDuplicateLabels(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&staticCollector{instance: "a", value: 7})
+	r.Register(&staticCollector{instance: "a", value: 8})
+
+	families := r.Gather()
+	assert.Len(t, families[0].Samples, 1)
+	assert.Equal(t, float64(7), families[0].Samples[0].Value)
+}
+
+// test that gathering does not modify the families returned by collectors
+func TestGatherCopiesFamilies(t *testing.T) {
+	first := &Family{Name: "static", Type: GaugeType,
+		Samples: []Sample{{LabelNames: []string{"instance"}, LabelValues: []string{"a"}}}}
+	r := NewRegistry()
+	r.Register(familiesCollector{first})
+	r.Register(&staticCollector{instance: "b"})
+
+	families := r.Gather()
+	assert.Len(t, families[0].Samples, 2)
+	assert.Len(t, first.Samples, 1)
+}
+
+type staticCollector struct {
+	instance string
+	value    float64
+}
+
+func (c *staticCollector) Collect() []*Family {
+	return []*Family{{Name: "static", Type: GaugeType, Samples: []Sample{
+		{LabelNames: []string{"instance"}, LabelValues: []string{c.instance}, Value: c.value}}}}
+}
+
+type familiesCollector []*Family
+
+func (c familiesCollector) Collect() []*Family {
+	return c
+}
+
+// test that function backed metrics are read when gathered
+func TestFuncMetrics(t *testing.T) {
+	r := NewRegistry()
+	value := 1.0
+	r.NewGaugeFunc("queue_depth", "", func() float64 { return value })
+	value = 5
+
+	families := r.Gather()
+	assert.Len(t, families, 1)
+	assert.Equal(t, GaugeType, families[0].Type)
+	assert.Equal(t, float64(5), families[0].Samples[0].Value)
+	assert.Panics(t, func() { r.NewCounterFunc("queue_depth", "", func() float64 { return 0 }) })
+}
+
+// test that the runtime metrics are reported once and can not be registered twice
+func TestRuntimeMetrics(t *testing.T) {
+	r := NewRegistry()
+	RegisterRuntimeMetrics(r)
+	assert.Panics(t, func() { RegisterRuntimeMetrics(r) })
+
+	text := gatherText(t, r)
+	assert.Contains(t, text, "# TYPE go_goroutines gauge\n")
+	assert.Contains(t, text, "# TYPE go_gc_cycles_total counter\n")
+	assert.Contains(t, text, "go_info{version=\"")
+}
+
+// test that the process metrics are parsed from the proc filesystem
+func TestProcessMetrics(t *testing.T) {
+	c := &processCollector{procPath: "testdata/proc"}
+	values := make(map[string]float64)
+	for _, f := range c.Collect() {
+		values[f.Name] = f.Samples[0].Value
+	}
+
+	assert.Equal(t, 1.5, values["process_cpu_seconds_total"])
+	assert.Equal(t, float64(2048), values["process_virtual_memory_bytes"])
+	assert.Equal(t, float64(1024), values["process_max_fds"])
+	assert.Equal(t, float64(1700000050), values["process_start_time_seconds"])
+	assert.Equal(t, float64(2), values["process_open_fds"])
+}
+
+// test that the process start time falls back to the initialization time without a proc filesystem
+func TestProcessMetricsWithoutProc(t *testing.T) {
+	c := &processCollector{procPath: "testdata/missing"}
+	families := c.Collect()
+	assert.Len(t, families, 1)
+	assert.Equal(t, "process_start_time_seconds", families[0].Name)
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the USER_HZ used by the kernel to report process times in /proc. It is 100 on every
+// architecture supported by Go
+const clockTicks = 100
+
+// initTime is used as the process start time when it can not be read from /proc
+var initTime = time.Now()
+
+// processCollector reports the cpu, memory and file descriptor usage of the process. Values are read from
+// the proc filesystem and are omitted on platforms without one
+type processCollector struct {
+	procPath string
+}
+
+var processMetricNames = []string{
+	"process_cpu_seconds_total",
+	"process_resident_memory_bytes",
+	"process_virtual_memory_bytes",
+	"process_open_fds",
+	"process_max_fds",
+	"process_start_time_seconds",
+}
+
+// RegisterProcessMetrics registers the cpu time, memory, open file descriptors and start time of the process
+func RegisterProcessMetrics(r *Registry) {
+	r.registerNames(processMetricNames, &processCollector{procPath: "/proc"})
+}
+
+// Collect satisfies the Collector interface
+func (c *processCollector) Collect() []*Family {
+	var result []*Family
+	add := func(name string, typ Type, help string, v float64) {
+		result = append(result, &Family{Name: name, Help: help, Type: typ, Samples: []Sample{{Value: v}}})
+	}
+
+	startTime := float64(initTime.UnixNano()) / 1e9
+	if stat, ok := c.readStat(); ok {
+		add("process_cpu_seconds_total", CounterType, "Total user and system cpu time spent in seconds",
+			float64(stat.utime+stat.stime)/clockTicks)
+		add("process_resident_memory_bytes", GaugeType, "Resident memory size in bytes",
+			float64(stat.rss*int64(os.Getpagesize())))
+		add("process_virtual_memory_bytes", GaugeType, "Virtual memory size in bytes", float64(stat.vsize))
+		if bootTime, found := c.readBootTime(); found {
+			startTime = float64(bootTime) + float64(stat.startTime)/clockTicks
+		}
+	}
+	if fds, err := os.ReadDir(c.procPath + "/self/fd"); err == nil {
+		add("process_open_fds", GaugeType, "Number of open file descriptors", float64(len(fds)))
+	}
+	if maxFds, found := c.readMaxFds(); found {
+		add("process_max_fds", GaugeType, "Maximum number of open file descriptors", maxFds)
+	}
+	add("process_start_time_seconds", GaugeType, "Start time of the process since the unix epoch in seconds",
+		startTime)
+	return result
+}
+
+type procStat struct {
+	utime     int64
+	stime     int64
+	startTime int64
+	vsize     int64
+	rss       int64
+}
+
+// readStat parses /proc/self/stat. The fields are read after the command name, which is enclosed in
+// parentheses and can contain spaces
+func (c *processCollector) readStat() (*procStat, bool) {
+	data, err := os.ReadFile(c.procPath + "/self/stat")
+	if err != nil {
+		return nil, false
+	}
+	s := string(data)
+	end := strings.LastIndexByte(s, ')')
+	if end < 0 {
+		return nil, false
+	}
+	// fields[0] is the state, the third field of the file
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return nil, false
+	}
+
+	values := make([]int64, 0, 5)
+	for _, i := range []int{11, 12, 19, 20, 21} {
+		v, e := strconv.ParseInt(fields[i], 10, 64)
+		if e != nil {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return &procStat{utime: values[0], stime: values[1], startTime: values[2], vsize: values[3],
+		rss: values[4]}, true
+}
+
+// readBootTime returns the boot time of the system in seconds since the unix epoch
+func (c *processCollector) readBootTime() (int64, bool) {
+	f, err := os.Open(c.procPath + "/stat")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "btime "); found {
+			bootTime, e := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			return bootTime, e == nil
+		}
+	}
+	return 0, false
+}
+
+// readMaxFds returns the soft limit of open file descriptors
+func (c *processCollector) readMaxFds() (float64, bool) {
+	data, err := os.ReadFile(c.procPath + "/self/limits")
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 {
+			return 0, false
+		}
+		v, e := strconv.ParseFloat(fields[0], 64)
+		return v, e == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Type is the type of metric family
+type Type string
+
+// Metric types
+const (
+	CounterType   Type = "counter"
+	GaugeType     Type = "gauge"
+	HistogramType Type = "histogram"
+)
+
+// Sample is a single value of a metric family
+type Sample struct {
+	// Suffix is appended to the family name (ex. "_bucket" for histogram buckets)
+	Suffix      string
+	LabelNames  []string
+	LabelValues []string
+	Value       float64
+}
+
+// Family is a named group of samples of the same type
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Collector produces metric families when the registry is gathered. Counters, gauges and histograms are
+// collectors, and custom collectors can report values that are maintained elsewhere (ex. connection pool
+// statistics)
+type Collector interface {
+	Collect() []*Family
+}
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var labelPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Registry holds the metrics of a process
+type Registry struct {
+	mu         sync.RWMutex
+	names      map[string]Collector
+	collectors []Collector
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]Collector)}
+}
+
+// Default is the registry that pinion packages instrument themselves with
+var Default = NewRegistry()
+
+// Register adds a custom collector
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Unregister removes a custom collector
+func (r *Registry) Unregister(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.collectors {
+		if existing == c {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			return
+		}
+	}
+}
+
+// register adds a named metric, panicking if the name or labels are invalid or the name is taken
+func (r *Registry) register(name string, labels []string, c Collector) {
+	for _, l := range labels {
+		if !labelPattern.MatchString(l) || l == "le" {
+			panic(fmt.Sprintf("invalid label name '%s' of metric '%s'", l, name))
+		}
+	}
+	r.registerNames([]string{name}, c)
+}
+
+// registerNames adds a collector reporting the given metric names, panicking if a name is invalid or taken
+func (r *Registry) registerNames(names []string, c Collector) {
+	for _, name := range names {
+		if !namePattern.MatchString(name) {
+			panic(fmt.Sprintf("invalid metric name '%s'", name))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		if _, found := r.names[name]; found {
+			panic(fmt.Sprintf("metric '%s' is already registered", name))
+		}
+	}
+	for _, name := range names {
+		r.names[name] = c
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// Gather collects the families of every metric ordered by name. Families of the same name reported by
+// several collectors are merged into a copy, and a sample whose label set was already reported for the family
+// is dropped
+func (r *Registry) Gather() []*Family {
+	r.mu.RLock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.RUnlock()
+
+	byName := make(map[string]*Family)
+	seen := make(map[string]map[string]bool)
+	for _, c := range collectors {
+		for _, f := range c.Collect() {
+			merged, found := byName[f.Name]
+			if !found {
+				merged = &Family{Name: f.Name, Help: f.Help, Type: f.Type, Samples: make([]Sample, 0, len(f.Samples))}
+				byName[f.Name] = merged
+				seen[f.Name] = make(map[string]bool)
+			}
+			for _, sample := range f.Samples {
+				key := sampleKey(sample)
+				if seen[f.Name][key] {
+					continue
+				}
+				seen[f.Name][key] = true
+				merged.Samples = append(merged.Samples, sample)
+			}
+		}
+	}
+
+	result := make([]*Family, 0, len(byName))
+	for _, f := range byName {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// sampleKey identifies a sample of a family by its suffix and label set, regardless of the order of the labels
+func sampleKey(s Sample) string {
+	pairs := make([]string, len(s.LabelNames))
+	for i, name := range s.LabelNames {
+		var value string
+		if i < len(s.LabelValues) {
+			value = s.LabelValues[i]
+		}
+		pairs[i] = name + "=" + value
+	}
+	sort.Strings(pairs)
+	return s.Suffix + "{" + strings.Join(pairs, "\xff") + "}"
+}
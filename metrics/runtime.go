@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"runtime"
+)
+
+// runtimeCollector reports Go runtime statistics. Memory statistics are read once per gather
+type runtimeCollector struct{}
+
+var runtimeMetricNames = []string{
+	"go_info",
+	"go_goroutines",
+	"go_threads",
+	"go_gc_cycles_total",
+	"go_gc_pause_seconds_total",
+	"go_memstats_alloc_bytes_total",
+	"go_memstats_heap_alloc_bytes",
+	"go_memstats_heap_inuse_bytes",
+	"go_memstats_heap_objects",
+	"go_memstats_mallocs_total",
+	"go_memstats_frees_total",
+	"go_memstats_next_gc_bytes",
+	"go_memstats_sys_bytes",
+}
+
+// RegisterRuntimeMetrics registers the goroutine, garbage collection and memory statistics of the Go runtime
+func RegisterRuntimeMetrics(r *Registry) {
+	r.registerNames(runtimeMetricNames, &runtimeCollector{})
+}
+
+// Collect satisfies the Collector interface
+func (c *runtimeCollector) Collect() []*Family {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	value := func(name string, typ Type, help string, v float64) *Family {
+		return &Family{Name: name, Help: help, Type: typ, Samples: []Sample{{Value: v}}}
+	}
+	return []*Family{
+		{Name: "go_info", Help: "Information about the Go environment", Type: GaugeType,
+			Samples: []Sample{{LabelNames: []string{"version"}, LabelValues: []string{runtime.Version()}, Value: 1}}},
+		value("go_goroutines", GaugeType, "Number of goroutines that currently exist",
+			float64(runtime.NumGoroutine())),
+		value("go_threads", GaugeType, "Number of OS threads created", float64(threads)),
+		value("go_gc_cycles_total", CounterType, "Number of completed garbage collection cycles",
+			float64(ms.NumGC)),
+		value("go_gc_pause_seconds_total", CounterType, "Total time the world was stopped for garbage collection",
+			float64(ms.PauseTotalNs)/1e9),
+		value("go_memstats_alloc_bytes_total", CounterType, "Total bytes allocated for heap objects",
+			float64(ms.TotalAlloc)),
+		value("go_memstats_heap_alloc_bytes", GaugeType, "Bytes of allocated heap objects",
+			float64(ms.HeapAlloc)),
+		value("go_memstats_heap_inuse_bytes", GaugeType, "Bytes in in-use heap spans", float64(ms.HeapInuse)),
+		value("go_memstats_heap_objects", GaugeType, "Number of allocated heap objects",
+			float64(ms.HeapObjects)),
+		value("go_memstats_mallocs_total", CounterType, "Total number of heap objects allocated",
+			float64(ms.Mallocs)),
+		value("go_memstats_frees_total", CounterType, "Total number of heap objects freed", float64(ms.Frees)),
+		value("go_memstats_next_gc_bytes", GaugeType, "Heap size target of the next garbage collection",
+			float64(ms.NextGC)),
+		value("go_memstats_sys_bytes", GaugeType, "Bytes of memory obtained from the OS", float64(ms.Sys)),
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	nethttp "net/http"
+	"strings"
+)
+
+// TextContentType is the content type of the Prometheus text exposition format
+const TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// WriteText writes the families in the Prometheus text exposition format
+func WriteText(w io.Writer, families []*Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if f.Help != "" {
+			_, _ = bw.WriteString("# HELP " + f.Name + " " + helpEscaper.Replace(f.Help) + "\n")
+		}
+		_, _ = bw.WriteString("# TYPE " + f.Name + " " + string(f.Type) + "\n")
+
+		for _, s := range f.Samples {
+			_, _ = bw.WriteString(f.Name + s.Suffix)
+			if len(s.LabelNames) > 0 {
+				_ = bw.WriteByte('{')
+				for i, name := range s.LabelNames {
+					if i > 0 {
+						_ = bw.WriteByte(',')
+					}
+					_, _ = bw.WriteString(name + `="` + labelEscaper.Replace(s.LabelValues[i]) + `"`)
+				}
+				_ = bw.WriteByte('}')
+			}
+			_, _ = bw.WriteString(" " + formatFloat(s.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics of the registry in the Prometheus text exposition format. It can be mounted on
+// a service's HTTP server (ex. router.Handle("GET", "/metrics", metrics.Handler(metrics.Default)))
+func Handler(r *Registry) nethttp.Handler {
+	return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, _ *nethttp.Request) {
+		w.Header().Set("Content-Type", TextContentType)
+		_ = WriteText(w, r.Gather())
+	})
+}
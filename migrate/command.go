@@ -0,0 +1,191 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateSectionName = "Migrations"
+
+const tableFieldName = "migrationsTable"
+const allowOutOfOrderFieldName = "migrationsAllowOutOfOrder"
+const dryRunFieldName = "migrationsDryRun"
+
+// CommandName is the name of the Application sub command registered by RegisterCommand
+const CommandName = "migrate"
+
+// RegisterConfig will register the config field definitions used to create the migration Options
+func RegisterConfig(reg *app.FieldRegistry) {
+
+	// schema history table
+	reg.CreateStringField(tableFieldName).
+		ArgName("migrations-table").
+		EnvVar("MIGRATIONS_TABLE").
+		ConfigName(migrateSectionName, "Table").
+		ShortDesc("Schema history table").
+		Default(DefaultTable).
+		Register()
+
+	// allow pending migrations older than the latest applied one
+	reg.CreateBooleanField(allowOutOfOrderFieldName).
+		ArgName("migrations-allow-out-of-order").
+		EnvVar("MIGRATIONS_ALLOW_OUT_OF_ORDER").
+		ConfigName(migrateSectionName, "AllowOutOfOrder").
+		ShortDesc("Allow out of order migrations").
+		Default(false).
+		Register()
+
+	// log the migrations instead of executing them
+	reg.CreateBooleanField(dryRunFieldName).
+		ArgName("migrations-dry-run").
+		EnvVar("MIGRATIONS_DRY_RUN").
+		ShortDesc("Log the migrations without executing them").
+		Default(false).
+		Register()
+}
+
+// NewOptions creates the migration Options from the given parsed app.Configuration
+func NewOptions(cfg *app.Configuration) (*Options, app.Error) {
+
+	table, err := cfg.GetStringValue(tableFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	allowOutOfOrder, err := cfg.GetBoolValue(allowOutOfOrderFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun, err := cfg.GetBoolValue(dryRunFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Options{
+		Table:           *table,
+		AllowOutOfOrder: *allowOutOfOrder,
+		DryRun:          *dryRun,
+	}, nil
+}
+
+// RegisterCommand adds the "migrate" sub command to the Application:
+//
+//	migrate up             applies all pending migrations
+//	migrate down [steps]   rolls back the given number of migrations (default 1)
+//	migrate to <version>   migrates up or down to the given version
+//	migrate status         lists every migration and whether it was applied
+//	migrate pending        lists the migrations that have not been applied
+func RegisterCommand(application *app.Application, migrator *Migrator) {
+	application.AddCommand(CommandName, "Apply or roll back schema migrations",
+		func(ctx context.Context, args []string) app.Error {
+			return runCommand(ctx, migrator, args, os.Stdout)
+		})
+}
+
+// runCommand executes the migrate sub command with the given arguments, writing its report to out
+func runCommand(ctx context.Context, migrator *Migrator, args []string, out io.Writer) app.Error {
+	if len(args) == 0 {
+		return usageError("Missing migrate sub command")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		writeMigrations(out, "Applied", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, e := strconv.Atoi(args[1])
+			if e != nil || n < 1 {
+				return usageError("The number of steps to roll back must be a positive integer")
+			}
+			steps = n
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		writeMigrations(out, "Rolled back", rolledBack)
+
+	case "to":
+		if len(args) < 2 {
+			return usageError("Missing target version")
+		}
+		version, e := strconv.ParseUint(args[1], 10, 64)
+		if e != nil {
+			return usageError("The target version must be a non negative integer")
+		}
+		changed, err := migrator.To(ctx, version)
+		if err != nil {
+			return err
+		}
+		writeMigrations(out, "Migrated", changed)
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		writeStatus(out, statuses)
+
+	case "pending":
+		pendingMigrations, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		writeMigrations(out, "Pending", pendingMigrations)
+
+	default:
+		return usageError(fmt.Sprintf("Unknown migrate sub command '%s'", args[0]))
+	}
+	return nil
+}
+
+func writeMigrations(out io.Writer, verb string, migrations []*Migration) {
+	if len(migrations) == 0 {
+		_, _ = fmt.Fprintf(out, "%s: none\n", verb)
+		return
+	}
+	_, _ = fmt.Fprintf(out, "%s:\n", verb)
+	for _, m := range migrations {
+		_, _ = fmt.Fprintf(out, "  %d %s\n", m.Version, m.Name)
+	}
+}
+
+func writeStatus(out io.Writer, statuses []*Status) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		state := "pending"
+		appliedAt := ""
+		switch {
+		case s.Missing:
+			state = "applied (missing file)"
+		case s.ChecksumMismatch:
+			state = "applied (modified)"
+		case s.Applied:
+			state = "applied"
+		}
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	_ = w.Flush()
+}
+
+func usageError(msg string) app.Error {
+	return app.BuildIllegalArgumentError().
+		Str("usage", "migrate up | down [steps] | to <version> | status | pending").
+		Msg(msg)
+}
@@ -0,0 +1,147 @@
+package migrate
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"sql/0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT)")},
+		"sql/0001_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+		"sql/0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT")},
+		"sql/0003_add_index.up.sql":      {Data: []byte("CREATE INDEX users_email ON users (email)")},
+		"sql/0003_add_index.down.sql":    {Data: []byte("DROP INDEX users_email")},
+		"sql/README.md":                  {Data: []byte("ignored")},
+	}
+}
+
+func loadTestMigrations(t *testing.T) []*Migration {
+	migrations, err := LoadFS(testFS(), "sql")
+	if err != nil {
+		t.Fatalf("Error loading migrations: %s", err.Error())
+	}
+	return migrations
+}
+
+func appliedVersions(migrations []*Migration, versions ...uint64) []*AppliedMigration {
+	known := indexMigrations(migrations)
+	result := make([]*AppliedMigration, 0, len(versions))
+	for _, v := range versions {
+		result = append(result, &AppliedMigration{
+			Version:   v,
+			Name:      known[v].Name,
+			Checksum:  known[v].Checksum,
+			AppliedAt: time.Now(),
+		})
+	}
+	return result
+}
+
+func versionsOf(migrations []*Migration) []uint64 {
+	result := make([]uint64, 0, len(migrations))
+	for _, m := range migrations {
+		result = append(result, m.Version)
+	}
+	return result
+}
+
+func TestLoadFS(t *testing.T) {
+	migrations := loadTestMigrations(t)
+
+	assert.Equal(t, []uint64{1, 2, 3}, versionsOf(migrations))
+	assert.Equal(t, "create_users", migrations[0].Name)
+	assert.Equal(t, "sql/0001_create_users.up.sql", migrations[0].UpFile)
+	assert.Equal(t, "sql/0001_create_users.down.sql", migrations[0].DownFile)
+	assert.Equal(t, "", migrations[1].DownFile)
+	assert.Len(t, migrations[0].Checksum, 64)
+}
+
+func TestLoadFS_MissingUpFile(t *testing.T) {
+	fsys := testFS()
+	fsys["sql/0004_orphan.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+
+	_, err := LoadFS(fsys, "sql")
+	assert.Equal(t, app.SystemConfigurationErrorCode, err.Code())
+}
+
+func TestPlanUp(t *testing.T) {
+	migrations := loadTestMigrations(t)
+
+	plan, err := planUp(migrations, appliedVersions(migrations, 1), 1<<63, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{2, 3}, versionsOf(plan))
+
+	plan, err = planUp(migrations, appliedVersions(migrations, 1), 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{2}, versionsOf(plan))
+}
+
+// Pending migrations older than the latest applied migration should only be applied if allowed
+func TestPlanUp_OutOfOrder(t *testing.T) {
+	migrations := loadTestMigrations(t)
+	applied := appliedVersions(migrations, 1, 3)
+
+	_, err := planUp(migrations, applied, 1<<63, false)
+	assert.Equal(t, app.IllegalStateErrorCode, err.Code())
+
+	plan, err := planUp(migrations, applied, 1<<63, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{2}, versionsOf(plan))
+}
+
+func TestPlanDown(t *testing.T) {
+	migrations := loadTestMigrations(t)
+	applied := appliedVersions(migrations, 1, 2, 3)
+
+	plan, err := planDown(migrations, applied, downTarget(applied, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3}, versionsOf(plan))
+
+	// migration 2 has no down file
+	_, err = planDown(migrations, applied, downTarget(applied, 2))
+	assert.Equal(t, app.IllegalStateErrorCode, err.Code())
+}
+
+func TestVerifyDetectsModifiedMigrations(t *testing.T) {
+	migrations := loadTestMigrations(t)
+	applied := appliedVersions(migrations, 1, 2)
+	assert.Nil(t, verify(migrations, applied))
+
+	applied[1].Checksum = "modified"
+	assert.Equal(t, app.IllegalStateErrorCode, verify(migrations, applied).Code())
+
+	statuses := buildStatus(migrations, applied)
+	assert.Len(t, statuses, 3)
+	assert.False(t, statuses[0].ChecksumMismatch)
+	assert.True(t, statuses[1].ChecksumMismatch)
+	assert.False(t, statuses[2].Applied)
+}
+
+func TestNewMigrator_SortsAndRejectsDuplicates(t *testing.T) {
+	migrations := loadTestMigrations(t)
+	reversed := []*Migration{migrations[2], migrations[0], migrations[1]}
+
+	m, err := NewMigrator(nil, reversed, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2, 3}, versionsOf(m.Migrations()))
+	assert.Equal(t, uint64(3), reversed[0].Version)
+
+	_, err = NewMigrator(nil, append(migrations, &Migration{Version: 2, Name: "other"}), nil)
+	assert.Equal(t, app.SystemConfigurationErrorCode, err.Code())
+}
+
+func TestDown_RequiresPositiveSteps(t *testing.T) {
+	m, err := NewMigrator(nil, loadTestMigrations(t), nil)
+	if err != nil {
+		t.Fatalf("Error creating migrator: %s", err.Error())
+	}
+	_, err = m.Down(context.Background(), 0)
+	assert.Equal(t, app.IllegalArgumentError, err.Code())
+	_, err = m.Down(context.Background(), -1)
+	assert.Equal(t, app.IllegalArgumentError, err.Code())
+}
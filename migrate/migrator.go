@@ -0,0 +1,311 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/sterrasi/pinion/logger"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultTable is the name of the schema history table if none is configured
+const DefaultTable = "schema_history"
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Options configure a Migrator
+type Options struct {
+	// Table is the (optionally schema qualified) schema history table
+	Table string
+	// AllowOutOfOrder allows pending migrations older than the latest applied one to be applied
+	AllowOutOfOrder bool
+	// DryRun logs the migrations that would be applied or rolled back without executing them
+	DryRun bool
+	// LockKey is the postgres advisory lock key. It is derived from the Table if not set
+	LockKey int64
+}
+
+// lockTxOptions are the options of the transaction holding the migration lock. It is read committed so that
+// the schema history is read with a snapshot taken after the lock was granted, and it is never retried since
+// the migration files are not necessarily idempotent
+var lockTxOptions = &db.TransactionOptions{
+	AccessMode:     db.ReadWrite,
+	DeferrableMode: db.NotDeferrable,
+	IsoLevel:       db.ReadCommitted,
+	Retry:          db.NoRetry,
+}
+
+// Migrator applies and rolls back versioned migrations against a postgres database. Every operation runs in
+// a single transaction holding an advisory lock, so concurrently starting instances do not race and a failed
+// migration leaves the schema untouched
+type Migrator struct {
+	database   db.DB
+	migrations []*Migration
+	opts       Options
+}
+
+// NewMigrator creates a Migrator for the given migrations (see LoadDir and LoadFS), which are sorted by
+// version. Migrations sharing a version are rejected. If opts is nil then the defaults are used
+func NewMigrator(database db.DB, migrations []*Migration, opts *Options) (*Migrator, app.Error) {
+	sorted := append([]*Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, app.BuildSysConfigError().
+				Str("version", strconv.FormatUint(sorted[i].Version, 10)).
+				Str("name", sorted[i].Name).
+				Str("existingName", sorted[i-1].Name).
+				Msg("Duplicate migration version")
+		}
+	}
+
+	m := &Migrator{database: database, migrations: sorted}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.Table == "" {
+		m.opts.Table = DefaultTable
+	}
+	if !identifierPattern.MatchString(m.opts.Table) {
+		return nil, app.BuildSysConfigError().
+			Str("table", m.opts.Table).
+			Msg("Invalid schema history table name")
+	}
+	if m.opts.LockKey == 0 {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte("pinion-migrate:" + m.opts.Table))
+		m.opts.LockKey = int64(h.Sum64() & math.MaxInt64)
+	}
+	return m, nil
+}
+
+// Migrations returns the known migrations ordered by version
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+// Up applies all pending migrations and returns them
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, app.Error) {
+	return m.To(ctx, math.MaxUint64)
+}
+
+// Down rolls back the given number of most recently applied migrations and returns them. The number of steps
+// must be at least 1
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, app.Error) {
+	if steps < 1 {
+		return nil, app.BuildIllegalArgumentError().
+			Str("steps", strconv.Itoa(steps)).
+			Msg("The number of steps to roll back must be at least 1")
+	}
+	var result []*Migration
+	err := m.locked(ctx, func(handle db.DatabaseHandle, applied []*AppliedMigration) app.Error {
+		plan, err := planDown(m.migrations, applied, downTarget(applied, steps))
+		if err != nil {
+			return err
+		}
+		result = plan
+		return m.rollBack(ctx, handle, plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// To migrates the schema up or down to the given version and returns the migrations that were applied or
+// rolled back
+func (m *Migrator) To(ctx context.Context, version uint64) ([]*Migration, app.Error) {
+	var result []*Migration
+	err := m.locked(ctx, func(handle db.DatabaseHandle, applied []*AppliedMigration) app.Error {
+		if latestVersion(applied) > version {
+			plan, err := planDown(m.migrations, applied, version)
+			if err != nil {
+				return err
+			}
+			result = plan
+			return m.rollBack(ctx, handle, plan)
+		}
+
+		plan, err := planUp(m.migrations, applied, version, m.opts.AllowOutOfOrder)
+		if err != nil {
+			return err
+		}
+		result = plan
+		return m.apply(ctx, handle, plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Status returns the state of every known or applied migration ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]*Status, app.Error) {
+	var result []*Status
+	err := m.database.ReadTransaction(ctx, func(handle db.DatabaseHandle) app.Error {
+		applied, err := m.loadApplied(ctx, handle)
+		if err != nil {
+			return err
+		}
+		result = buildStatus(m.migrations, applied)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Pending returns the migrations that have not been applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]*Migration, app.Error) {
+	var result []*Migration
+	err := m.database.ReadTransaction(ctx, func(handle db.DatabaseHandle) app.Error {
+		applied, err := m.loadApplied(ctx, handle)
+		if err != nil {
+			return err
+		}
+		result = pending(m.migrations, applied)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// locked runs the function in a read committed transaction holding the migration advisory lock, after creating
+// the schema history table and verifying the checksums of the applied migrations. Every statement of a read
+// committed transaction sees the changes committed before it started, so the history loaded once the lock is
+// granted includes the migrations of an instance that held the lock before
+func (m *Migrator) locked(ctx context.Context,
+	fn func(handle db.DatabaseHandle, applied []*AppliedMigration) app.Error) app.Error {
+
+	return m.database.Transaction(ctx, lockTxOptions, func(handle db.DatabaseHandle) app.Error {
+		if _, err := handle.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", m.opts.LockKey); err != nil {
+			err.SetContext("AcquireMigrationLock")
+			return err
+		}
+
+		if !m.opts.DryRun {
+			if _, err := handle.Exec(ctx, m.createTableSQL()); err != nil {
+				err.SetContext("CreateSchemaHistoryTable")
+				return err
+			}
+		}
+
+		applied, err := m.loadApplied(ctx, handle)
+		if err != nil {
+			return err
+		}
+		if err = verify(m.migrations, applied); err != nil {
+			return err
+		}
+		return fn(handle, applied)
+	})
+}
+
+// apply executes the up files of the migrations and records them in the schema history table
+func (m *Migrator) apply(ctx context.Context, handle db.DatabaseHandle, plan []*Migration) app.Error {
+	insert := &db.InsertStatement{
+		Name: "InsertSchemaHistory",
+		SQL: fmt.Sprintf("INSERT INTO %s (version, name, checksum, execution_ms) VALUES ($1, $2, $3, $4)",
+			m.opts.Table),
+	}
+
+	for _, mig := range plan {
+		if m.opts.DryRun {
+			logMigration(mig, "Would apply migration (dry run)")
+			continue
+		}
+
+		start := time.Now()
+		if err := handle.ExecFS(ctx, mig.fsys, mig.UpFile); err != nil {
+			return err
+		}
+		elapsed := time.Since(start)
+		if err := handle.Insert(ctx, insert, int64(mig.Version), mig.Name, mig.Checksum,
+			elapsed.Milliseconds()); err != nil {
+			return err
+		}
+		logMigration(mig, "Applied migration")
+	}
+	return nil
+}
+
+// rollBack executes the down files of the migrations and removes them from the schema history table
+func (m *Migrator) rollBack(ctx context.Context, handle db.DatabaseHandle, plan []*Migration) app.Error {
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.opts.Table)
+
+	for _, mig := range plan {
+		if m.opts.DryRun {
+			logMigration(mig, "Would roll back migration (dry run)")
+			continue
+		}
+
+		if err := handle.ExecFS(ctx, mig.fsys, mig.DownFile); err != nil {
+			return err
+		}
+		if _, err := handle.Exec(ctx, deleteSQL, int64(mig.Version)); err != nil {
+			err.SetContext("DeleteSchemaHistory")
+			return err
+		}
+		logMigration(mig, "Rolled back migration")
+	}
+	return nil
+}
+
+// loadApplied returns the records of the schema history table. If the table does not exist then no
+// migrations have been applied
+func (m *Migrator) loadApplied(ctx context.Context, handle db.DatabaseHandle) ([]*AppliedMigration, app.Error) {
+	exists := &db.QueryStatement[db.ExistsValue]{
+		Name:   "SchemaHistoryExists",
+		SQL:    "SELECT to_regclass($1) IS NOT NULL",
+		Mapper: db.ExistsMapper,
+	}
+	ev, err := exists.QueryRow(ctx, handle, m.opts.Table)
+	if err != nil {
+		return nil, err
+	}
+	if !ev.Exists {
+		return []*AppliedMigration{}, nil
+	}
+
+	history := &db.QueryStatement[AppliedMigration]{
+		Name: "SelectSchemaHistory",
+		SQL:  fmt.Sprintf("SELECT version, name, checksum, applied_at FROM %s ORDER BY version", m.opts.Table),
+		Mapper: func(scanner db.Scanner, model *AppliedMigration) app.Error {
+			var version int64
+			if err := scanner.Scan(&version, &model.Name, &model.Checksum, &model.AppliedAt); err != nil {
+				return err
+			}
+			model.Version = uint64(version)
+			return nil
+		},
+	}
+	return history.Query(ctx, handle)
+}
+
+func (m *Migrator) createTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version      BIGINT PRIMARY KEY,
+	name         TEXT NOT NULL,
+	checksum     TEXT NOT NULL,
+	execution_ms BIGINT NOT NULL,
+	applied_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, m.opts.Table)
+}
+
+func logMigration(mig *Migration, msg string) {
+	logger.Info().
+		Str("version", strconv.FormatUint(mig.Version, 10)).
+		Str("name", mig.Name).
+		Msg(msg)
+}
@@ -0,0 +1,58 @@
+package migrate_test
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/migrate"
+	"github.com/sterrasi/pinion/postgres/pgtest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// the tests of this file run against a postgres server (see pgtest), in an external test package since
+// pgtest depends on the migrate package
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
+}
+
+// test that a migrator waiting for the lock sees the migrations applied by the one holding it
+func TestConcurrentMigrators(t *testing.T) {
+	database := pgtest.NewDB(t, nil)
+	fsys := fstest.MapFS{
+		"sql/0001_create_users.up.sql": {Data: []byte("CREATE TABLE users (id BIGINT); SELECT pg_sleep(0.2)")},
+		"sql/0002_add_email.up.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT")},
+	}
+	migrations, err := migrate.LoadFS(fsys, "sql")
+	if err != nil {
+		t.Fatalf("Error loading migrations: %s", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	applied := make([][]*migrate.Migration, 2)
+	errs := make([]error, 2)
+	for i := range applied {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrator, err := migrate.NewMigrator(database, migrations, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			result, err := migrator.Up(context.Background())
+			applied[i] = result
+			if err != nil {
+				errs[i] = err
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.Equal(t, 2, len(applied[0])+len(applied[1]), "every migration is applied exactly once")
+}
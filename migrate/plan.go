@@ -0,0 +1,179 @@
+package migrate
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AppliedMigration is a record of the schema history table
+type AppliedMigration struct {
+	Version   uint64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Status describes the state of a migration in the database
+type Status struct {
+	Version   uint64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	// ChecksumMismatch is true if the up file was modified after the migration was applied
+	ChecksumMismatch bool
+	// Missing is true if the migration was applied but its files no longer exist
+	Missing bool
+}
+
+// buildStatus merges the known migrations with the applied ones, ordered by version
+func buildStatus(migrations []*Migration, applied []*AppliedMigration) []*Status {
+	byVersion := make(map[uint64]*Status)
+	for _, m := range migrations {
+		byVersion[m.Version] = &Status{Version: m.Version, Name: m.Name}
+	}
+	known := indexMigrations(migrations)
+	for _, a := range applied {
+		appliedAt := a.AppliedAt
+		s, found := byVersion[a.Version]
+		if !found {
+			s = &Status{Version: a.Version, Name: a.Name, Missing: true}
+			byVersion[a.Version] = s
+		} else {
+			s.ChecksumMismatch = known[a.Version].Checksum != a.Checksum
+		}
+		s.Applied = true
+		s.AppliedAt = &appliedAt
+	}
+
+	result := make([]*Status, 0, len(byVersion))
+	for _, s := range byVersion {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+// verify makes sure that none of the applied migrations were modified after they were applied
+func verify(migrations []*Migration, applied []*AppliedMigration) app.Error {
+	known := indexMigrations(migrations)
+	for _, a := range applied {
+		m, found := known[a.Version]
+		if found && m.Checksum != a.Checksum {
+			return app.BuildIllegalStateError().
+				Str("version", strconv.FormatUint(a.Version, 10)).
+				Str("name", a.Name).
+				Str("appliedChecksum", a.Checksum).
+				Str("fileChecksum", m.Checksum).
+				Msg("Migration was modified after it was applied")
+		}
+	}
+	return nil
+}
+
+// pending returns the migrations that have not been applied, ordered by version
+func pending(migrations []*Migration, applied []*AppliedMigration) []*Migration {
+	appliedVersions := indexApplied(applied)
+	result := make([]*Migration, 0)
+	for _, m := range migrations {
+		if _, found := appliedVersions[m.Version]; !found {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// planUp returns the pending migrations up to (and including) the target version. Pending migrations older
+// than the latest applied migration are an error unless allowOutOfOrder is set
+func planUp(migrations []*Migration, applied []*AppliedMigration, target uint64,
+	allowOutOfOrder bool) ([]*Migration, app.Error) {
+
+	latest := latestVersion(applied)
+	result := make([]*Migration, 0)
+	for _, m := range pending(migrations, applied) {
+		if m.Version > target {
+			break
+		}
+		if m.Version < latest && !allowOutOfOrder {
+			return nil, app.BuildIllegalStateError().
+				Str("version", strconv.FormatUint(m.Version, 10)).
+				Str("name", m.Name).
+				Str("latestAppliedVersion", strconv.FormatUint(latest, 10)).
+				Msg("Pending migration is older than the latest applied migration")
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// planDown returns the applied migrations newer than the target version, newest first. Each of them must
+// have a down file
+func planDown(migrations []*Migration, applied []*AppliedMigration, target uint64) ([]*Migration, app.Error) {
+	known := indexMigrations(migrations)
+
+	versions := make([]uint64, 0)
+	for _, a := range applied {
+		if a.Version > target {
+			versions = append(versions, a.Version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+
+	result := make([]*Migration, 0, len(versions))
+	for _, v := range versions {
+		m, found := known[v]
+		if !found || m.DownFile == "" {
+			return nil, app.BuildIllegalStateError().
+				Str("version", strconv.FormatUint(v, 10)).
+				Msg("Applied migration has no down file")
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// downTarget returns the version that remains after rolling back the given number of applied migrations
+func downTarget(applied []*AppliedMigration, steps int) uint64 {
+	versions := make([]uint64, 0, len(applied))
+	for _, a := range applied {
+		versions = append(versions, a.Version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+	if steps >= len(versions) {
+		return 0
+	}
+	return versions[steps]
+}
+
+func latestVersion(applied []*AppliedMigration) uint64 {
+	var latest uint64
+	for _, a := range applied {
+		if a.Version > latest {
+			latest = a.Version
+		}
+	}
+	return latest
+}
+
+func indexMigrations(migrations []*Migration) map[uint64]*Migration {
+	result := make(map[uint64]*Migration, len(migrations))
+	for _, m := range migrations {
+		result[m.Version] = m
+	}
+	return result
+}
+
+func indexApplied(applied []*AppliedMigration) map[uint64]*AppliedMigration {
+	result := make(map[uint64]*AppliedMigration, len(applied))
+	for _, a := range applied {
+		result[a.Version] = a
+	}
+	return result
+}
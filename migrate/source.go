@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sterrasi/pinion/app"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// migration file names: <version>_<name>.up.sql and <version>_<name>.down.sql (ex. 0001_create_users.up.sql)
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([^.]+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change made up of an up SQL file and an optional down SQL file
+type Migration struct {
+	Version  uint64
+	Name     string
+	UpFile   string
+	DownFile string
+	// Checksum is the hex encoded SHA-256 of the up SQL file
+	Checksum string
+	fsys     fs.FS
+}
+
+// LoadDir loads the migrations in the given directory on disk
+func LoadDir(dir string) ([]*Migration, app.Error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, app.BuildIOError().
+			Cause(err).
+			Str("dir", dir).
+			Msg("Migration directory does not exist")
+	}
+	return LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS loads the migrations in the given directory of the file system (ex. an embed.FS). Files that
+// do not follow the migration naming convention are ignored. The migrations are ordered by version
+func LoadFS(fsys fs.FS, dir string) ([]*Migration, app.Error) {
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, app.BuildIOError().
+			Cause(err).
+			Str("dir", dir).
+			Msg("Error reading migration directory")
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, app.BuildSysConfigError().
+				Cause(err).
+				Str("file", entry.Name()).
+				Msg("Invalid migration version")
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &Migration{Version: version, Name: match[2], fsys: fsys}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, app.BuildSysConfigError().
+				Str("version", match[1]).
+				Str("name", match[2]).
+				Str("existingName", m.Name).
+				Msg("Duplicate migration version")
+		}
+
+		filePath := path.Join(dir, entry.Name())
+		if match[3] == "up" {
+			m.UpFile = filePath
+		} else {
+			m.DownFile = filePath
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpFile == "" {
+			return nil, app.BuildSysConfigError().
+				Str("version", strconv.FormatUint(m.Version, 10)).
+				Str("name", m.Name).
+				Msg("Migration is missing its up file")
+		}
+		contents, err := fs.ReadFile(fsys, m.UpFile)
+		if err != nil {
+			return nil, app.BuildIOError().
+				Cause(err).
+				Str("file", m.UpFile).
+				Msg("Error reading migration file")
+		}
+		sum := sha256.Sum256(contents)
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
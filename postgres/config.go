@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// poolConfig creates the pgxpool configuration described by the db.DbConfig
+func poolConfig(cfg *db.DbConfig) (*pgxpool.Config, app.Error) {
+
+	host, port := hostAndPort(cfg)
+	params := [][2]string{
+		{"host", host},
+		{"port", port},
+		{"dbname", cfg.DbName},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"sslmode", cfg.SSLMode},
+		{"sslrootcert", cfg.TLSCaFile},
+		{"sslcert", cfg.TLSCertFile},
+		{"sslkey", cfg.TLSKeyFile},
+		{"application_name", cfg.ApplicationName},
+	}
+	var dsn strings.Builder
+	for _, p := range params {
+		if p[1] == "" {
+			continue
+		}
+		if dsn.Len() > 0 {
+			dsn.WriteByte(' ')
+		}
+		dsn.WriteString(p[0])
+		dsn.WriteByte('=')
+		dsn.WriteString(quoteDSNValue(p[1]))
+	}
+
+	poolCfg, err := pgxpool.ParseConfig(dsn.String())
+	if err != nil {
+		return nil, app.BuildSysConfigError().
+			Cause(err).
+			Str("database", describe(cfg)).
+			Msg("Invalid database configuration")
+	}
+
+	connCfg := poolCfg.ConnConfig
+	connCfg.ConnectTimeout = cfg.ConnectTimeout
+	if cfg.Schema != "" {
+		connCfg.RuntimeParams["search_path"] = cfg.Schema
+	}
+	if cfg.StatementTimeout > 0 {
+		connCfg.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if cfg.MaxOpenConnections > 0 {
+		poolCfg.MaxConns = int32(cfg.MaxOpenConnections)
+	}
+	poolCfg.MinConns = int32(cfg.MinConnections)
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+	return poolCfg, nil
+}
+
+// hostAndPort returns the host and port to connect to. A port included in the host takes precedence
+func hostAndPort(cfg *db.DbConfig) (string, string) {
+	if host, port, err := net.SplitHostPort(cfg.Host); err == nil {
+		return host, port
+	}
+	if cfg.Port == 0 {
+		return cfg.Host, ""
+	}
+	return cfg.Host, strconv.FormatUint(uint64(cfg.Port), 10)
+}
+
+// describe returns a loggable description of the database, without credentials
+func describe(cfg *db.DbConfig) string {
+	host, port := hostAndPort(cfg)
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	return "postgres://" + host + "/" + cfg.DbName
+}
+
+// quoteDSNValue quotes a keyword/value connection string value
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
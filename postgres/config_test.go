@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// test that the DbConfig is applied to the pool configuration
+func TestPoolConfig(t *testing.T) {
+	cfg := &db.DbConfig{
+		DbName:             "orders",
+		Host:               "db.example.com",
+		Port:               6432,
+		User:               "app",
+		Password:           `it's\secret`,
+		Schema:             "sales",
+		SSLMode:            "disable",
+		ConnectTimeout:     5 * time.Second,
+		StatementTimeout:   30 * time.Second,
+		ApplicationName:    "order service",
+		MaxOpenConnections: 15,
+		MinConnections:     2,
+		MaxConnLifetime:    time.Hour,
+		MaxConnIdleTime:    10 * time.Minute,
+		HealthCheckPeriod:  30 * time.Second,
+	}
+
+	poolCfg, err := poolConfig(cfg)
+	if err != nil {
+		t.Fatalf("unable to create pool config: %s", err.Error())
+	}
+	conn := poolCfg.ConnConfig
+	assert.Equal(t, "db.example.com", conn.Host)
+	assert.Equal(t, uint16(6432), conn.Port)
+	assert.Equal(t, "orders", conn.Database)
+	assert.Equal(t, "app", conn.User)
+	assert.Equal(t, `it's\secret`, conn.Password)
+	assert.Nil(t, conn.TLSConfig)
+	assert.Equal(t, 5*time.Second, conn.ConnectTimeout)
+	assert.Equal(t, "sales", conn.RuntimeParams["search_path"])
+	assert.Equal(t, "30000", conn.RuntimeParams["statement_timeout"])
+	assert.Equal(t, "order service", conn.RuntimeParams["application_name"])
+	assert.Equal(t, int32(15), poolCfg.MaxConns)
+	assert.Equal(t, int32(2), poolCfg.MinConns)
+	assert.Equal(t, time.Hour, poolCfg.MaxConnLifetime)
+	assert.Equal(t, 10*time.Minute, poolCfg.MaxConnIdleTime)
+	assert.Equal(t, 30*time.Second, poolCfg.HealthCheckPeriod)
+}
+
+// test that a port included in the host takes precedence and that credentials are not described
+func TestHostAndPort(t *testing.T) {
+	cfg := &db.DbConfig{Host: "localhost:5433", Port: 5432, DbName: "test", Password: "secret"}
+	host, port := hostAndPort(cfg)
+	assert.Equal(t, "localhost", host)
+	assert.Equal(t, "5433", port)
+	assert.Equal(t, "postgres://localhost:5433/test", describe(cfg))
+}
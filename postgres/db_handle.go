@@ -6,18 +6,22 @@ import (
 	"github.com/sterrasi/pinion/app"
 	"github.com/sterrasi/pinion/db"
 	"github.com/sterrasi/pinion/logger"
+	"io/fs"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // implementation struct for a db.DatabaseHandle
 type dbHandleImpl struct {
-	db.SqlHandle
+	*sqlHandleImpl
+	tx pgx.Tx
 }
 
 // NewDatabaseHandle creates a db.DatabaseHandle from the given transaction
 func NewDatabaseHandle(tx pgx.Tx) db.DatabaseHandle {
-	return &dbHandleImpl{&sqlHandleImpl{tx: tx}}
+	return &dbHandleImpl{sqlHandleImpl: &sqlHandleImpl{q: tx}, tx: tx}
 }
 
 // ExecFile will execute the given SQL file
@@ -37,6 +41,24 @@ func (dh *dbHandleImpl) ExecFile(filePath string) app.Error {
 	return nil
 }
 
+// ExecFS will execute the SQL file at the given path of the file system (ex. an embed.FS)
+func (dh *dbHandleImpl) ExecFS(ctx context.Context, fsys fs.FS, filePath string) app.Error {
+
+	c, err := fs.ReadFile(fsys, filePath)
+	if err != nil {
+		return app.BuildIOError().
+			Cause(err).
+			Str("file", filePath).
+			Msg("Error reading file")
+	}
+	_, appErr := dh.Exec(ctx, string(c))
+	if appErr != nil {
+		appErr.SetContext(filePath)
+		return appErr
+	}
+	return nil
+}
+
 // Insert will execute an insert statement and expect the addition of a record as a result
 func (dh *dbHandleImpl) Insert(ctx context.Context, stmt *db.InsertStatement, args ...any) app.Error {
 
@@ -73,9 +95,15 @@ func (dh *dbHandleImpl) doInsert(ctx context.Context, stmt *db.InsertStatement,
 		Str("statementName", stmt.Name).
 		Msg("Executing Insert")
 
+	start := time.Now()
+	defer db.ObserveStatement(stmt.Name, start)
+	ctx, span := db.StartStatementSpan(ctx, stmt.Name, stmt.SQL)
+	defer span.End()
+
 	tag, err := dh.Exec(ctx, stmt.SQL, args...)
 	if err != nil {
 		err.SetContext(stmt.Name)
+		span.RecordError(err)
 		return nil, err
 	}
 
@@ -86,3 +114,113 @@ func (dh *dbHandleImpl) doInsert(ctx context.Context, stmt *db.InsertStatement,
 
 	return tag, nil
 }
+
+// Savepoint executes the function within a SAVEPOINT that is released if it succeeds and rolled back to if it
+// fails
+func (dh *dbHandleImpl) Savepoint(ctx context.Context, fn db.TransactionFn) app.Error {
+
+	nested, err := dh.tx.Begin(ctx)
+	if err != nil {
+		return handlePgxError(err, &statementDescriptor{operation: "savepoint"})
+	}
+
+	appErr := fn(NewDatabaseHandle(nested))
+	if appErr != nil {
+		if err = nested.Rollback(ctx); err != nil {
+			logger.Warn().
+				Str("error", err.Error()).
+				Msg("Error rolling back to savepoint")
+		}
+		return appErr
+	}
+	if err = nested.Commit(ctx); err != nil {
+		return handlePgxError(err, &statementDescriptor{operation: "release savepoint"})
+	}
+	return nil
+}
+
+// BulkInsert copies the rows into the table with the postgres COPY protocol
+func (dh *dbHandleImpl) BulkInsert(ctx context.Context, table string, columns []string,
+	rows db.RowSource) (int64, app.Error) {
+
+	logger.Debug().
+		Str("table", table).
+		Msg("Executing bulk insert")
+
+	count, err := dh.tx.CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns, rows)
+	if err != nil {
+		return 0, handlePgxError(err, &statementDescriptor{
+			operation: "bulk insert",
+			context:   table,
+		})
+	}
+
+	logger.Debug().
+		Str("table", table).
+		Str("rowsInserted", strconv.FormatInt(count, 10)).
+		Msg("Executed bulk insert")
+
+	return count, nil
+}
+
+// SendBatch sends the queued statements of the batch in a single round trip
+func (dh *dbHandleImpl) SendBatch(ctx context.Context, batch *db.Batch) app.Error {
+
+	logger.Debug().
+		Int("statements", batch.Len()).
+		Msg("Sending batch")
+
+	pgxBatch := &pgx.Batch{}
+	for _, stmt := range batch.Statements() {
+		sql, args, err := bindArgs(stmt.SQL, stmt.Args)
+		if err != nil {
+			err.SetContext(stmt.Name)
+			return err
+		}
+		pgxBatch.Queue(sql, args...)
+	}
+
+	results := dh.tx.SendBatch(ctx, pgxBatch)
+	var firstErr app.Error
+	for _, stmt := range batch.Statements() {
+		reader := &pgxBatchReader{
+			results: results,
+			desc: &statementDescriptor{
+				operation: "batch",
+				sql:       stmt.SQL,
+			},
+		}
+		if err := stmt.Read(reader); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := results.Close(); err != nil && firstErr == nil {
+		firstErr = handlePgxError(err, &statementDescriptor{operation: "batch"})
+	}
+	return firstErr
+}
+
+// pgxBatchReader implements a db.BatchReader
+type pgxBatchReader struct {
+	results pgx.BatchResults
+	desc    *statementDescriptor
+}
+
+func (br *pgxBatchReader) Exec() (*db.ExecResult, app.Error) {
+	tag, err := br.results.Exec()
+	if err != nil {
+		return nil, handlePgxError(err, br.desc)
+	}
+	return &db.ExecResult{
+		RowsAffected: uint(tag.RowsAffected()),
+		Id:           tag.String(),
+	}, nil
+}
+
+func (br *pgxBatchReader) Query() (db.RowIterator, app.Error) {
+	rows, err := br.results.Query()
+	if err != nil {
+		return nil, handlePgxError(err, br.desc)
+	}
+	return &pgxRowsWrapper{rows: rows, desc: br.desc}, nil
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fakeTx is a pgx.Tx recording the statements and the savepoint operations executed on it
+type fakeTx struct {
+	pgx.Tx
+	log *[]string
+}
+
+func newFakeTx() *fakeTx {
+	return &fakeTx{log: &[]string{}}
+}
+
+func (f *fakeTx) Begin(context.Context) (pgx.Tx, error) {
+	*f.log = append(*f.log, "SAVEPOINT")
+	return &fakeTx{log: f.log}, nil
+}
+
+func (f *fakeTx) Commit(context.Context) error {
+	*f.log = append(*f.log, "RELEASE SAVEPOINT")
+	return nil
+}
+
+func (f *fakeTx) Rollback(context.Context) error {
+	*f.log = append(*f.log, "ROLLBACK TO SAVEPOINT")
+	return nil
+}
+
+func (f *fakeTx) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	*f.log = append(*f.log, sql)
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+// test that a savepoint is released when its function succeeds
+func TestSavepointReleased(t *testing.T) {
+	tx := newFakeTx()
+	handle := NewDatabaseHandle(tx)
+
+	err := handle.Savepoint(context.Background(), func(nested db.DatabaseHandle) app.Error {
+		_, err := nested.Exec(context.Background(), "INSERT INTO items VALUES (1)")
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SAVEPOINT", "INSERT INTO items VALUES (1)", "RELEASE SAVEPOINT"}, *tx.log)
+}
+
+// test that a failed savepoint is rolled back to while the outer transaction can continue
+func TestSavepointRolledBack(t *testing.T) {
+	tx := newFakeTx()
+	handle := NewDatabaseHandle(tx)
+
+	err := handle.Savepoint(context.Background(), func(nested db.DatabaseHandle) app.Error {
+		_, _ = nested.Exec(context.Background(), "INSERT INTO items VALUES (1)")
+		return app.NewValidationError("duplicate item")
+	})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "duplicate item", app.MessageOf(err))
+	}
+
+	_, err = handle.Exec(context.Background(), "INSERT INTO items VALUES (2)")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SAVEPOINT", "INSERT INTO items VALUES (1)", "ROLLBACK TO SAVEPOINT",
+		"INSERT INTO items VALUES (2)"}, *tx.log)
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/metrics"
+)
+
+var errorCount = metrics.Default.NewCounterVec("pinion_db_errors_total",
+	"Database errors by pinion error code", "code")
+
+var transactionCount = metrics.Default.NewCounterVec("pinion_db_transactions_total",
+	"Completed database transactions by outcome (commit or rollback)", "outcome")
+
+// countError counts the database error by its code and returns it
+func countError(err app.Error) app.Error {
+	if err != nil {
+		errorCount.With(err.CodeValue()).Inc()
+	}
+	return err
+}
+
+// poolCollector reports the statistics of the primary and replica connection pools of a pgDb. The samples are
+// labelled with the database name so that the pools of several pgDb instances can be told apart
+type poolCollector struct {
+	pg *pgDb
+}
+
+// Collect satisfies the metrics.Collector interface
+func (c *poolCollector) Collect() []*metrics.Family {
+	acquires := &metrics.Family{Name: "pinion_db_pool_acquires_total", Type: metrics.CounterType,
+		Help: "Connections acquired from the pool"}
+	emptyAcquires := &metrics.Family{Name: "pinion_db_pool_empty_acquires_total", Type: metrics.CounterType,
+		Help: "Acquires that had to wait for a connection because the pool was empty"}
+	acquireWait := &metrics.Family{Name: "pinion_db_pool_acquire_wait_seconds_total", Type: metrics.CounterType,
+		Help: "Total time spent acquiring connections from the pool"}
+	connections := &metrics.Family{Name: "pinion_db_pool_connections", Type: metrics.GaugeType,
+		Help: "Pool connections by state (idle, in_use or constructing)"}
+	maxConnections := &metrics.Family{Name: "pinion_db_pool_max_connections", Type: metrics.GaugeType,
+		Help: "Max size of the pool"}
+
+	add := func(name string, pool *pgxpool.Pool) {
+		stat := pool.Stat()
+		dbName := c.pg.Config.DbName
+		labels := []string{"db", "pool"}
+		values := []string{dbName, name}
+		acquires.Samples = append(acquires.Samples, metrics.Sample{LabelNames: labels, LabelValues: values,
+			Value: float64(stat.AcquireCount())})
+		emptyAcquires.Samples = append(emptyAcquires.Samples, metrics.Sample{LabelNames: labels,
+			LabelValues: values, Value: float64(stat.EmptyAcquireCount())})
+		acquireWait.Samples = append(acquireWait.Samples, metrics.Sample{LabelNames: labels, LabelValues: values,
+			Value: stat.AcquireDuration().Seconds()})
+		maxConnections.Samples = append(maxConnections.Samples, metrics.Sample{LabelNames: labels,
+			LabelValues: values, Value: float64(stat.MaxConns())})
+
+		stateLabels := []string{"db", "pool", "state"}
+		connections.Samples = append(connections.Samples,
+			metrics.Sample{LabelNames: stateLabels, LabelValues: []string{dbName, name, "idle"},
+				Value: float64(stat.IdleConns())},
+			metrics.Sample{LabelNames: stateLabels, LabelValues: []string{dbName, name, "in_use"},
+				Value: float64(stat.AcquiredConns())},
+			metrics.Sample{LabelNames: stateLabels, LabelValues: []string{dbName, name, "constructing"},
+				Value: float64(stat.ConstructingConns())},
+		)
+	}
+
+	add("primary", c.pg.pool)
+	if c.pg.replicas != nil {
+		for _, r := range c.pg.replicas.replicas {
+			add(r.host, r.pool)
+		}
+	}
+	return []*metrics.Family{acquires, emptyAcquires, acquireWait, connections, maxConnections}
+}
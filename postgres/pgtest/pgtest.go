@@ -0,0 +1,195 @@
+// Package pgtest creates throwaway postgres databases for integration tests. Every NewDB call creates a
+// uniquely named database with the schema of the Options and drops it when the test completes:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(pgtest.Main(m))
+//	}
+//
+//	func TestOrders(t *testing.T) {
+//		database := pgtest.NewDB(t, &pgtest.Options{Migrations: migrations})
+//		t.Run("create", func(t *testing.T) {
+//			ctx, handle := pgtest.NewTx(t, database)
+//			...
+//		})
+//	}
+//
+// Tests sharing a database with NewTx run in a transaction that is always rolled back, which is much faster
+// than creating a database per test. Tests are skipped if no postgres server is available (see getServer)
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/sterrasi/pinion/migrate"
+	"github.com/sterrasi/pinion/postgres"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// maxNameLength is the postgres identifier length limit
+const maxNameLength = 63
+
+// Options describe the schema and data of a test database
+type Options struct {
+	// Migrations are applied with a migrate.Migrator before the Files are executed
+	Migrations []*migrate.Migration
+	// Files are SQL files executed in order, in a single transaction (ex. seed data)
+	Files []string
+	// FS is the file system the Files are read from (ex. an embed.FS). They are read from disk if it is nil
+	FS fs.FS
+	// Types are the custom types registered on the connections of the database. They are registered after
+	// the Migrations and Files are applied, so the types they create can be registered
+	Types []postgres.TypeRegistration
+}
+
+// errRollback rolls back the transaction of NewTx
+var errRollback = app.BuildInternalError().Msg("Test transaction rolled back")
+
+// Main runs the tests of the package and then stops the postgres server if one was started for them. It is
+// called from the TestMain function of packages using NewDB
+func Main(m *testing.M) int {
+	code := m.Run()
+	if shared != nil {
+		shared.close()
+	}
+	return code
+}
+
+// NewDB creates a database for the test with the schema and data of the options and returns a db.DB
+// connected to it. The database is dropped when the test completes. The test is skipped if there is no
+// postgres server, and fails if the server configured with TEST_DB_HOST can not be connected to
+func NewDB(t *testing.T, opts *Options) db.DB {
+	t.Helper()
+	srv, reason, err := getServer()
+	if err != nil {
+		t.Fatalf("unable to connect to the test database server: %s", err.Error())
+	}
+	if srv == nil {
+		t.Skip(reason)
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	ctx := context.Background()
+	name := databaseName(t.Name())
+	if err = srv.createDatabase(ctx, name); err != nil {
+		t.Fatalf("unable to create test database '%s': %s", name, err.Error())
+	}
+	t.Cleanup(func() {
+		if err := srv.dropDatabase(context.Background(), name); err != nil {
+			t.Errorf("unable to drop test database '%s': %s", name, err.Error())
+		}
+	})
+
+	cfg := srv.databaseConfig(name)
+	database, err := postgres.NewPostgresDb(cfg)
+	if err != nil {
+		t.Fatalf("unable to connect to test database '%s': %s", name, err.Error())
+	}
+	if err = setup(ctx, database, opts); err != nil {
+		database.Close()
+		t.Fatalf("unable to set up test database '%s': %s", name, err.Error())
+	}
+
+	// connections load the custom types when they are opened, which requires the schema to exist
+	if len(opts.Types) > 0 {
+		database.Close()
+		if database, err = postgres.NewPostgresDb(cfg, opts.Types...); err != nil {
+			t.Fatalf("unable to connect to test database '%s': %s", name, err.Error())
+		}
+	}
+	t.Cleanup(database.Close)
+	return database
+}
+
+// NewTx starts a serializable read write transaction on the database that is rolled back when the test
+// completes, so that tests sharing a database do not see each other's changes. The returned context carries
+// the transaction (see db.WithHandle), so code calling db.InTx with it joins the transaction
+func NewTx(t *testing.T, database db.DB) (context.Context, db.DatabaseHandle) {
+	t.Helper()
+	handles := make(chan db.DatabaseHandle)
+	done := make(chan struct{})
+	result := make(chan app.Error, 1)
+
+	go func() {
+		result <- database.WriteSerializableTransaction(context.Background(),
+			func(handle db.DatabaseHandle) app.Error {
+				handles <- handle
+				<-done
+				return errRollback
+			})
+	}()
+
+	select {
+	case handle := <-handles:
+		t.Cleanup(func() {
+			close(done)
+			if err := <-result; err != errRollback {
+				t.Errorf("unable to roll back the test transaction: %v", err)
+			}
+		})
+		return db.WithHandle(context.Background(), handle, db.TxSerializableWriteOptions), handle
+	case err := <-result:
+		t.Fatalf("unable to begin the test transaction: %v", err)
+		return nil, nil
+	}
+}
+
+// setup applies the migrations and then executes the files of the options
+func setup(ctx context.Context, database db.DB, opts *Options) app.Error {
+	if len(opts.Migrations) > 0 {
+		migrator, err := migrate.NewMigrator(database, opts.Migrations, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = migrator.Up(ctx); err != nil {
+			return err
+		}
+	}
+	if len(opts.Files) == 0 {
+		return nil
+	}
+	return database.WriteTransaction(ctx, func(handle db.DatabaseHandle) app.Error {
+		for _, file := range opts.Files {
+			var err app.Error
+			if opts.FS != nil {
+				err = handle.ExecFS(ctx, opts.FS, file)
+			} else {
+				err = handle.ExecFile(file)
+			}
+			if err != nil {
+				err.SetContext(file)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// databaseName returns a unique database name derived from the test name
+func databaseName(testName string) string {
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+
+	var name strings.Builder
+	name.WriteString("test_")
+	for _, c := range strings.ToLower(testName) {
+		switch {
+		case (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'):
+			name.WriteRune(c)
+		case name.Len() > 0 && !strings.HasSuffix(name.String(), "_"):
+			name.WriteByte('_')
+		}
+	}
+
+	prefix := strings.TrimSuffix(name.String(), "_")
+	if limit := maxNameLength - 1 - 2*len(suffix); len(prefix) > limit {
+		prefix = prefix[:limit]
+	}
+	return prefix + "_" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,85 @@
+package pgtest
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/sterrasi/pinion/migrate"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(Main(m))
+}
+
+type count struct {
+	Count int64 `db:"count"`
+}
+
+var countItems = &db.QueryStatement[count]{
+	Name:   "CountItems",
+	SQL:    "SELECT count(*) AS count FROM items",
+	Mapper: db.StructMapper[count](),
+}
+
+// test that database names are unique valid identifiers derived from the test name
+func TestDatabaseName(t *testing.T) {
+	name := databaseName("TestOrders/create-Order #2")
+	assert.Regexp(t, regexp.MustCompile(`^test_testorders_create_order_2_[0-9a-f]{12}$`), name)
+	assert.NotEqual(t, name, databaseName("TestOrders/create-Order #2"))
+
+	long := databaseName(strings.Repeat("a", 100))
+	assert.Len(t, long, maxNameLength)
+}
+
+// test that the server is configured from the environment
+func TestEnvConfig(t *testing.T) {
+	t.Setenv(portEnvVar, "6543")
+	t.Setenv(userEnvVar, "")
+	t.Setenv(nameEnvVar, "maintenance")
+	cfg := envConfig("db.example.com")
+	assert.Equal(t, "db.example.com", cfg.Host)
+	assert.Equal(t, uint(6543), cfg.Port)
+	assert.Equal(t, "postgres", cfg.User)
+	assert.Equal(t, "maintenance", cfg.DbName)
+}
+
+// test that a test database is created with its schema and that test transactions are rolled back
+func TestNewDB(t *testing.T) {
+	migrations, err := migrate.LoadFS(fstest.MapFS{
+		"sql/0001_create_items.up.sql": {Data: []byte("CREATE TABLE items (id BIGINT PRIMARY KEY)")},
+	}, "sql")
+	if err != nil {
+		t.Fatalf("Error loading migrations: %s", err.Error())
+	}
+	database := NewDB(t, &Options{
+		Migrations: migrations,
+		Files:      []string{"seed.sql"},
+		FS:         fstest.MapFS{"seed.sql": {Data: []byte("INSERT INTO items VALUES (1)")}},
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		ctx, handle := NewTx(t, database)
+		_, err := handle.Exec(ctx, "INSERT INTO items VALUES (2)")
+		assert.Nil(t, err)
+
+		err = database.InTx(ctx, nil, func(ctx context.Context) app.Error {
+			handle, _ := db.HandleFrom(ctx)
+			result, err := countItems.QueryRow(ctx, handle)
+			if err == nil {
+				assert.Equal(t, int64(2), result.Count)
+			}
+			return err
+		})
+		assert.Nil(t, err)
+	})
+
+	result, appErr := countItems.QueryRow(context.Background(), database)
+	assert.Nil(t, appErr)
+	assert.Equal(t, int64(1), result.Count)
+}
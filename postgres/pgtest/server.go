@@ -0,0 +1,189 @@
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/sterrasi/pinion/postgres"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variables describing the postgres server the test databases are created on
+const (
+	hostEnvVar     = "TEST_DB_HOST"
+	portEnvVar     = "TEST_DB_PORT"
+	userEnvVar     = "TEST_DB_USER"
+	passwordEnvVar = "TEST_DB_PASSWORD"
+	sslModeEnvVar  = "TEST_DB_SSL_MODE"
+	// nameEnvVar is the maintenance database that is connected to for creating and dropping test databases
+	nameEnvVar = "TEST_DB_NAME"
+)
+
+const connectTimeout = 2 * time.Second
+
+// server is a postgres server that test databases are created on
+type server struct {
+	// config connects to the maintenance database
+	config *db.DbConfig
+	admin  db.DB
+	// forceDrop is true if the server supports DROP DATABASE ... WITH (FORCE) (postgres 13+)
+	forceDrop bool
+	// dir holds the data directory and socket of a server started by the tests, if any
+	dir   string
+	pgCtl string
+}
+
+var (
+	serverOnce sync.Once
+	shared     *server
+	// unavailable is the reason there is no server, after which the tests needing one are skipped
+	unavailable string
+	// serverErr is the error connecting to the configured server, which fails the tests needing one
+	serverErr app.Error
+)
+
+// getServer returns the server test databases are created on, finding or starting it on first use. The server
+// configured with the TEST_DB_* environment variables is used if TEST_DB_HOST is set. Otherwise a server
+// listening on localhost:5432 is used, or one is started from the initdb and pg_ctl binaries found on PATH
+func getServer() (*server, string, app.Error) {
+	serverOnce.Do(func() {
+		if host := os.Getenv(hostEnvVar); host != "" {
+			shared, serverErr = connect(envConfig(host), "", "")
+			return
+		}
+
+		local := &db.DbConfig{Host: "localhost", Port: 5432, User: "postgres", SSLMode: "disable"}
+		if srv, err := connect(local, "", ""); err == nil {
+			shared = srv
+			return
+		}
+
+		srv, reason := start()
+		shared, unavailable = srv, reason
+	})
+	return shared, unavailable, serverErr
+}
+
+// envConfig returns the configuration of the maintenance database of the server given by the environment
+func envConfig(host string) *db.DbConfig {
+	cfg := &db.DbConfig{
+		Host:     host,
+		DbName:   os.Getenv(nameEnvVar),
+		User:     os.Getenv(userEnvVar),
+		Password: os.Getenv(passwordEnvVar),
+		SSLMode:  os.Getenv(sslModeEnvVar),
+	}
+	if port, err := strconv.ParseUint(os.Getenv(portEnvVar), 10, 16); err == nil {
+		cfg.Port = uint(port)
+	}
+	if cfg.User == "" {
+		cfg.User = "postgres"
+	}
+	return cfg
+}
+
+// connect connects to the maintenance database of the server
+func connect(cfg *db.DbConfig, dir string, pgCtl string) (*server, app.Error) {
+	if cfg.DbName == "" {
+		cfg.DbName = "postgres"
+	}
+	cfg.ConnectTimeout = connectTimeout
+	cfg.MaxOpenConnections = 2
+
+	admin, err := postgres.NewPostgresDb(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &server{config: cfg, admin: admin, dir: dir, pgCtl: pgCtl}
+	var version string
+	if err = admin.QueryRow(context.Background(), "SHOW server_version_num").Scan(&version); err == nil {
+		num, _ := strconv.Atoi(version)
+		srv.forceDrop = num >= 130000
+	}
+	return srv, nil
+}
+
+// start initializes a temporary data directory and starts a server on it that only listens on a unix socket
+// of the directory. It returns the reason if the server can not be started
+func start() (*server, string) {
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		return nil, "no postgres server is available and initdb was not found on PATH"
+	}
+	pgCtl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return nil, "no postgres server is available and pg_ctl was not found on PATH"
+	}
+
+	dir, err := os.MkdirTemp("", "pgtest")
+	if err != nil {
+		return nil, fmt.Sprintf("unable to create the postgres data directory: %s", err.Error())
+	}
+	dataDir := filepath.Join(dir, "data")
+
+	out, err := exec.Command(initdb, "-D", dataDir, "-U", "postgres", "-A", "trust", "-E", "UTF8",
+		"--no-sync").CombinedOutput()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Sprintf("initdb failed: %s: %s", err.Error(), out)
+	}
+
+	// durability is not needed for throwaway databases
+	options := fmt.Sprintf("-k %s -c listen_addresses='' -c fsync=off -c synchronous_commit=off "+
+		"-c full_page_writes=off", dir)
+	out, err = exec.Command(pgCtl, "-D", dataDir, "-l", filepath.Join(dir, "postgres.log"), "-o", options,
+		"-w", "start").CombinedOutput()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Sprintf("pg_ctl start failed: %s: %s", err.Error(), out)
+	}
+
+	srv, err := connect(&db.DbConfig{Host: dir, Port: 5432, User: "postgres"}, dir, pgCtl)
+	if err != nil {
+		stop(dir, pgCtl)
+		return nil, fmt.Sprintf("unable to connect to the started postgres server: %s", err.Error())
+	}
+	return srv, ""
+}
+
+// close disconnects from the server, stopping it if it was started by the tests
+func (s *server) close() {
+	s.admin.Close()
+	if s.dir != "" {
+		stop(s.dir, s.pgCtl)
+	}
+}
+
+func stop(dir string, pgCtl string) {
+	_ = exec.Command(pgCtl, "-D", filepath.Join(dir, "data"), "-m", "immediate", "-w", "stop").Run()
+	_ = os.RemoveAll(dir)
+}
+
+// databaseConfig returns the configuration of the named database of the server
+func (s *server) databaseConfig(name string) *db.DbConfig {
+	cfg := *s.config
+	cfg.DbName = name
+	cfg.MaxOpenConnections = 0
+	return &cfg
+}
+
+func (s *server) createDatabase(ctx context.Context, name string) app.Error {
+	_, err := s.admin.Exec(ctx, fmt.Sprintf(`CREATE DATABASE "%s"`, name))
+	return err
+}
+
+func (s *server) dropDatabase(ctx context.Context, name string) app.Error {
+	sql := fmt.Sprintf(`DROP DATABASE IF EXISTS "%s"`, name)
+	if s.forceDrop {
+		sql += " WITH (FORCE)"
+	}
+	_, err := s.admin.Exec(ctx, sql)
+	return err
+}
@@ -8,23 +8,34 @@ import (
 	"github.com/sterrasi/pinion/app"
 	"github.com/sterrasi/pinion/db"
 	"github.com/sterrasi/pinion/logger"
+	"github.com/sterrasi/pinion/metrics"
+	"github.com/sterrasi/pinion/tracing"
+	"strconv"
 )
 
 // pgDb is a postgres specific (pgx) DB interface
 type pgDb struct {
-	dbHandleImpl
-	pool   *pgxpool.Pool
-	Config *db.DbConfig
-	url    string
+	*sqlHandleImpl
+	pool      *pgxpool.Pool
+	replicas  *replicaSet
+	collector *poolCollector
+	Config    *db.DbConfig
+	url       string
 }
 
-// NewPostgresDb connects to a postgres database described in the given db.DbConfig
-func NewPostgresDb(cfg *db.DbConfig) (db.DB, app.Error) {
+// NewPostgresDb connects to a postgres database described in the given db.DbConfig. The custom types (ex.
+// UserType, JSONB) are registered on every connection, in order
+func NewPostgresDb(cfg *db.DbConfig, types ...TypeRegistration) (db.DB, app.Error) {
 
 	pg := &pgDb{Config: cfg}
-	pg.url = fmt.Sprintf("postgres://%s:%s@%s/%s", cfg.User, cfg.Password, cfg.Host, cfg.DbName)
+	pg.url = describe(cfg)
 
-	dbPool, err := pgxpool.New(context.Background(), pg.url)
+	poolCfg, appErr := poolConfig(cfg)
+	if appErr != nil {
+		return nil, appErr
+	}
+	poolCfg.AfterConnect = afterConnect(types)
+	dbPool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 	if err != nil {
 		return nil, app.BuildSysConfigError().
 			Cause(err).
@@ -32,6 +43,7 @@ func NewPostgresDb(cfg *db.DbConfig) (db.DB, app.Error) {
 			Msg("Error creating database pool")
 	}
 	pg.pool = dbPool
+	pg.sqlHandleImpl = &sqlHandleImpl{q: dbPool}
 
 	// Ping the database to make sure the connection is valid
 	if err = pg.pool.Ping(context.Background()); err != nil {
@@ -41,6 +53,20 @@ func NewPostgresDb(cfg *db.DbConfig) (db.DB, app.Error) {
 			Msg("Error connecting to postgres")
 	}
 
+	if len(cfg.ReplicaHosts) > 0 {
+		pg.replicas, appErr = newReplicaSet(cfg, poolCfg)
+		if appErr != nil {
+			pg.pool.Close()
+			return nil, appErr
+		}
+		pg.replicas.monitor(poolCfg.HealthCheckPeriod)
+	}
+	if cfg.SlowQuery.Threshold > 0 {
+		db.SetSlowQueryPolicy(cfg.SlowQuery)
+	}
+	pg.collector = &poolCollector{pg: pg}
+	metrics.Default.Register(pg.collector)
+
 	var hiddenPassword string
 	if len(cfg.Password) > 0 {
 		hiddenPassword = "<yes>"
@@ -55,6 +81,9 @@ func NewPostgresDb(cfg *db.DbConfig) (db.DB, app.Error) {
 		Str("host", cfg.Host).
 		Str("schema", cfg.Schema).
 		Str("database name", cfg.DbName).
+		Str("sslMode", cfg.SSLMode).
+		Str("maxConnections", strconv.FormatInt(int64(poolCfg.MaxConns), 10)).
+		Strs("replicas", cfg.ReplicaHosts).
 		Str("url", pg.url).
 		Msg("Connected to postgres")
 
@@ -63,13 +92,46 @@ func NewPostgresDb(cfg *db.DbConfig) (db.DB, app.Error) {
 
 // Close closes the connection
 func (pg *pgDb) Close() {
+	metrics.Default.Unregister(pg.collector)
+	if pg.replicas != nil {
+		pg.replicas.close()
+	}
 	pg.pool.Close()
 	logger.Info().
 		Str("url", pg.url).
 		Msg("Successfully shut down connection to postgres")
 }
 
-// ReadTransaction executes a transaction with db.TransactionOptions defaults for read-only
+// Acquire reserves a connection of the pool for the caller
+func (pg *pgDb) Acquire(ctx context.Context) (db.Conn, app.Error) {
+	conn, err := pg.pool.Acquire(ctx)
+	if err != nil {
+		return nil, handlePgxError(err, &statementDescriptor{operation: "acquire connection"})
+	}
+	return &pgConn{sqlHandleImpl: &sqlHandleImpl{q: conn}, conn: conn}, nil
+}
+
+// pgConn implements a db.Conn
+type pgConn struct {
+	*sqlHandleImpl
+	conn *pgxpool.Conn
+}
+
+// WaitForNotification blocks until a notification is received on a channel the connection listens to
+func (c *pgConn) WaitForNotification(ctx context.Context) (*db.Notification, app.Error) {
+	n, err := c.conn.Conn().WaitForNotification(ctx)
+	if err != nil {
+		return nil, handlePgxError(err, &statementDescriptor{operation: "wait for notification"})
+	}
+	return &db.Notification{PID: n.PID, Channel: n.Channel, Payload: n.Payload}, nil
+}
+
+// Release returns the connection to the pool
+func (c *pgConn) Release() {
+	c.conn.Release()
+}
+
+// ReadTransaction executes a read only transaction with db.TxReadOptions. Writes fail (see db.TxReadOptions)
 func (pg *pgDb) ReadTransaction(ctx context.Context, tnFn db.TransactionFn) app.Error {
 	return pg.Transaction(ctx, db.TxReadOptions, tnFn)
 }
@@ -84,7 +146,10 @@ func (pg *pgDb) WriteSerializableTransaction(ctx context.Context, tnFn db.Transa
 	return pg.Transaction(ctx, db.TxSerializableWriteOptions, tnFn)
 }
 
-// Transaction executes a transaction with pgx.TxOptions defaults for read-only
+// Transaction executes a transaction with the given db.TransactionOptions. Read only transactions are
+// routed to a healthy read replica if any are configured, unless the context requests the primary (see
+// db.WithPrimary). A transaction that fails due to a serialization failure or deadlock is retried according
+// to the options' RetryPolicy, defaulting to the configured one
 func (pg *pgDb) Transaction(ctx context.Context, txOptions *db.TransactionOptions, tnFn db.TransactionFn) app.Error {
 
 	pgxOpts, appErr := asPgxOptions(txOptions)
@@ -92,24 +157,93 @@ func (pg *pgDb) Transaction(ctx context.Context, txOptions *db.TransactionOption
 		return appErr
 	}
 
-	tx, err := pg.pool.BeginTx(ctx, *pgxOpts)
+	retry := &pg.Config.TxRetry
+	if txOptions.Retry != nil {
+		retry = txOptions.Retry
+	}
+	useReplica := pg.replicas != nil && txOptions.AccessMode == db.ReadOnly && !db.PrimaryRequested(ctx)
+
+	ctx, span := tracing.Start(ctx, "db.transaction", tracing.ClientSpan)
+	defer span.End()
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.transaction.access_mode", string(pgxOpts.AccessMode))
+	span.SetAttribute("db.transaction.isolation", string(pgxOpts.IsoLevel))
+
+	appErr = db.RunWithRetry(ctx, retry, func() app.Error {
+		if useReplica {
+			if r := pg.replicas.pick(); r != nil {
+				return pg.replicaTransaction(ctx, r, pgxOpts, tnFn)
+			}
+		}
+		tx, err := begin(ctx, pg.pool, pgxOpts)
+		if err != nil {
+			return err
+		}
+		return complete(ctx, tx, tnFn)
+	})
+	span.RecordError(appErr)
+	return appErr
+}
+
+// replicaTransaction executes a read only transaction on the replica, tracking its health. The primary is
+// used if the transaction can not be started on the replica
+func (pg *pgDb) replicaTransaction(ctx context.Context, r *replica, pgxOpts *pgx.TxOptions,
+	tnFn db.TransactionFn) app.Error {
+
+	tx, appErr := begin(ctx, r.pool, pgxOpts)
+	if appErr != nil {
+		if ctx.Err() != nil {
+			return appErr
+		}
+		pg.replicas.failed(r, appErr)
+		logger.Debug().
+			Str("replica", r.host).
+			Msg("Unable to begin read transaction on replica, using the primary")
+
+		if tx, appErr = begin(ctx, pg.pool, pgxOpts); appErr != nil {
+			return appErr
+		}
+		return complete(ctx, tx, tnFn)
+	}
+
+	appErr = complete(ctx, tx, tnFn)
+	switch {
+	case isReplicaFailure(ctx, appErr):
+		pg.replicas.failed(r, appErr)
+	case appErr == nil:
+		pg.replicas.succeeded(r)
+	}
+	return appErr
+}
+
+// InTx joins the transaction found in the context or starts a new one with the given db.TransactionOptions
+func (pg *pgDb) InTx(ctx context.Context, txOptions *db.TransactionOptions, fn db.TxContextFn) app.Error {
+	return db.InTx(ctx, pg, txOptions, fn)
+}
+
+// begin starts a transaction on a connection of the pool
+func begin(ctx context.Context, pool *pgxpool.Pool, pgxOpts *pgx.TxOptions) (pgx.Tx, app.Error) {
+	tx, err := pool.BeginTx(ctx, *pgxOpts)
 	if err != nil {
-		return db.BuildDatabaseError().
-			Cause(err).
-			Msg("Error calling begin transaction")
+		return nil, handlePgxError(err, &statementDescriptor{operation: "begin transaction"})
 	}
+	return tx, nil
+}
 
-	appErr = tnFn(NewDatabaseHandle(tx))
+// complete executes the transaction function, committing the transaction if it succeeds and rolling it back
+// otherwise
+func complete(ctx context.Context, tx pgx.Tx, tnFn db.TransactionFn) app.Error {
+	appErr := tnFn(NewDatabaseHandle(tx))
 	if appErr != nil {
 		_ = tx.Rollback(ctx)
+		transactionCount.With("rollback").Inc()
 		return appErr
 	}
-	err = tx.Commit(ctx)
-	if err != nil {
-		return db.BuildSqlError().
-			Cause(err).
-			Msg("Error Committing transaction")
+	if err := tx.Commit(ctx); err != nil {
+		transactionCount.With("rollback").Inc()
+		return handlePgxError(err, &statementDescriptor{operation: "commit"})
 	}
+	transactionCount.With("commit").Inc()
 	return nil
 }
 
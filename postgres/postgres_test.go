@@ -0,0 +1,147 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/sterrasi/pinion/postgres/pgtest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+// the tests of this file run against a postgres server (see pgtest), in an external test package since
+// pgtest depends on the postgres package
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
+}
+
+type setting struct {
+	Value string `db:"value"`
+}
+
+var showApplicationName = &db.QueryStatement[setting]{
+	Name:   "ShowApplicationName",
+	SQL:    "SELECT current_setting('application_name') AS value",
+	Mapper: db.StructMapper[setting](),
+}
+
+type count struct {
+	Count int64 `db:"count"`
+}
+
+var countItems = &db.QueryStatement[count]{
+	Name:   "CountItems",
+	SQL:    "SELECT count(*) AS count FROM items",
+	Mapper: db.StructMapper[count](),
+}
+
+func newItemsDB(t *testing.T) db.DB {
+	database := pgtest.NewDB(t, nil)
+	if _, err := database.Exec(context.Background(), "CREATE TABLE items (id BIGINT PRIMARY KEY)"); err != nil {
+		t.Fatalf("Error creating table: %s", err.Error())
+	}
+	return database
+}
+
+// test that statements executed on the DB are committed without a transaction
+func TestAutocommit(t *testing.T) {
+	database := newItemsDB(t)
+	ctx := context.Background()
+
+	result, err := database.Exec(ctx, "INSERT INTO items VALUES ($1), ($2)", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), result.RowsAffected)
+
+	items, err := countItems.QueryRow(ctx, database)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), items.Count)
+}
+
+// test that the session state of an acquired connection is kept until it is released
+func TestAcquireRelease(t *testing.T) {
+	database := newItemsDB(t)
+	ctx := context.Background()
+
+	conn, err := database.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Error acquiring connection: %s", err.Error())
+	}
+	_, err = conn.Exec(ctx, "SET application_name = 'pinion-test'")
+	assert.Nil(t, err)
+	name, err := showApplicationName.QueryRow(ctx, conn)
+	assert.Nil(t, err)
+	assert.Equal(t, "pinion-test", name.Value)
+	conn.Release()
+
+	conn, err = database.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Error acquiring connection: %s", err.Error())
+	}
+	defer conn.Release()
+	_, err = conn.Exec(ctx, "INSERT INTO items VALUES (1)")
+	assert.Nil(t, err)
+}
+
+// test that a listening connection receives the notifications sent on its channel
+func TestWaitForNotification(t *testing.T) {
+	database := newItemsDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := database.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Error acquiring connection: %s", err.Error())
+	}
+	defer conn.Release()
+	if _, err = conn.Exec(ctx, "LISTEN events"); err != nil {
+		t.Fatalf("Error listening: %s", err.Error())
+	}
+
+	_, err = database.Exec(ctx, "SELECT pg_notify('events', 'created')")
+	assert.Nil(t, err)
+	n, err := conn.WaitForNotification(ctx)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "events", n.Channel)
+		assert.Equal(t, "created", n.Payload)
+	}
+
+	short, cancelShort := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelShort()
+	_, err = conn.WaitForNotification(short)
+	assert.NotNil(t, err)
+}
+
+// test that the outer transaction survives a savepoint whose statement failed, keeping only its own writes
+func TestSavepoint(t *testing.T) {
+	database := newItemsDB(t)
+	ctx := context.Background()
+
+	err := database.WriteTransaction(ctx, func(handle db.DatabaseHandle) app.Error {
+		if _, err := handle.Exec(ctx, "INSERT INTO items VALUES (1)"); err != nil {
+			return err
+		}
+		err := handle.Savepoint(ctx, func(nested db.DatabaseHandle) app.Error {
+			if _, err := nested.Exec(ctx, "INSERT INTO items VALUES (2)"); err != nil {
+				return err
+			}
+			_, err := nested.Exec(ctx, "INSERT INTO items VALUES (1)")
+			return err
+		})
+		if assert.NotNil(t, err) {
+			assert.Equal(t, app.AlreadyExistsErrorCode, err.Code())
+		}
+
+		return handle.Savepoint(ctx, func(nested db.DatabaseHandle) app.Error {
+			_, err := nested.Exec(ctx, "INSERT INTO items VALUES (3)")
+			return err
+		})
+	})
+	assert.Nil(t, err)
+
+	items, err := countItems.QueryRow(ctx, database)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), items.Count)
+}
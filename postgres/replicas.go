@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/sterrasi/pinion/logger"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replica is a read replica connection pool and its health
+type replica struct {
+	host string
+	pool *pgxpool.Pool
+	// consecutive failures
+	failures atomic.Int32
+	// unix nano time until which the replica is ejected
+	ejectedUntil atomic.Int64
+}
+
+func (r *replica) healthy(now time.Time) bool {
+	return now.UnixNano() >= r.ejectedUntil.Load()
+}
+
+// replicaSet routes read transactions to healthy replicas, ejecting the ones that keep failing
+type replicaSet struct {
+	replicas         []*replica
+	balancing        db.ReplicaBalancing
+	failureThreshold int32
+	ejectionTime     time.Duration
+	next             atomic.Uint64
+	stop             chan struct{}
+	stopped          sync.WaitGroup
+}
+
+// newReplicaSet creates a pool for each replica host of the config, based on the primary's pool config
+func newReplicaSet(cfg *db.DbConfig, primary *pgxpool.Config) (*replicaSet, app.Error) {
+	rs := &replicaSet{
+		balancing:        cfg.ReplicaBalancing,
+		failureThreshold: int32(cfg.ReplicaFailureThreshold),
+		ejectionTime:     cfg.ReplicaEjectionTime,
+		stop:             make(chan struct{}),
+	}
+	if rs.failureThreshold < 1 {
+		rs.failureThreshold = 1
+	}
+
+	for _, host := range cfg.ReplicaHosts {
+		pool, err := pgxpool.NewWithConfig(context.Background(), replicaConfig(primary, host))
+		if err != nil {
+			rs.close()
+			return nil, app.BuildSysConfigError().
+				Cause(err).
+				Str("replica", host).
+				Msg("Error creating read replica pool")
+		}
+		r := &replica{host: host, pool: pool}
+		rs.replicas = append(rs.replicas, r)
+
+		// an unreachable replica does not prevent the service from starting
+		if err = pool.Ping(context.Background()); err != nil {
+			rs.eject(r, err)
+		}
+	}
+	return rs, nil
+}
+
+// replicaHostAndPort splits the host into its host and port, using the default port if it has none
+func replicaHostAndPort(host string, defaultPort uint16) (string, uint16) {
+	h, p, err := net.SplitHostPort(host)
+	if err != nil {
+		return host, defaultPort
+	}
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return host, defaultPort
+	}
+	return h, uint16(port)
+}
+
+// replicaConfig returns a copy of the primary's pool config connecting to the replica host
+func replicaConfig(primary *pgxpool.Config, host string) *pgxpool.Config {
+	replicaHost, replicaPort := replicaHostAndPort(host, primary.ConnConfig.Port)
+	cfg := primary.Copy()
+	cfg.ConnConfig.Host, cfg.ConnConfig.Port = replicaHost, replicaPort
+	setServerName(cfg.ConnConfig.TLSConfig, replicaHost)
+	for _, fallback := range cfg.ConnConfig.Fallbacks {
+		// ex. the non TLS fallback of sslmode=prefer
+		fallback.Host, fallback.Port = replicaHost, replicaPort
+		setServerName(fallback.TLSConfig, replicaHost)
+	}
+	return cfg
+}
+
+// setServerName verifies the certificate of the replica instead of the primary's. The TLS configs of the
+// copied primary config are clones, so they can be modified
+func setServerName(tlsConfig *tls.Config, host string) {
+	if tlsConfig != nil {
+		tlsConfig.ServerName = host
+	}
+}
+
+// pick returns a healthy replica or nil if there is none
+func (rs *replicaSet) pick() *replica {
+	now := time.Now()
+	healthy := make([]*replica, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		if r.healthy(now) {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if rs.balancing == db.LeastConnections {
+		least := healthy[0]
+		for _, r := range healthy[1:] {
+			if r.pool.Stat().AcquiredConns() < least.pool.Stat().AcquiredConns() {
+				least = r
+			}
+		}
+		return least
+	}
+	return healthy[rs.next.Add(1)%uint64(len(healthy))]
+}
+
+// succeeded resets the failures of the replica
+func (rs *replicaSet) succeeded(r *replica) {
+	r.failures.Store(0)
+}
+
+// failed counts a failure of the replica, ejecting it once the failure threshold is reached
+func (rs *replicaSet) failed(r *replica, err error) {
+	if r.failures.Add(1) >= rs.failureThreshold {
+		rs.eject(r, err)
+	}
+}
+
+func (rs *replicaSet) eject(r *replica, err error) {
+	r.failures.Store(0)
+	r.ejectedUntil.Store(time.Now().Add(rs.ejectionTime).UnixNano())
+	logger.Warn().
+		Str("replica", r.host).
+		Str("ejectionTime", rs.ejectionTime.String()).
+		Str("error", err.Error()).
+		Msg("Ejected read replica")
+}
+
+// monitor pings the replicas every period so failing replicas are ejected before reads are routed to them,
+// and ejected replicas that recovered are restored
+func (rs *replicaSet) monitor(period time.Duration) {
+	if period <= 0 {
+		return
+	}
+	rs.stopped.Add(1)
+	go func() {
+		defer rs.stopped.Done()
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rs.stop:
+				return
+			case <-ticker.C:
+				rs.check(period)
+			}
+		}
+	}()
+}
+
+// check pings every replica
+func (rs *replicaSet) check(timeout time.Duration) {
+	for _, r := range rs.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.pool.Ping(ctx)
+		cancel()
+
+		switch {
+		case err != nil && r.healthy(time.Now()):
+			rs.failed(r, err)
+		case err == nil && !r.healthy(time.Now()):
+			r.ejectedUntil.Store(0)
+			logger.Info().
+				Str("replica", r.host).
+				Msg("Restored read replica")
+		case err == nil:
+			rs.succeeded(r)
+		}
+	}
+}
+
+func (rs *replicaSet) close() {
+	close(rs.stop)
+	rs.stopped.Wait()
+	for _, r := range rs.replicas {
+		r.pool.Close()
+	}
+}
+
+// isReplicaFailure returns true if the error means that the replica could not serve the transaction. Errors
+// caused by the cancellation or deadline of the context are not failures of the replica
+func isReplicaFailure(ctx context.Context, err app.Error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	return err.Code() == app.ServiceUnavailableErrorCode
+}
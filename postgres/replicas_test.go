@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestReplicaSet(hosts ...string) *replicaSet {
+	rs := &replicaSet{
+		balancing:        db.RoundRobin,
+		failureThreshold: 2,
+		ejectionTime:     time.Minute,
+		stop:             make(chan struct{}),
+	}
+	for _, h := range hosts {
+		rs.replicas = append(rs.replicas, &replica{host: h})
+	}
+	return rs
+}
+
+// test that reads are spread over the replicas in turn
+func TestReplicaRoundRobin(t *testing.T) {
+	rs := newTestReplicaSet("a", "b")
+	picked := map[string]int{}
+	for i := 0; i < 4; i++ {
+		picked[rs.pick().host]++
+	}
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, picked)
+}
+
+// test that a replica is ejected after consecutive failures and that a success resets the count
+func TestReplicaEjection(t *testing.T) {
+	rs := newTestReplicaSet("a", "b")
+	a := rs.replicas[0]
+	failure := errors.New("connection refused")
+
+	rs.failed(a, failure)
+	rs.succeeded(a)
+	rs.failed(a, failure)
+	assert.True(t, a.healthy(time.Now()))
+
+	rs.failed(a, failure)
+	assert.False(t, a.healthy(time.Now()))
+	assert.True(t, a.healthy(time.Now().Add(2*time.Minute)))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b", rs.pick().host)
+	}
+
+	rs.failed(rs.replicas[1], failure)
+	rs.failed(rs.replicas[1], failure)
+	assert.Nil(t, rs.pick())
+}
+
+// test the replica host parsing
+func TestReplicaHostAndPort(t *testing.T) {
+	host, port := replicaHostAndPort("replica1:6432", 5432)
+	assert.Equal(t, "replica1", host)
+	assert.Equal(t, uint16(6432), port)
+
+	host, port = replicaHostAndPort("replica2", 5432)
+	assert.Equal(t, "replica2", host)
+	assert.Equal(t, uint16(5432), port)
+}
+
+// test that the replica config connects to and verifies the certificate of the replica host
+func TestReplicaConfig(t *testing.T) {
+	primary, err := pgxpool.ParseConfig("postgres://app@primary:5432/app?sslmode=prefer")
+	if err != nil {
+		t.Fatalf("Error parsing config: %s", err.Error())
+	}
+	primary.ConnConfig.TLSConfig.ServerName = "primary"
+
+	cfg := replicaConfig(primary, "replica1:6432")
+	assert.Equal(t, "replica1", cfg.ConnConfig.Host)
+	assert.Equal(t, uint16(6432), cfg.ConnConfig.Port)
+	assert.Equal(t, "replica1", cfg.ConnConfig.TLSConfig.ServerName)
+	for _, fallback := range cfg.ConnConfig.Fallbacks {
+		assert.Equal(t, "replica1", fallback.Host)
+		if fallback.TLSConfig != nil {
+			assert.Equal(t, "replica1", fallback.TLSConfig.ServerName)
+		}
+	}
+	assert.Equal(t, "primary", primary.ConnConfig.TLSConfig.ServerName)
+}
+
+// test that unavailable and unreachable replicas are failures, unless the context is done
+func TestIsReplicaFailure(t *testing.T) {
+	refused := translatePgxError(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+		&statementDescriptor{operation: "begin transaction"})
+	assert.True(t, isReplicaFailure(context.Background(), refused))
+	assert.True(t, isReplicaFailure(context.Background(), app.BuildSvcUnavailableError().Msg("shutdown")))
+	assert.False(t, isReplicaFailure(context.Background(), app.BuildValidationError().Msg("invalid")))
+	assert.False(t, isReplicaFailure(context.Background(), nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, isReplicaFailure(ctx, refused))
+}
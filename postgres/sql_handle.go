@@ -3,18 +3,52 @@ package postgres
 import (
 	"context"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/sterrasi/pinion/app"
 	"github.com/sterrasi/pinion/db"
 )
 
+// querier is the statement execution interface shared by pgx.Tx, pgxpool.Pool and pgxpool.Conn
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // db.SqlHandle interface implementation
 type sqlHandleImpl struct {
-	tx pgx.Tx
+	q querier
+}
+
+// bindArgs rewrites the named parameters of the statement if it is called with a single db.NamedArgs
+// argument. Other arguments are passed to pgx as they are
+func bindArgs(sql string, args []any) (string, []any, app.Error) {
+	if len(args) != 1 {
+		return sql, args, nil
+	}
+	namedArgs, ok := args[0].(db.NamedArgs)
+	if !ok {
+		return sql, args, nil
+	}
+
+	named, err := db.ParseNamed(db.Postgres, sql)
+	if err != nil {
+		return "", nil, err
+	}
+	bound, err := named.Bind(namedArgs)
+	if err != nil {
+		return "", nil, err
+	}
+	return named.SQL, bound, nil
 }
 
 // Exec executes the given SQL statement
 func (sh *sqlHandleImpl) Exec(ctx context.Context, sql string, args ...any) (*db.ExecResult, app.Error) {
-	tag, err := sh.tx.Exec(ctx, sql, args)
+	sql, args, appErr := bindArgs(sql, args)
+	if appErr != nil {
+		return nil, appErr
+	}
+	tag, err := sh.q.Exec(ctx, sql, args...)
 	if err != nil {
 		return nil, handlePgxError(err, &statementDescriptor{
 			operation: "execute",
@@ -28,7 +62,11 @@ func (sh *sqlHandleImpl) Exec(ctx context.Context, sql string, args ...any) (*db
 
 // Query executes the given sql query returning the matching rows
 func (sh *sqlHandleImpl) Query(ctx context.Context, sql string, args ...any) (db.RowIterator, app.Error) {
-	rows, err := sh.tx.Query(ctx, sql, args)
+	sql, args, appErr := bindArgs(sql, args)
+	if appErr != nil {
+		return nil, appErr
+	}
+	rows, err := sh.q.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, handlePgxError(err, &statementDescriptor{
 			operation: "query",
@@ -43,38 +81,82 @@ func (sh *sqlHandleImpl) Query(ctx context.Context, sql string, args ...any) (db
 	}, nil
 }
 
-// QueryRow executes a sql statement expecting only one row to be selected
+// QueryRow executes a sql statement expecting only one row to be selected. Any error is deferred until Scan
+// is called
 func (sh *sqlHandleImpl) QueryRow(ctx context.Context, sql string, args ...any) db.Row {
-	row := sh.tx.QueryRow(ctx, sql, args)
+	desc := &statementDescriptor{
+		operation: "single-row query",
+		sql:       sql,
+	}
+	sql, args, appErr := bindArgs(sql, args)
+	if appErr != nil {
+		return &pgxRowWrapper{appErr: appErr, desc: desc}
+	}
+
+	// pgx.Row does not expose the result columns, so the row is read from pgx.Rows the way pgx does it
+	rows, err := sh.q.Query(ctx, sql, args...)
 	return &pgxRowWrapper{
-		row: row,
-		desc: &statementDescriptor{
-			operation: "single-row query",
-			sql:       sql,
-		},
+		rows: rows,
+		err:  err,
+		desc: desc,
 	}
 }
 
-// pgxRowWrapper implements a db.Row
+// pgxRowWrapper implements a db.Row and a db.ColumnScanner
 type pgxRowWrapper struct {
-	row  pgx.Row
-	desc *statementDescriptor
+	rows pgx.Rows
+	err  error
+	// appErr is an error binding the arguments of the query
+	appErr app.Error
+	desc   *statementDescriptor
+}
+
+func (rs *pgxRowWrapper) Columns() []string {
+	if rs.err != nil || rs.appErr != nil {
+		return nil
+	}
+	return columnNames(rs.rows)
+}
+
+func (rs *pgxRowWrapper) Close() {
+	if rs.rows != nil {
+		rs.rows.Close()
+	}
 }
 
 func (rs *pgxRowWrapper) Scan(dest ...any) app.Error {
-	err := rs.row.Scan(dest)
-	if err != nil {
+	if rs.appErr != nil {
+		return rs.appErr
+	}
+	if rs.err != nil {
+		return handlePgxError(rs.err, rs.desc)
+	}
+	defer rs.rows.Close()
+
+	if !rs.rows.Next() {
+		err := rs.rows.Err()
+		if err == nil {
+			err = pgx.ErrNoRows
+		}
 		return handlePgxError(err, rs.desc)
 	}
-	return nil
+	if err := rs.rows.Scan(dest...); err != nil {
+		return handlePgxError(err, rs.desc)
+	}
+	rs.rows.Close()
+	return handlePgxError(rs.rows.Err(), rs.desc)
 }
 
-// pgxRowsWrapper implements a db.RowIterator
+// pgxRowsWrapper implements a db.RowIterator and a db.ColumnScanner
 type pgxRowsWrapper struct {
 	rows pgx.Rows
 	desc *statementDescriptor
 }
 
+func (rs *pgxRowsWrapper) Columns() []string {
+	return columnNames(rs.rows)
+}
+
 func (rs *pgxRowsWrapper) Close() {
 	rs.rows.Close()
 }
@@ -92,7 +174,7 @@ func (rs *pgxRowsWrapper) Next() bool {
 }
 
 func (rs *pgxRowsWrapper) Scan(dest ...any) app.Error {
-	err := rs.rows.Scan(dest)
+	err := rs.rows.Scan(dest...)
 	if err != nil {
 		return handlePgxError(err, rs.desc)
 	}
@@ -106,3 +188,13 @@ func (rs *pgxRowsWrapper) Values() ([]any, app.Error) {
 	}
 	return values, nil
 }
+
+// columnNames returns the names of the result columns
+func columnNames(rows pgx.Rows) []string {
+	fields := rows.FieldDescriptions()
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	return names
+}
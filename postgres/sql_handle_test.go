@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test that a single db.NamedArgs argument is rewritten and other arguments are passed as they are
+func TestBindArgs(t *testing.T) {
+	sql, args, err := bindArgs("SELECT * FROM t WHERE a = :a", []any{db.NamedArgs{"a": 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a = $1", sql)
+	assert.Equal(t, []any{1}, args)
+
+	sql, args, err = bindArgs("SELECT * FROM t WHERE a = $1", []any{1})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE a = $1", sql)
+	assert.Equal(t, []any{1}, args)
+
+	_, _, err = bindArgs("SELECT * FROM t WHERE a = :a", []any{db.NamedArgs{}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sterrasi/pinion"
+	"strings"
+)
+
+// TypeRegistration registers a custom type on the type map of every new connection of a pool. Types that
+// depend on other custom types (ex. a composite with an enum field) must be registered after them
+type TypeRegistration func(ctx context.Context, conn *pgx.Conn) error
+
+// UserType registers the enum or composite type of the given (optionally schema qualified) name and its
+// array type. Enum values are read into and written from strings or string based types. Composite values are
+// read into and written from structs whose fields are in the order of the attributes of the type (or types
+// implementing pgtype.CompositeIndexScanner and pgtype.CompositeIndexGetter)
+func UserType(name string) TypeRegistration {
+	return loadTypes(name, arrayTypeName(name))
+}
+
+// JSONB registers the Go type of the value (ex. a struct) to be written as jsonb when the type of a statement
+// argument is not otherwise known. Reading jsonb columns into structs needs no registration
+func JSONB(value any) TypeRegistration {
+	return func(_ context.Context, conn *pgx.Conn) error {
+		conn.TypeMap().RegisterDefaultPgType(value, "jsonb")
+		return nil
+	}
+}
+
+// loadTypes loads the definitions of the named types from the database and registers them
+func loadTypes(names ...string) TypeRegistration {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		for _, name := range names {
+			t, err := conn.LoadType(ctx, name)
+			if err != nil {
+				return fmt.Errorf("unable to load type '%s': %w", name, err)
+			}
+			conn.TypeMap().RegisterType(t)
+		}
+		return nil
+	}
+}
+
+// arrayTypeName returns the name of the array type of the named type (ex. "app.status" -> "app._status")
+func arrayTypeName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i+1] + "_" + name[i+1:]
+	}
+	return "_" + name
+}
+
+// afterConnect registers pinion.UUID support and the custom types on a new connection
+func afterConnect(types []TypeRegistration) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		registerUUID(conn.TypeMap())
+		for _, register := range types {
+			if err := register(ctx, conn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// registerUUID lets pinion.UUID values be written to and read from uuid columns
+func registerUUID(m *pgtype.Map) {
+	m.TryWrapEncodePlanFuncs = append([]pgtype.TryWrapEncodePlanFunc{tryWrapUUIDEncodePlan},
+		m.TryWrapEncodePlanFuncs...)
+	m.TryWrapScanPlanFuncs = append([]pgtype.TryWrapScanPlanFunc{tryWrapUUIDScanPlan}, m.TryWrapScanPlanFuncs...)
+	m.RegisterDefaultPgType(pinion.UUID{}, "uuid")
+	m.RegisterDefaultPgType([]pinion.UUID{}, "_uuid")
+}
+
+// uuidWrapper adapts a pinion.UUID to the pgtype UUID valuer and scanner interfaces
+type uuidWrapper pinion.UUID
+
+func (w uuidWrapper) UUIDValue() (pgtype.UUID, error) {
+	return pgtype.UUID{Bytes: w, Valid: true}, nil
+}
+
+func (w *uuidWrapper) ScanUUID(v pgtype.UUID) error {
+	if !v.Valid {
+		return fmt.Errorf("cannot scan NULL into *pinion.UUID")
+	}
+	*w = v.Bytes
+	return nil
+}
+
+func tryWrapUUIDEncodePlan(value any) (pgtype.WrappedEncodePlanNextSetter, any, bool) {
+	if u, ok := value.(pinion.UUID); ok {
+		return &wrapUUIDEncodePlan{}, uuidWrapper(u), true
+	}
+	return nil, nil, false
+}
+
+type wrapUUIDEncodePlan struct {
+	next pgtype.EncodePlan
+}
+
+func (plan *wrapUUIDEncodePlan) SetNext(next pgtype.EncodePlan) {
+	plan.next = next
+}
+
+func (plan *wrapUUIDEncodePlan) Encode(value any, buf []byte) ([]byte, error) {
+	return plan.next.Encode(uuidWrapper(value.(pinion.UUID)), buf)
+}
+
+func tryWrapUUIDScanPlan(target any) (pgtype.WrappedScanPlanNextSetter, any, bool) {
+	if u, ok := target.(*pinion.UUID); ok {
+		return &wrapUUIDScanPlan{}, (*uuidWrapper)(u), true
+	}
+	return nil, nil, false
+}
+
+type wrapUUIDScanPlan struct {
+	next pgtype.ScanPlan
+}
+
+func (plan *wrapUUIDScanPlan) SetNext(next pgtype.ScanPlan) {
+	plan.next = next
+}
+
+func (plan *wrapUUIDScanPlan) Scan(src []byte, target any) error {
+	return plan.next.Scan(src, (*uuidWrapper)(target.(*pinion.UUID)))
+}
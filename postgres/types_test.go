@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sterrasi/pinion"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test that the array type name keeps the schema of the element type
+func TestArrayTypeName(t *testing.T) {
+	assert.Equal(t, "_status", arrayTypeName("status"))
+	assert.Equal(t, "app._status", arrayTypeName("app.status"))
+}
+
+// test that pinion.UUID values round trip through the uuid type
+func TestUUIDType(t *testing.T) {
+	m := pgtype.NewMap()
+	registerUUID(m)
+	id := pinion.UUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	for _, format := range []int16{pgtype.TextFormatCode, pgtype.BinaryFormatCode} {
+		buf, err := m.Encode(pgtype.UUIDOID, format, id, nil)
+		assert.Nil(t, err)
+
+		var scanned pinion.UUID
+		assert.Nil(t, m.Scan(pgtype.UUIDOID, format, buf, &scanned))
+		assert.Equal(t, id, scanned)
+
+		assert.NotNil(t, m.Scan(pgtype.UUIDOID, format, nil, &scanned))
+	}
+}
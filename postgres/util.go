@@ -1,53 +1,88 @@
 package postgres
 
 import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/sterrasi/pinion/app"
 	"github.com/sterrasi/pinion/db"
+	"io"
+	"net"
 	"strings"
 )
 
-// postgres Error Codes
-const duplicateKeyPgError = "23505"     // duplicate key constraint violation error (record already exists)
-const connectionExceptionPgClass = "08" // Class 08 - Connection Exception
-
-// isDuplicateKeyError checks the given error to see if it is a Postgres based error related to a duplicate
-// key violation
-func isDuplicateKeyError(err error) bool {
-	switch err.(type) {
-	case *pgconn.PgError:
-		if err.(*pgconn.PgError).Code == duplicateKeyPgError {
-			return true
-		}
-		return false
+// sqlState describes how a postgres SQLSTATE is translated into an app.Error
+type sqlState struct {
+	build func() *app.ErrorBuilder
+	// reason completes the message "<operation> failed due to <reason>"
+	reason string
+	// retryable errors may not occur again if the statement or transaction is executed again
+	retryable bool
+}
 
-	default:
-		return false
-	}
+// sqlStates translates specific SQLSTATE codes (see https://www.postgresql.org/docs/current/errcodes-appendix.html)
+var sqlStates = map[string]*sqlState{
+	// integrity constraint violations
+	"23505": {build: app.BuildAlreadyExistsError, reason: "duplicate key"},
+	"23P01": {build: app.BuildAlreadyExistsError, reason: "an exclusion constraint violation"},
+	"23503": {build: app.BuildValidationError, reason: "a foreign key violation"},
+	"23502": {build: app.BuildValidationError, reason: "a not null violation"},
+	"23514": {build: app.BuildValidationError, reason: "a check constraint violation"},
+
+	// transaction conflicts
+	"40001": {build: db.BuildTransactionConflictError, reason: "a conflicting transaction", retryable: true},
+	"40P01": {build: db.BuildTransactionConflictError, reason: "a conflicting transaction", retryable: true},
+
+	// timeouts
+	"57014": {build: db.BuildTimeoutError, reason: "a statement timeout or cancellation"},
+	"55P03": {build: db.BuildTimeoutError, reason: "a lock timeout", retryable: true},
+	"25P03": {build: db.BuildTimeoutError, reason: "an idle in transaction timeout"},
+
+	// operator intervention
+	"57P01": {build: app.BuildSvcUnavailableError, reason: "a server shutdown", retryable: true},
+	"57P02": {build: app.BuildSvcUnavailableError, reason: "a server crash", retryable: true},
+	"57P03": {build: app.BuildSvcUnavailableError, reason: "the server not accepting connections",
+		retryable: true},
+
+	"25006": {build: app.BuildIllegalStateError, reason: "a write in a read only transaction"},
 }
 
-// toPostgresError casts the given error to a postgres based error, otherwise returns an IllegalArgumentError
-func toPostgresError(err error) (*pgconn.PgError, error) {
-	switch err.(type) {
-	case *pgconn.PgError:
-		return err.(*pgconn.PgError), nil
-	default:
-		return nil, app.NewIllegalArgumentError("Expecting a Postgres error but got %T", err)
-	}
+// sqlStateClasses translates the classes (first two characters) of the SQLSTATE codes without a specific
+// translation
+var sqlStateClasses = map[string]*sqlState{
+	"08": {build: app.BuildSvcUnavailableError, reason: "a connection error", retryable: true},
+	"53": {build: app.BuildSvcUnavailableError, reason: "insufficient resources", retryable: true},
+	"22": {build: app.BuildValidationError, reason: "invalid data"},
+	"23": {build: app.BuildValidationError, reason: "an integrity constraint violation"},
 }
 
+// connectionExceptionPgClass is the SQLSTATE class of connection exceptions
+const connectionExceptionPgClass = "08"
+
 // IsConnectionClassError returns true if the given error is Postgres based and if it is connection related
 func IsConnectionClassError(err error) bool {
-	switch err.(type) {
-	case *pgconn.PgError:
-		if strings.HasPrefix(err.(*pgconn.PgError).Code, connectionExceptionPgClass) {
-			return true
-		}
-		return false
+	var pgError *pgconn.PgError
+	return errors.As(err, &pgError) && strings.HasPrefix(pgError.Code, connectionExceptionPgClass)
+}
 
-	default:
-		return false
+// isNetworkError returns true if the error is a failure to connect or to communicate with the server. pgconn
+// does not export its connect error, but wraps the dial error or the unexpected end of the connection
+func isNetworkError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// lookupSqlState returns the translation of the SQLSTATE code, or nil if there is none
+func lookupSqlState(code string) *sqlState {
+	if state, found := sqlStates[code]; found {
+		return state
+	}
+	if len(code) == 5 {
+		return sqlStateClasses[code[:2]]
 	}
+	return nil
 }
 
 type statementDescriptor struct {
@@ -71,45 +106,72 @@ func (sd *statementDescriptor) decorate(builder *app.ErrorBuilder) *app.ErrorBui
 }
 
 func handlePgxError(err error, desc *statementDescriptor) app.Error {
-	return handlePgxErrorWithCause(err, nil, desc)
-}
-
-func handlePgxErrorWithCause(err error, cause error, desc *statementDescriptor) app.Error {
 	if err == nil {
 		return nil
 	}
+	return countError(translatePgxError(err, desc))
+}
 
-	// check to see if the record already exists
-	if isDuplicateKeyError(err) {
-		errBuilder := app.BuildAlreadyExistsError().Cause(cause)
-		pgError, e := toPostgresError(cause)
-		if e == nil {
-			errBuilder.
-				Str("constraintName", pgError.ConstraintName).
-				Str("postgresCode", pgError.Code).
-				Str("postgresColumn", pgError.ColumnName)
-		}
+// translatePgxError converts a pgx error into an app.Error. Postgres errors are translated by their SQLSTATE
+// with the violated constraint, table and column in the metadata. Errors reaching the server are retryable
+// service unavailable errors, and the deadline or cancellation of the context is a timeout. The message of a constraint violation is
+// the one registered with db.RegisterConstraintMessage, if any
+func translatePgxError(err error, desc *statementDescriptor) app.Error {
 
-		return desc.decorate(errBuilder).Msgf("%s failed due to duplicate key", desc.operation)
+	// a single row query that selected no row
+	if errors.Is(err, pgx.ErrNoRows) {
+		return desc.decorate(app.BuildNotFoundError().Cause(err)).Msg("Query returned no rows")
 	}
 
-	// check for a database connection error
-	if IsConnectionClassError(cause) {
-		errBuilder := app.BuildSvcUnavailableError().Cause(err)
-		pgError, e := toPostgresError(cause)
-		if e == nil {
-			errBuilder.Str("postgresCode", pgError.Code)
-		}
+	// a statement interrupted by the deadline of its context
+	if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return desc.decorate(db.BuildTimeoutError().Cause(err)).
+			Msgf("%s failed due to the deadline of its context", desc.operation)
+	}
+
+	// a statement interrupted by the cancellation of its context
+	if errors.Is(err, context.Canceled) {
+		return desc.decorate(db.BuildTimeoutError().Cause(err)).
+			Msgf("%s was cancelled", desc.operation)
+	}
 
-		return desc.decorate(errBuilder).Msg("Database connection error")
+	// the server could not be reached or the connection was lost
+	if isNetworkError(err) {
+		return desc.decorate(app.BuildSvcUnavailableError().Cause(err).Str(db.RetryableKey, "true")).
+			Msgf("%s failed due to a connection error", desc.operation)
 	}
 
-	// default to SQL exception
-	errBuilder := db.BuildSqlError().Cause(err)
-	pgError, e := toPostgresError(cause)
-	if e == nil {
-		errBuilder.Str("postgresCode", pgError.Code)
+	var pgError *pgconn.PgError
+	if !errors.As(err, &pgError) {
+		return desc.decorate(db.BuildSqlError().Cause(err)).
+			Msgf("SQL error during '%s' operation", desc.operation)
 	}
 
-	return desc.decorate(errBuilder).Msgf("SQL error during '%s' operation", desc.operation)
+	state := lookupSqlState(pgError.Code)
+	if state == nil {
+		return desc.decorate(db.BuildSqlError().Cause(err).Str("postgresCode", pgError.Code)).
+			Msgf("SQL error during '%s' operation", desc.operation)
+	}
+
+	errBuilder := state.build().
+		Cause(err).
+		Str("postgresCode", pgError.Code)
+	if pgError.ConstraintName != "" {
+		errBuilder.Str("constraintName", pgError.ConstraintName)
+	}
+	if pgError.TableName != "" {
+		errBuilder.Str("postgresTable", pgError.TableName)
+	}
+	if pgError.ColumnName != "" {
+		errBuilder.Str("postgresColumn", pgError.ColumnName)
+	}
+	if state.retryable {
+		errBuilder.Str(db.RetryableKey, "true")
+	}
+	desc.decorate(errBuilder)
+
+	if message, found := db.ConstraintMessage(pgError.ConstraintName); found {
+		return errBuilder.Msg(message)
+	}
+	return errBuilder.Msgf("%s failed due to %s", desc.operation, state.reason)
 }
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sterrasi/pinion/app"
+	"github.com/sterrasi/pinion/db"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+)
+
+// test that a query selecting no row is translated to a NotFoundError
+func TestTranslateNoRows(t *testing.T) {
+	desc := &statementDescriptor{operation: "single-row query", sql: "SELECT 1"}
+	for _, err := range []error{pgx.ErrNoRows, fmt.Errorf("scan: %w", pgx.ErrNoRows)} {
+		appErr := translatePgxError(err, desc)
+		assert.Equal(t, app.NotFoundErrorCode, appErr.Code())
+		assert.Equal(t, "SELECT 1", appErr.GetMetadata()["sql"])
+	}
+}
+
+// test that postgres errors are translated by their SQLSTATE code or class
+func TestTranslateSqlState(t *testing.T) {
+	desc := &statementDescriptor{operation: "insert"}
+	for code, expected := range map[string]app.ErrorCode{
+		"23505": app.AlreadyExistsErrorCode,
+		"23503": app.ValidationErrorCode,
+		"23502": app.ValidationErrorCode,
+		"23514": app.ValidationErrorCode,
+		"22P02": app.ValidationErrorCode,
+		"40001": db.TransactionConflictErrorCode,
+		"40P01": db.TransactionConflictErrorCode,
+		"57014": db.TimeoutErrorCode,
+		"55P03": db.TimeoutErrorCode,
+		"08006": app.ServiceUnavailableErrorCode,
+		"53300": app.ServiceUnavailableErrorCode,
+		"42P01": db.SQLErrorCode,
+	} {
+		appErr := translatePgxError(fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: code}), desc)
+		assert.Equal(t, expected, appErr.Code(), code)
+		assert.Equal(t, code, appErr.GetMetadataValue("postgresCode"), code)
+	}
+}
+
+// test that the violated constraint is reported in the metadata and selects the registered message
+func TestTranslateConstraintViolation(t *testing.T) {
+	pgErr := &pgconn.PgError{Code: "23502", TableName: "users", ColumnName: "email"}
+	appErr := translatePgxError(pgErr, &statementDescriptor{operation: "insert"})
+	assert.Equal(t, "insert failed due to a not null violation", app.MessageOf(appErr))
+	assert.Equal(t, "users", appErr.GetMetadataValue("postgresTable"))
+	assert.Equal(t, "email", appErr.GetMetadataValue("postgresColumn"))
+
+	t.Cleanup(db.RegisterConstraintMessage("orders_user_fk", "The user of the order does not exist"))
+	pgErr = &pgconn.PgError{Code: "23503", ConstraintName: "orders_user_fk"}
+	appErr = translatePgxError(pgErr, &statementDescriptor{operation: "insert"})
+	assert.Equal(t, app.ValidationErrorCode, appErr.Code())
+	assert.Equal(t, "The user of the order does not exist", app.MessageOf(appErr))
+	assert.Equal(t, "orders_user_fk", appErr.GetMetadataValue("constraintName"))
+	assert.False(t, db.IsRetryable(appErr))
+}
+
+// test that transient errors are retryable and context deadlines are timeouts
+func TestTranslateRetryableAndTimeout(t *testing.T) {
+	desc := &statementDescriptor{operation: "query"}
+	assert.True(t, db.IsRetryable(translatePgxError(&pgconn.PgError{Code: "40001"}, desc)))
+	assert.True(t, db.IsRetryable(translatePgxError(&pgconn.PgError{Code: "08006"}, desc)))
+	assert.True(t, db.IsRetryable(translatePgxError(&pgconn.PgError{Code: "55P03"}, desc)))
+	assert.False(t, db.IsRetryable(translatePgxError(&pgconn.PgError{Code: "57014"}, desc)))
+
+	appErr := translatePgxError(fmt.Errorf("query: %w", context.DeadlineExceeded), desc)
+	assert.True(t, db.IsTimeout(appErr))
+}
+
+// test that cancelled statements are timeouts and network errors are retryable service unavailable errors
+func TestTranslateCancelledAndNetwork(t *testing.T) {
+	desc := &statementDescriptor{operation: "query"}
+	appErr := translatePgxError(fmt.Errorf("query: %w", context.Canceled), desc)
+	assert.True(t, db.IsTimeout(appErr))
+	assert.False(t, db.IsRetryable(appErr))
+
+	for _, err := range []error{
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+		&net.DNSError{Err: "no such host", Name: "db"},
+		fmt.Errorf("receive message: %w", io.ErrUnexpectedEOF),
+	} {
+		appErr = translatePgxError(err, desc)
+		assert.Equal(t, app.ServiceUnavailableErrorCode, appErr.Code(), err.Error())
+		assert.True(t, db.IsRetryable(appErr), err.Error())
+	}
+}
@@ -0,0 +1,218 @@
+package tracing
+
+import (
+	"github.com/sterrasi/pinion/app"
+	"strings"
+	"time"
+)
+
+const tracingSectionName = "Tracing"
+
+const exporterFieldName = "tracingExporter"
+const serviceNameFieldName = "tracingServiceName"
+const sampleRatioFieldName = "tracingSampleRatio"
+const fileFieldName = "tracingFile"
+const otlpEndpointFieldName = "tracingOtlpEndpoint"
+const otlpHeadersFieldName = "tracingOtlpHeaders"
+const otlpTimeoutFieldName = "tracingOtlpTimeout"
+
+// ExporterType selects where spans are exported to
+type ExporterType string
+
+// Exporter types
+const (
+	// NoExporter propagates trace contexts without recording spans
+	NoExporter       ExporterType = "none"
+	StdoutExporter   ExporterType = "stdout"
+	FileExporter     ExporterType = "file"
+	OTLPHTTPExporter ExporterType = "otlp"
+)
+
+// TracingConfig describes the Tracer of a service
+type TracingConfig struct {
+	Exporter ExporterType
+	// ServiceName defaults to the name of the application
+	ServiceName string
+	// SampleRatio is the ratio (0 to 1) of new traces that are recorded
+	SampleRatio float64
+	// File is the path spans are appended to by the file exporter
+	File string
+	// OTLPEndpoint is the base url of the OpenTelemetry collector (ex. http://localhost:4318)
+	OTLPEndpoint string
+	// OTLPHeaders are added to export requests
+	OTLPHeaders map[string]string
+	OTLPTimeout time.Duration
+}
+
+// RegisterConfig will register the config field definitions of the Tracer
+func RegisterConfig(reg *app.FieldRegistry) {
+
+	// none, stdout, file or otlp
+	reg.CreateStringField(exporterFieldName).
+		ArgName("tracing-exporter").
+		EnvVar("TRACING_EXPORTER").
+		ConfigName(tracingSectionName, "Exporter").
+		ShortDesc("Span exporter (none, stdout, file or otlp)").
+		Default(string(NoExporter)).
+		Register()
+
+	reg.CreateStringField(serviceNameFieldName).
+		ArgName("tracing-service-name").
+		EnvVar("TRACING_SERVICE_NAME").
+		ConfigName(tracingSectionName, "ServiceName").
+		ShortDesc("Service name reported with the spans").
+		Register()
+
+	reg.CreateFloatField(sampleRatioFieldName).
+		ArgName("tracing-sample-ratio").
+		EnvVar("TRACING_SAMPLE_RATIO").
+		ConfigName(tracingSectionName, "SampleRatio").
+		ShortDesc("Ratio of new traces that are recorded").
+		Default(1.0).
+		Register()
+
+	// ex. /tmp/spans.json
+	reg.CreateStringField(fileFieldName).
+		ArgName("tracing-file").
+		EnvVar("TRACING_FILE").
+		ConfigName(tracingSectionName, "File").
+		ShortDesc("File the file exporter appends spans to").
+		Register()
+
+	reg.CreateStringField(otlpEndpointFieldName).
+		ArgName("tracing-otlp-endpoint").
+		EnvVar("TRACING_OTLP_ENDPOINT").
+		ConfigName(tracingSectionName, "OtlpEndpoint").
+		ShortDesc("OpenTelemetry collector OTLP/HTTP endpoint").
+		Default("http://localhost:4318").
+		Register()
+
+	// ex. authorization=Bearer abc,x-tenant=a
+	reg.CreateStringField(otlpHeadersFieldName).
+		ArgName("tracing-otlp-headers").
+		EnvVar("TRACING_OTLP_HEADERS").
+		ConfigName(tracingSectionName, "OtlpHeaders").
+		ShortDesc("Comma separated key=value headers of OTLP export requests").
+		Register()
+
+	// ex. 10s
+	reg.CreateStringField(otlpTimeoutFieldName).
+		ArgName("tracing-otlp-timeout").
+		ConfigName(tracingSectionName, "OtlpTimeout").
+		ShortDesc("Timeout of OTLP export requests").
+		Default("10s").
+		Register()
+}
+
+// NewTracingConfig creates the TracingConfig from the registered fields
+func NewTracingConfig(cfg *app.Configuration) (*TracingConfig, app.Error) {
+
+	exporter, err := cfg.GetStringValue(exporterFieldName)
+	if err != nil {
+		return nil, err
+	}
+	switch ExporterType(*exporter) {
+	case NoExporter, StdoutExporter, FileExporter, OTLPHTTPExporter:
+	default:
+		return nil, app.BuildSysConfigError().
+			Str("field", exporterFieldName).
+			Str("value", *exporter).
+			Msg("Invalid tracing exporter")
+	}
+
+	serviceName, err := cfg.GetStringValue(serviceNameFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleRatio, err := cfg.GetFloatValue(sampleRatioFieldName)
+	if err != nil {
+		return nil, err
+	}
+	if *sampleRatio < 0 || *sampleRatio > 1 {
+		return nil, app.BuildSysConfigError().
+			Str("field", sampleRatioFieldName).
+			Msgf("Tracing sample ratio %g is not between 0 and 1", *sampleRatio)
+	}
+
+	file, err := cfg.GetStringValue(fileFieldName)
+	if err != nil {
+		return nil, err
+	}
+	if ExporterType(*exporter) == FileExporter && *file == "" {
+		return nil, app.BuildSysConfigError().
+			Str("field", fileFieldName).
+			Msg("The file exporter requires a tracing file")
+	}
+
+	otlpEndpoint, err := cfg.GetStringValue(otlpEndpointFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	otlpHeaders, err := cfg.GetStringValue(otlpHeadersFieldName)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := parseHeaders(*otlpHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	otlpTimeout, err := cfg.GetDurationValue(otlpTimeoutFieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TracingConfig{
+		Exporter:     ExporterType(*exporter),
+		ServiceName:  *serviceName,
+		SampleRatio:  *sampleRatio,
+		File:         *file,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPHeaders:  headers,
+		OTLPTimeout:  *otlpTimeout,
+	}, nil
+}
+
+// NewTracerFromConfig creates the Tracer described by the TracingConfig. The application name is used if the
+// config does not name the service
+func NewTracerFromConfig(cfg *TracingConfig, applicationName string) (*Tracer, app.Error) {
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = applicationName
+	}
+
+	var exporter Exporter
+	switch cfg.Exporter {
+	case StdoutExporter:
+		exporter = NewStdoutExporter()
+	case FileExporter:
+		fileExporter, err := NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter
+	case OTLPHTTPExporter:
+		exporter = NewOTLPExporter(cfg.OTLPEndpoint, cfg.OTLPHeaders, cfg.OTLPTimeout)
+	}
+	return NewTracer(serviceName, exporter, cfg.SampleRatio), nil
+}
+
+// parseHeaders parses comma separated key=value pairs
+func parseHeaders(value string) (map[string]string, app.Error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(k) == "" {
+			return nil, app.BuildSysConfigError().
+				Str("field", otlpHeadersFieldName).
+				Msgf("Invalid OTLP header '%s', expected key=value", pair)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
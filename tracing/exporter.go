@@ -0,0 +1,242 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sterrasi/pinion/app"
+	"io"
+	nethttp "net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter sends ended spans to a tracing backend
+type Exporter interface {
+	// Export sends a batch of spans of the named service
+	Export(ctx context.Context, serviceName string, spans []*SpanData) error
+	// Shutdown releases the resources of the exporter
+	Shutdown(ctx context.Context) error
+}
+
+// WriterExporter writes spans as JSON lines. It is meant for development and tests
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterExporter creates an exporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewStdoutExporter creates an exporter writing to stdout
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter creates an exporter appending to the file at the given path
+func NewFileExporter(path string) (*WriterExporter, app.Error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, app.BuildIOError().
+			Cause(err).
+			Str("file", path).
+			Msg("Error opening span export file")
+	}
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+// jsonSpan is the JSON line written by the WriterExporter
+type jsonSpan struct {
+	Service       string         `json:"service,omitempty"`
+	TraceID       string         `json:"traceId"`
+	SpanID        string         `json:"spanId"`
+	ParentSpanID  string         `json:"parentSpanId,omitempty"`
+	Name          string         `json:"name"`
+	Kind          SpanKind       `json:"kind"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Status        StatusCode     `json:"status"`
+	StatusMessage string         `json:"statusMessage,omitempty"`
+}
+
+// Export satisfies the Exporter interface
+func (e *WriterExporter) Export(_ context.Context, serviceName string, spans []*SpanData) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, s := range spans {
+		js := jsonSpan{
+			Service:       serviceName,
+			TraceID:       s.TraceID.String(),
+			SpanID:        s.SpanID.String(),
+			Name:          s.Name,
+			Kind:          s.Kind,
+			Start:         s.Start,
+			End:           s.End,
+			Status:        s.Status,
+			StatusMessage: s.StatusMessage,
+		}
+		if s.ParentSpanID.IsValid() {
+			js.ParentSpanID = s.ParentSpanID.String()
+		}
+		if len(s.Attributes) > 0 {
+			js.Attributes = make(map[string]any, len(s.Attributes))
+			for _, a := range s.Attributes {
+				js.Attributes[a.Key] = attributeValue(a.Value)
+			}
+		}
+		if err := enc.Encode(js); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// Shutdown satisfies the Exporter interface. The file of a file exporter is closed
+func (e *WriterExporter) Shutdown(_ context.Context) error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using the OTLP/HTTP protocol with JSON encoding
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	client  *nethttp.Client
+}
+
+// NewOTLPExporter creates an exporter posting to the traces path of the collector endpoint
+// (ex. http://localhost:4318). The headers are added to every request (ex. for authentication)
+func NewOTLPExporter(endpoint string, headers map[string]string, timeout time.Duration) *OTLPExporter {
+	return &OTLPExporter{
+		url:     strings.TrimRight(endpoint, "/") + "/v1/traces",
+		headers: headers,
+		client:  &nethttp.Client{Timeout: timeout},
+	}
+}
+
+// Export satisfies the Exporter interface
+func (e *OTLPExporter) Export(ctx context.Context, serviceName string, spans []*SpanData) error {
+	body, err := json.Marshal(otlpRequest(serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp collector %s responded with status %d", e.url, resp.StatusCode)
+	}
+	return nil
+}
+
+// Shutdown satisfies the Exporter interface
+func (e *OTLPExporter) Shutdown(_ context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// otlpRequest builds the ExportTraceServiceRequest in the OTLP JSON encoding, where ids are hex strings and
+// 64 bit integers are decimal strings
+func otlpRequest(serviceName string, spans []*SpanData) map[string]any {
+	otlpSpans := make([]map[string]any, 0, len(spans))
+	for _, s := range spans {
+		span := map[string]any{
+			"traceId":           s.TraceID.String(),
+			"spanId":            s.SpanID.String(),
+			"name":              s.Name,
+			"kind":              int(s.Kind),
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+			"status":            map[string]any{"code": int(s.Status), "message": s.StatusMessage},
+		}
+		if s.ParentSpanID.IsValid() {
+			span["parentSpanId"] = s.ParentSpanID.String()
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{
+			map[string]any{
+				"resource": map[string]any{
+					"attributes": otlpAttributes([]Attribute{{Key: "service.name", Value: serviceName}}),
+				},
+				"scopeSpans": []any{
+					map[string]any{
+						"scope": map[string]any{"name": "github.com/sterrasi/pinion"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attributes []Attribute) []map[string]any {
+	result := make([]map[string]any, 0, len(attributes))
+	for _, a := range attributes {
+		var value map[string]any
+		switch v := attributeValue(a.Value).(type) {
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": v}
+		}
+		result = append(result, map[string]any{"key": a.Key, "value": value})
+	}
+	return result
+}
+
+// attributeValue normalizes an attribute value to a string, bool, int64 or float64
+func attributeValue(value any) any {
+	switch v := value.(type) {
+	case string, bool, int64, float64:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	nethttp "net/http"
+	"strings"
+)
+
+// TraceParentHeader is the W3C trace context header carrying the SpanContext of the caller
+const TraceParentHeader = "traceparent"
+
+// sampledFlag is the trace-flags bit of a sampled trace
+const sampledFlag = 0x01
+
+// FormatTraceParent formats the SpanContext as a W3C traceparent value (version 00)
+func FormatTraceParent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent parses a W3C traceparent value. Values of future versions are accepted as long as they
+// start with the fields of version 00
+func ParseTraceParent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if _, ok := decodeHex(parts[0], 1); !ok {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	traceID, ok := decodeHex(parts[1], len(sc.TraceID))
+	if !ok {
+		return SpanContext{}, false
+	}
+	spanID, ok := decodeHex(parts[2], len(sc.SpanID))
+	if !ok {
+		return SpanContext{}, false
+	}
+	flags, ok := decodeHex(parts[3], 1)
+	if !ok {
+		return SpanContext{}, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&sampledFlag != 0
+	sc.Remote = true
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Inject sets the traceparent header from the SpanContext of the context, if it has one
+func Inject(ctx context.Context, header nethttp.Header) {
+	if sc := SpanContextFrom(ctx); sc.IsValid() {
+		header.Set(TraceParentHeader, FormatTraceParent(sc))
+	}
+}
+
+// Extract returns a copy of the context carrying the SpanContext of the traceparent header. The context is
+// returned unchanged if the header is missing or invalid
+func Extract(ctx context.Context, header nethttp.Header) context.Context {
+	if sc, ok := ParseTraceParent(header.Get(TraceParentHeader)); ok {
+		return WithRemoteSpanContext(ctx, sc)
+	}
+	return ctx
+}
+
+// decodeHex decodes a lowercase hex string of the given decoded length
+func decodeHex(s string, length int) ([]byte, bool) {
+	if len(s) != length*2 || strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
@@ -0,0 +1,187 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"github.com/sterrasi/pinion/app"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace across services
+type TraceID [16]byte
+
+// String returns the lowercase hex encoding of the id
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns true if the id is not all zeros
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the lowercase hex encoding of the id
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns true if the id is not all zeros
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span that is propagated to other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled is true if the spans of the trace are recorded
+	Sampled bool
+	// Remote is true if the span context was received from another service
+	Remote bool
+}
+
+// IsValid returns true if both the trace and span ids are valid
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind describes the relationship of a span to its parent and children
+type SpanKind int
+
+// Span kinds, which have the values of the OpenTelemetry protocol
+const (
+	InternalSpan SpanKind = 1
+	ServerSpan   SpanKind = 2
+	ClientSpan   SpanKind = 3
+)
+
+// StatusCode is the outcome of a span, which has the values of the OpenTelemetry protocol
+type StatusCode int
+
+// Span status codes
+const (
+	StatusUnset StatusCode = 0
+	StatusOk    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key value pair describing a span. Values are strings, bools, int64s or float64s
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanData is the immutable record of an ended span that is handed to an Exporter
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	TraceID       TraceID
+	SpanID        SpanID
+	ParentSpanID  SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Span is a timed operation within a trace. A nil Span is valid and records nothing, so instrumented code
+// does not need to check whether tracing is enabled
+type Span struct {
+	mu     sync.Mutex
+	tracer *Tracer
+	ctx    SpanContext
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext returns the propagated context of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetName replaces the name of the span (ex. once the route of a request is known)
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Name = name
+	}
+}
+
+// SetAttribute sets an attribute of the span. Values other than strings, bools, ints and floats are
+// recorded using their string representation by the exporters
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	for i := range s.data.Attributes {
+		if s.data.Attributes[i].Key == key {
+			s.data.Attributes[i].Value = value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+}
+
+// SetStatus sets the status of the span
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Status = code
+	s.data.StatusMessage = message
+}
+
+// RecordError sets the status of the span to error and records the app.Error code and context as
+// attributes. A nil error is ignored
+func (s *Span) RecordError(err app.Error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetAttribute("error.code", err.CodeValue())
+	if ctx := err.GetContext(); ctx != "" {
+		s.SetAttribute("error.context", ctx)
+	}
+	s.SetStatus(StatusError, app.MessageOf(err))
+}
+
+// End ends the span and hands it to the exporter of its tracer if it is sampled. Calls after the first are
+// ignored
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.ctx.Sampled {
+		s.tracer.export(&data)
+	}
+}
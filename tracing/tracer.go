@@ -0,0 +1,235 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/sterrasi/pinion/logger"
+	mathrand "math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batchSize is the max number of spans handed to the exporter at once
+const batchSize = 512
+
+// queueSize is the number of ended spans buffered for export. Spans ended while the queue is full are dropped
+const queueSize = 2048
+
+// flushInterval is the max time an ended span waits in the queue
+const flushInterval = 5 * time.Second
+
+// Tracer starts spans and exports the sampled ones in batches from a background goroutine
+type Tracer struct {
+	serviceName string
+	exporter    Exporter
+	sampleRatio float64
+	queue       chan *SpanData
+	done        chan struct{}
+	once        sync.Once
+	dropped     atomic.Uint64
+	// mu guards the queue against sends once it is closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewTracer creates a Tracer that samples the given ratio (0 to 1) of new traces. Traces started by another
+// service keep the sampling decision of their parent. A nil exporter creates a Tracer that propagates trace
+// contexts without recording spans
+func NewTracer(serviceName string, exporter Exporter, sampleRatio float64) *Tracer {
+	t := &Tracer{
+		serviceName: serviceName,
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+		done:        make(chan struct{}),
+	}
+	if exporter == nil {
+		t.sampleRatio = 0
+		close(t.done)
+		return t
+	}
+	t.queue = make(chan *SpanData, queueSize)
+	go t.run()
+	return t
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+func init() {
+	defaultTracer.Store(NewTracer("", nil, 0))
+}
+
+// Default returns the Tracer used by the pinion packages. It records nothing until SetDefault is called
+func Default() *Tracer {
+	return defaultTracer.Load()
+}
+
+// SetDefault replaces the Tracer used by the pinion packages
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span with the Default Tracer
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return Default().Start(ctx, name, kind)
+}
+
+// ServiceName returns the name of the service the spans are reported for
+func (t *Tracer) ServiceName() string {
+	return t.serviceName
+}
+
+// Start starts a span that is a child of the span (local or remote) found in the context, or the root span of
+// a new trace. The returned context carries the new span. A Tracer without an exporter returns the context
+// as is with a nil Span, so the trace context of the parent is still propagated
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t.exporter == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFrom(ctx)
+
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = t.sampleRatio >= 1 || (t.sampleRatio > 0 && mathrand.Float64() < t.sampleRatio)
+	}
+
+	span := &Span{
+		tracer: t,
+		ctx:    sc,
+		data: SpanData{
+			Name:         name,
+			Kind:         kind,
+			TraceID:      sc.TraceID,
+			SpanID:       sc.SpanID,
+			ParentSpanID: parent.SpanID,
+			Start:        time.Now(),
+		},
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Shutdown exports the queued spans and shuts down the exporter. Spans ended afterwards are dropped
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.closed = true
+		if t.queue != nil {
+			close(t.queue)
+		}
+	})
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// export queues an ended span. It is dropped if the queue is full or the tracer was shut down
+func (t *Tracer) export(data *SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		t.dropped.Add(1)
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// run exports the queued spans in batches until the queue is closed
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(context.Background(), t.serviceName, batch); err != nil {
+			logger.Warn().
+				Err(err).
+				Int("spans", len(batch)).
+				Msg("Error exporting spans")
+		}
+		if dropped := t.dropped.Swap(0); dropped > 0 {
+			logger.Warn().
+				Uint64("spans", dropped).
+				Msg("Dropped spans because the export queue was full")
+		}
+		batch = make([]*SpanData, 0, batchSize)
+	}
+
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// spanKey is the context.Context key of the active span
+type spanKey struct{}
+
+// remoteKey is the context.Context key of a SpanContext received from another service
+type remoteKey struct{}
+
+// SpanFrom returns the active span of the context, or nil if there is none
+func SpanFrom(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFrom returns the SpanContext of the active span of the context, or the remote SpanContext if no
+// span was started locally
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if span := SpanFrom(ctx); span != nil {
+		return span.ctx
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// WithRemoteSpanContext returns a copy of the context carrying a SpanContext received from another service
+func WithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
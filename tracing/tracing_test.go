@@ -0,0 +1,190 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/sterrasi/pinion/app"
+	"github.com/stretchr/testify/assert"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const validTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// test that a traceparent value round trips
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := ParseTraceParent(validTraceParent)
+	assert.True(t, ok)
+	assert.True(t, sc.Sampled)
+	assert.True(t, sc.Remote)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.Equal(t, validTraceParent, FormatTraceParent(sc))
+
+	sc, ok = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.True(t, ok)
+	assert.False(t, sc.Sampled)
+}
+
+// test that invalid traceparent values are rejected
+func TestParseTraceParentInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		_, ok := ParseTraceParent(value)
+		assert.False(t, ok, value)
+	}
+}
+
+// test that spans continue the trace of the remote or local parent
+func TestStartParenting(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("svc", NewWriterExporter(&buf), 0)
+
+	header := nethttp.Header{}
+	header.Set(TraceParentHeader, validTraceParent)
+	ctx := Extract(context.Background(), header)
+
+	ctx, server := tracer.Start(ctx, "server", ServerSpan)
+	_, child := tracer.Start(ctx, "child", ClientSpan)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", child.SpanContext().TraceID.String())
+	assert.True(t, child.SpanContext().Sampled, "the sampling decision of the parent is kept")
+	assert.Equal(t, server.SpanContext().SpanID, child.data.ParentSpanID)
+	assert.Equal(t, "00f067aa0ba902b7", server.data.ParentSpanID.String())
+
+	out := nethttp.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, FormatTraceParent(server.SpanContext()), out.Get(TraceParentHeader))
+}
+
+// test that new traces are sampled by ratio and a tracer without an exporter records nothing
+func TestStartSampling(t *testing.T) {
+	_, span := NewTracer("svc", NewWriterExporter(io.Discard), 1).Start(context.Background(), "a", InternalSpan)
+	assert.True(t, span.SpanContext().Sampled)
+	assert.True(t, span.SpanContext().IsValid())
+
+	_, span = NewTracer("svc", NewWriterExporter(io.Discard), 0).Start(context.Background(), "a", InternalSpan)
+	assert.False(t, span.SpanContext().Sampled)
+
+	ctx := WithRemoteSpanContext(context.Background(), SpanContext{TraceID: newTraceID(), SpanID: newSpanID(),
+		Sampled: true})
+	started, span := NewTracer("svc", nil, 1).Start(ctx, "a", InternalSpan)
+	assert.Nil(t, span)
+	assert.Equal(t, SpanContextFrom(ctx), SpanContextFrom(started), "the parent is still propagated")
+}
+
+// test that spans ended after the tracer was shut down are dropped
+func TestEndAfterShutdown(t *testing.T) {
+	tracer := NewTracer("svc", NewWriterExporter(io.Discard), 1)
+	_, span := tracer.Start(context.Background(), "a", InternalSpan)
+
+	var ended sync.WaitGroup
+	ended.Add(1)
+	go func() {
+		defer ended.Done()
+		span.End()
+	}()
+	assert.Nil(t, tracer.Shutdown(context.Background()))
+	ended.Wait()
+
+	_, span = tracer.Start(context.Background(), "b", InternalSpan)
+	span.End()
+	assert.GreaterOrEqual(t, tracer.dropped.Load(), uint64(1))
+}
+
+// test that ended spans are written by the writer exporter when the tracer is shut down
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("svc", NewWriterExporter(&buf), 1)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", ServerSpan)
+	_, child := tracer.Start(ctx, "child", ClientSpan)
+	child.SetAttribute("db.statement", "SELECT 1")
+	notFound := app.BuildNotFoundError().Context("GetUser").Msg("User not found")
+	child.RecordError(notFound)
+	child.End()
+	child.End()
+	parent.End()
+	assert.Nil(t, tracer.Shutdown(context.Background()))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var span jsonSpan
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &span))
+	assert.Equal(t, "child", span.Name)
+	assert.Equal(t, "svc", span.Service)
+	assert.Equal(t, parent.SpanContext().SpanID.String(), span.ParentSpanID)
+	assert.Equal(t, StatusError, span.Status)
+	assert.Equal(t, "User not found", span.StatusMessage)
+	assert.Equal(t, "SELECT 1", span.Attributes["db.statement"])
+	assert.Equal(t, notFound.CodeValue(), span.Attributes["error.code"])
+	assert.Equal(t, "GetUser", span.Attributes["error.context"])
+}
+
+// test that a nil span records nothing
+func TestNilSpan(t *testing.T) {
+	var span *Span
+	span.SetName("a")
+	span.SetAttribute("a", 1)
+	span.RecordError(app.BuildInternalError().Msg("failed"))
+	span.End()
+	assert.False(t, span.SpanContext().IsValid())
+	assert.Nil(t, SpanFrom(context.Background()))
+}
+
+// test that the OTLP exporter posts the spans in the OTLP JSON encoding
+func TestOTLPExporter(t *testing.T) {
+	var path, auth string
+	var body map[string]any
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer server.Close()
+
+	tracer := NewTracer("svc", NewOTLPExporter(server.URL+"/", map[string]string{"Authorization": "Bearer x"}, 0), 1)
+	_, span := tracer.Start(context.Background(), "op", ServerSpan)
+	span.SetAttribute("count", 3)
+	span.End()
+	assert.Nil(t, tracer.Shutdown(context.Background()))
+
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "Bearer x", auth)
+
+	resourceSpans := body["resourceSpans"].([]any)[0].(map[string]any)
+	resource := resourceSpans["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	assert.Equal(t, "service.name", resource["key"])
+	assert.Equal(t, map[string]any{"stringValue": "svc"}, resource["value"])
+
+	otlpSpan := resourceSpans["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	assert.Equal(t, "op", otlpSpan["name"])
+	assert.Equal(t, span.SpanContext().TraceID.String(), otlpSpan["traceId"])
+	assert.Equal(t, float64(ServerSpan), otlpSpan["kind"])
+	assert.NotContains(t, otlpSpan, "parentSpanId")
+	attribute := otlpSpan["attributes"].([]any)[0].(map[string]any)
+	assert.Equal(t, map[string]any{"intValue": "3"}, attribute["value"])
+}
+
+// test that OTLP headers are parsed from comma separated pairs
+func TestParseHeaders(t *testing.T) {
+	headers, err := parseHeaders(" authorization=Bearer a=b , x-tenant=t,")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer a=b", "x-tenant": "t"}, headers)
+
+	_, err = parseHeaders("missing")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,68 @@
+package pinion
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// UUID is a 128 bit universally unique identifier (RFC 4122)
+type UUID [16]byte
+
+// ParseUUID parses the canonical 36 character form of a UUID (ex. "6ba7b810-9dad-11d1-80b4-00c04fd430c8").
+// Upper case hex digits and the 32 character form without dashes are also accepted
+func ParseUUID(value string) (UUID, error) {
+	var u UUID
+	s := strings.TrimSpace(value)
+
+	switch len(s) {
+	case 36:
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return u, errors.New("invalid UUID format")
+		}
+		s = s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	case 32:
+	default:
+		return u, errors.New("invalid UUID length")
+	}
+
+	if _, err := hex.Decode(u[:], []byte(s)); err != nil {
+		return u, errors.New("invalid UUID hex digit")
+	}
+	return u, nil
+}
+
+// String returns the canonical lower case form of the UUID
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// IsZero returns true if this is the nil UUID
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// MarshalText encodes the UUID in its canonical form
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText decodes a UUID using ParseUUID
+func (u *UUID) UnmarshalText(text []byte) error {
+	parsed, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
@@ -0,0 +1,23 @@
+package pinion
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseUUID(t *testing.T) {
+	u, err := ParseUUID("6BA7B810-9dad-11d1-80b4-00c04fd430c8")
+	assert.NoError(t, err)
+	assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", u.String())
+
+	u2, err := ParseUUID("6ba7b8109dad11d180b400c04fd430c8")
+	assert.NoError(t, err)
+	assert.Equal(t, u, u2)
+
+	_, err = ParseUUID("6ba7b810-9dad-11d1-80b4")
+	assert.Error(t, err)
+	_, err = ParseUUID("6ba7b810x9dad-11d1-80b4-00c04fd430c8")
+	assert.Error(t, err)
+	_, err = ParseUUID("zba7b810-9dad-11d1-80b4-00c04fd430c8")
+	assert.Error(t, err)
+}